@@ -8,15 +8,23 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"text/tabwriter"
 	"time"
+	"unicode"
 
 	"github.com/a-berahman/dating-app/constant"
 	"github.com/a-berahman/dating-app/internal/handlers"
 	"github.com/a-berahman/dating-app/internal/logic"
 	"github.com/a-berahman/dating-app/internal/repository"
+	"github.com/a-berahman/dating-app/pkg/idempotency"
+	"github.com/a-berahman/dating-app/pkg/keyring"
+	"github.com/a-berahman/dating-app/pkg/mailer"
+	"github.com/a-berahman/dating-app/pkg/migrate"
 
 	customMiddleware "github.com/a-berahman/dating-app/pkg/middleware"
+	"github.com/a-berahman/dating-app/pkg/utils"
 	"github.com/go-playground/validator"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -38,9 +46,17 @@ func main() {
 	logger := setupLogger()
 	defer logger.Sync()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(logger, os.Args[2:])
+		return
+	}
+
 	e := setupEcho()
-	db := setupDatabase(e)
-	setupRoutes(e, setupHandlers(db, logger), logger)
+	keys := setupKeyring(logger)
+	db := setupDatabase(logger)
+	l := setupLogic(db, keys, setupMailer(logger), logger)
+	setupRoutes(e, handlers.New(l, logger), customMiddleware.UserAuthMiddleware(keys, l.Revocations, logger),
+		customMiddleware.IdempotencyMiddleware(idempotency.NewMemoryStore(constant.IdempotencyKeyTTL), logger))
 
 	startHTTPServer(e)
 
@@ -48,7 +64,7 @@ func main() {
 func setupLogger() *zap.Logger {
 	var logger *zap.Logger
 	var err error
-	if cmp.Or(os.Getenv("LOG_ENV"), "development") == "development" {
+	if isDevelopment() {
 		logger, err = zap.NewDevelopment()
 	} else {
 		logger, err = zap.NewProduction()
@@ -58,31 +74,174 @@ func setupLogger() *zap.Logger {
 	}
 	return logger
 }
+
+// isDevelopment reports whether the application runs locally, it is the default when LOG_ENV is not set
+func isDevelopment() bool {
+	return cmp.Or(os.Getenv("LOG_ENV"), "development") == "development"
+}
+
+// setupKeyring loads the JWT keys, a missing key directory only falls back to an ephemeral key when it is explicitly allowed
+func setupKeyring(logger *zap.Logger) *keyring.Keyring {
+	dir := os.Getenv(constant.JWT_CONFIG_KEYS_DIR_KEY)
+	if dir == "" {
+		if os.Getenv(constant.JWT_CONFIG_EPHEMERAL_KEY_KEY) != "TRUE" {
+			logger.Fatal("No JWT signing key configured", zap.String("env", constant.JWT_CONFIG_KEYS_DIR_KEY), zap.String("ephemeralEnv", constant.JWT_CONFIG_EPHEMERAL_KEY_KEY))
+		}
+		logger.Warn("No JWT signing key configured, tokens are signed with an ephemeral key and do not survive a restart")
+		keys, err := keyring.NewEphemeral()
+		if err != nil {
+			logger.Fatal("Failed to generate ephemeral JWT key", zap.Error(err))
+		}
+		return keys
+	}
+
+	keys, err := keyring.LoadDir(dir, os.Getenv(constant.JWT_CONFIG_SIGNING_KEY_ID_KEY))
+	if err != nil {
+		logger.Fatal("Failed to load JWT keys", zap.String("dir", dir), zap.Error(err))
+	}
+	return keys
+}
+
+// setupMailer creates the mailer that delivers the emails of the application, it has to be chosen explicitly.
+// The log and file mailers keep the emails with their reset and verification links on the server so they are refused outside of development
+func setupMailer(logger *zap.Logger) mailer.Mailer {
+	name := os.Getenv(constant.MAILER_CONFIG_KEY)
+	if (name == constant.MailerLog || name == constant.MailerFile) && !isDevelopment() {
+		logger.Fatal("The mailer does not deliver emails and is only allowed in development", zap.String("mailer", name))
+	}
+	switch name {
+	case constant.MailerSMTP:
+		m, err := mailer.NewSMTPMailer(os.Getenv(constant.MAILER_CONFIG_SMTP_ADDR_KEY), os.Getenv(constant.MAILER_CONFIG_FROM_KEY),
+			os.Getenv(constant.MAILER_CONFIG_SMTP_USERNAME_KEY), os.Getenv(constant.MAILER_CONFIG_SMTP_PASSWORD_KEY))
+		if err != nil {
+			logger.Fatal("Failed to create smtp mailer", zap.Error(err))
+		}
+		return m
+	case constant.MailerFile:
+		m, err := mailer.NewFileMailer(cmp.Or(os.Getenv(constant.MAILER_CONFIG_DIR_KEY), constant.MAILER_DEFAULT_DIR_VALUE))
+		if err != nil {
+			logger.Fatal("Failed to create file mailer", zap.Error(err))
+		}
+		return m
+	case constant.MailerLog:
+		return mailer.NewLogMailer(logger)
+	case "":
+		logger.Fatal("No mailer configured", zap.String("env", constant.MAILER_CONFIG_KEY))
+		return nil
+	default:
+		logger.Fatal("Unknown mailer", zap.String("mailer", name))
+		return nil
+	}
+}
 func setupEcho() *echo.Echo {
 	e := echo.New()
 	v := validator.New()
 	v.RegisterValidation("gender", genderValidation)
+	v.RegisterValidation("password", passwordValidation)
+	v.RegisterValidation("adult", adultValidation)
 
 	e.Validator = &Validator{validator: v}
+	// the client IP throttles the logins, proxy headers can be forged so they are only read behind a trusted proxy
+	if os.Getenv(constant.APP_CONFIG_TRUST_PROXY_KEY) == "TRUE" {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
 	e.Use(middleware.Logger(), middleware.Recover(), middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{"*"},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete},
+		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, constant.IdempotencyKeyHeader, http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete},
 	}))
 
 	return e
 }
-func setupDatabase(e *echo.Echo) *gorm.DB {
 
+// setupDatabase connects to the database and applies the pending migrations unless they are disabled
+func setupDatabase(logger *zap.Logger) *gorm.DB {
+	db := openDatabase(logger)
+	if cmp.Or(os.Getenv(constant.MIGRATION_CONFIG_ENABLED_KEY), os.Getenv(constant.MIGRATION_CONFIG_LEGACY_ENABLED_KEY), "TRUE") == "TRUE" {
+		applied, err := setupMigrator(db, logger).Up(context.Background())
+		if err != nil {
+			logger.Fatal("Error migrating database", zap.Error(err))
+		}
+		for _, migration := range applied {
+			logger.Info("Applied migration", zap.Int64("version", migration.Version), zap.String("name", migration.Name))
+		}
+	}
+	return db
+}
+
+func openDatabase(logger *zap.Logger) *gorm.DB {
 	db, err := gorm.Open(postgres.Open(concatConnectionString()), &gorm.Config{})
 	if err != nil {
-		e.Logger.Fatal("Error connecting to database: ", err)
+		logger.Fatal("Error connecting to database", zap.Error(err))
+	}
+	return db
+}
+
+func setupMigrator(db *gorm.DB, logger *zap.Logger) *migrate.Migrator {
+	sqlDB, err := db.DB()
+	if err != nil {
+		logger.Fatal("Error getting database connection", zap.Error(err))
+	}
+	migrator, err := migrate.New(sqlDB, repository.Migrations())
+	if err != nil {
+		logger.Fatal("Error loading migrations", zap.Error(err))
+	}
+	return migrator
+}
+
+// runMigrate runs the migrate command, up applies the pending migrations, down reverts the given number of
+// migrations (one by default) and status lists every migration with the time it was applied
+func runMigrate(logger *zap.Logger, args []string) {
+	if len(args) == 0 {
+		logger.Fatal("Usage: migrate up|down [steps]|status")
 	}
-	if cmp.Or(os.Getenv("MIGRATION_ENBABLED"), "TRUE") == "TRUE" {
-		if err := db.AutoMigrate(&repository.User{}, &repository.Match{}, &repository.Swipe{}); err != nil {
-			e.Logger.Fatal("Error auto-migrating database: ", err)
+	migrator := setupMigrator(openDatabase(logger), logger)
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			logger.Fatal("Error applying migrations", zap.Error(err))
+		}
+		for _, migration := range applied {
+			fmt.Printf("applied %d_%s\n", migration.Version, migration.Name)
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				logger.Fatal("The steps of migrate down must be a positive number", zap.String("steps", args[1]))
+			}
+			steps = n
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			logger.Fatal("Error reverting migrations", zap.Error(err))
+		}
+		for _, migration := range reverted {
+			fmt.Printf("reverted %d_%s\n", migration.Version, migration.Name)
 		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			logger.Fatal("Error reading migration status", zap.Error(err))
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		w.Flush()
+	default:
+		logger.Fatal("Unknown migrate command, expected up, down or status", zap.String("command", args[0]))
 	}
-	return db
 }
 
 func concatConnectionString() string {
@@ -92,19 +251,45 @@ func concatConnectionString() string {
 		cmp.Or(os.Getenv("DB_PASS"), "password"),
 		cmp.Or(os.Getenv("DB_NAME"), "datingapp"), cmp.Or(os.Getenv("DB_PORT"), "5432"))
 }
-func setupHandlers(db *gorm.DB, logger *zap.Logger) *handlers.Handler {
+func setupLogic(db *gorm.DB, keys *keyring.Keyring, m mailer.Mailer, logger *zap.Logger) *logic.Logic {
 	userRepository := repository.New(db)
-	userLogic := logic.New(userRepository, logger)
-	return handlers.New(userLogic, logger)
+	return logic.New(userRepository, keys, m, logger)
 }
-func setupRoutes(e *echo.Echo, handler *handlers.Handler, logger *zap.Logger) {
-	// e.POST("api/v1/user", handler.UserHandler.RegisterUser)
+func setupRoutes(e *echo.Echo, handler *handlers.Handler, auth, idempotent echo.MiddlewareFunc) {
+	e.POST("/api/v1/users", handler.UserHandler.RegisterUser)
 	// Path of the routs are defined based on the problem statement
 	e.POST("/user/create", handler.UserHandler.CreateFakeUser)
+	e.GET("/verify-email", handler.UserHandler.VerifyEmail)
+	e.POST("/verify-email/resend", handler.UserHandler.ResendVerification)
 	e.POST("/login", handler.AuthHandler.Login)
+	e.POST("/login/mfa", handler.AuthHandler.LoginMFA)
+	e.POST("/mfa/totp/enroll", handler.AuthHandler.EnrollTOTP, auth)
+	e.POST("/mfa/totp/confirm", handler.AuthHandler.ConfirmTOTP, auth)
+	e.POST("/token/refresh", handler.AuthHandler.RefreshToken)
+	e.POST("/logout", handler.AuthHandler.Logout, auth)
+	e.POST("/logout/all", handler.AuthHandler.LogoutAll, auth)
+	e.GET("/.well-known/jwks.json", handler.AuthHandler.JWKS)
+	e.POST("/password/forgot", handler.PasswordHandler.ForgotPassword)
+	e.POST("/password/reset", handler.PasswordHandler.ResetPassword)
+
+	e.GET("/me", handler.ProfileHandler.GetMe, auth)
+	e.PATCH("/me", handler.ProfileHandler.UpdateMe, auth)
+	e.GET("/me/preferences", handler.ProfileHandler.GetPreferences, auth)
+	e.PUT("/me/preferences", handler.ProfileHandler.UpdatePreferences, auth)
+	e.GET("/users/:id", handler.ProfileHandler.GetUser, auth)
 
-	e.POST("/swipe", handler.SwapHadnler.Swipe, customMiddleware.UserAuthMiddleware(logger))
-	e.GET("/discover", handler.MatchHandler.DiscoverMatches, customMiddleware.UserAuthMiddleware(logger))
+	e.POST("/swipe", handler.SwapHadnler.Swipe, auth, idempotent)
+	e.GET("/discover", handler.MatchHandler.DiscoverMatches, auth)
+	e.GET("/matches", handler.MatchHandler.ListMatches, auth)
+	e.DELETE("/matches/:id", handler.MatchHandler.Unmatch, auth)
+	e.POST("/matches/:id/messages", handler.MessageHandler.SendMessage, auth, idempotent)
+	e.GET("/matches/:id/messages", handler.MessageHandler.ListMessages, auth)
+	e.POST("/matches/:id/read", handler.MessageHandler.MarkRead, auth)
+	e.GET("/blocks", handler.BlockHandler.ListBlocks, auth)
+	e.POST("/blocks/:userId", handler.BlockHandler.Block, auth)
+	e.DELETE("/blocks/:userId", handler.BlockHandler.Unblock, auth)
+	e.GET("/ws", handler.NotificationHandler.WebSocket, customMiddleware.QueryTokenMiddleware(constant.AccessTokenQueryParam), auth)
+	e.GET("/events", handler.NotificationHandler.Events, customMiddleware.QueryTokenMiddleware(constant.AccessTokenQueryParam), auth)
 
 }
 func startHTTPServer(e *echo.Echo) {
@@ -128,3 +313,32 @@ func genderValidation(fl validator.FieldLevel) bool {
 	gender := fl.Field().String()
 	return gender == string(constant.UserGenderMale) || gender == string(constant.UserGenderFemale)
 }
+
+// passwordValidation requires at least one lower case letter, one upper case letter, one digit and the minimum length
+func passwordValidation(fl validator.FieldLevel) bool {
+	password := fl.Field().String()
+	if len(password) < constant.MinPasswordLength {
+		return false
+	}
+	var hasLower, hasUpper, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	return hasLower && hasUpper && hasDigit
+}
+
+// adultValidation checks that the date of birth is well formed and the user has reached the minimum age
+func adultValidation(fl validator.FieldLevel) bool {
+	dob, err := time.Parse(constant.DateOfBirthLayout, fl.Field().String())
+	if err != nil {
+		return false
+	}
+	return utils.CalculateAge(dob) >= constant.MinimumUserAge
+}
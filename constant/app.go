@@ -0,0 +1,30 @@
+package constant
+
+import "time"
+
+const (
+	APP_CONFIG_BASE_URL_KEY    = "APP_BASE_URL"          // is the key to get the public URL of the application used in the links of emails
+	APP_DEFAULT_BASE_URL       = "http://localhost:8080" // is the default public URL of the application for local runs
+	APP_CONFIG_TRUST_PROXY_KEY = "TRUST_PROXY_HEADERS"   // is the key to allow reading the client IP from the X-Forwarded-For header of a trusted proxy
+
+	MIGRATION_CONFIG_ENABLED_KEY        = "MIGRATION_ENABLED"  // is the key to apply the pending migrations at startup
+	MIGRATION_CONFIG_LEGACY_ENABLED_KEY = "MIGRATION_ENBABLED" // is the misspelled key of earlier versions, it is read when the key above is not set
+
+	SWIPE_CONFIG_CONFLICT_MODE_KEY = "SWIPE_CONFLICT_MODE" // is the key to get how a second swipe on the same user is handled, upsert or reject
+
+	IdempotencyKeyHeader     = "Idempotency-Key"     // is the header that clients set so the retries of a request return the response of the first one
+	IdempotentReplayedHeader = "Idempotent-Replayed" // is set on the responses that are replayed for an idempotency key
+	MaxIdempotencyKeyLength  = 255                   // is the longest idempotency key accepted
+	IdempotencyKeyTTL        = 24 * time.Hour        // is how long the response of an idempotency key is replayed
+
+	MAILER_CONFIG_KEY               = "MAILER"        // is the key to get the mailer implementation from the environment
+	MAILER_CONFIG_DIR_KEY           = "MAILER_DIR"    // is the key to get the directory the file mailer writes to
+	MAILER_DEFAULT_DIR_VALUE        = "mails"         // is the default directory of the file mailer
+	MAILER_CONFIG_FROM_KEY          = "MAILER_FROM"   // is the key to get the sender address of the emails
+	MAILER_CONFIG_SMTP_ADDR_KEY     = "SMTP_ADDR"     // is the key to get the host:port of the SMTP server
+	MAILER_CONFIG_SMTP_USERNAME_KEY = "SMTP_USERNAME" // is the key to get the user of the SMTP server, no authentication without it
+	MAILER_CONFIG_SMTP_PASSWORD_KEY = "SMTP_PASSWORD" // is the key to get the password of the SMTP server
+	MailerSMTP                      = "smtp"          // delivers the emails through an SMTP server
+	MailerLog                       = "log"           // writes the recipient and the subject of the emails to the application log, development only
+	MailerFile                      = "file"          // writes every email to a file of the mailer directory, development only
+)
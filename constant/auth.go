@@ -1,12 +1,76 @@
 package constant
 
 import (
+	"errors"
 	"time"
 )
 
 const (
-	JWT_CONFIG_SECRET_KEY      = "JWT_SECRET_KEY" // is the key to get the secret key from the environment
-	JWT_DEFAULT_SECRET_VALUE   = "secret_key"     // is the default value of the secret key that uses for test and local
-	JWT_CONFIG_DURATION_KEY    = "JWT_DURATION"   // is the key to get the duration from the environment
-	JWT_DEFAULT_DURATION_VALUE = 72 * time.Hour   // is the default value of the duration that uses for test and local
+	JWT_CONFIG_KEYS_DIR_KEY            = "JWT_KEYS_DIR"         // is the key to get the directory of the PEM signing and verification keys from the environment
+	JWT_CONFIG_SIGNING_KEY_ID_KEY      = "JWT_SIGNING_KEY_ID"   // is the key to get the kid of the active signing key from the environment
+	JWT_CONFIG_EPHEMERAL_KEY_KEY       = "JWT_EPHEMERAL_KEY"    // is the key to allow signing the tokens with a key generated at startup when no key directory is set
+	JWT_CONFIG_DURATION_KEY            = "JWT_DURATION"         // is the key to get the duration from the environment
+	JWT_DEFAULT_DURATION_VALUE         = 15 * time.Minute       // is the default value of the duration that uses for test and local
+	JWT_CONFIG_REFRESH_DURATION_KEY    = "JWT_REFRESH_DURATION" // is the key to get the refresh token duration from the environment
+	JWT_DEFAULT_REFRESH_DURATION_VALUE = 30 * 24 * time.Hour    // is the default value of the refresh token duration
+
+	RefreshTokenSize   = 32               // is the number of random bytes of an opaque refresh token
+	TokenIDSize        = 16               // is the number of random bytes of the jti of an access token
+	RevocationCacheTTL = 30 * time.Second // is how long a revocation lookup is trusted before asking the database again
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")               // ErrInvalidRefreshToken is returned when a refresh token is unknown, expired or revoked
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used") // ErrRefreshTokenReused is returned when a rotated refresh token is presented again
+)
+
+const (
+	PasswordResetTokenSize = 32        // is the number of random bytes of a password reset token
+	PasswordResetTTL       = time.Hour // is how long a password reset token can be used
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token") // ErrInvalidResetToken is returned when a password reset token is unknown, used or expired
+
+const (
+	EmailVerificationTokenSize = 32             // is the number of random bytes of an email verification token
+	EmailVerificationTTL       = 24 * time.Hour // is how long an email verification token can be used
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token") // ErrInvalidVerificationToken is returned when an email verification token is unknown, used or expired
+	ErrEmailNotVerified         = errors.New("email is not verified")                 // ErrEmailNotVerified is returned when an unverified user tries an action that requires a verified email
+	ErrTargetNotVerified        = errors.New("target user is not available")          // ErrTargetNotVerified is returned when the target of a swipe has not verified their email
+)
+
+const (
+	TOTPIssuer        = "Dating App"    // is the issuer shown by authenticator apps next to the account
+	TOTPSkew          = 1               // is the number of time steps before and after the current one in which a code is accepted
+	MFATokenTTL       = 5 * time.Minute // is how long the token of a password login can be exchanged for a session with a second factor
+	RecoveryCodeCount = 10              // is the number of recovery codes generated when TOTP is enabled
+	RecoveryCodeSize  = 10              // is the number of characters of a recovery code
+)
+
+var (
+	ErrInvalidMFAToken   = errors.New("invalid or expired mfa token")                     // ErrInvalidMFAToken is returned when the token of the second login step is invalid, expired or already used
+	ErrInvalidMFACode    = errors.New("invalid authentication code")                      // ErrInvalidMFACode is returned when a TOTP or recovery code is wrong or already used
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication already enabled")        // ErrMFAAlreadyEnabled is returned when a user with a confirmed TOTP credential starts a new enrollment
+	ErrMFANotEnrolled    = errors.New("two-factor authentication enrollment not started") // ErrMFANotEnrolled is returned when a user confirms TOTP without a pending enrollment
 )
+
+const (
+	LoginAccountFreeAttempts    = 3                // is the number of failed logins of an email allowed before the backoff starts
+	LoginAccountMaxAttempts     = 10               // is the number of failed logins that locks an email out
+	LoginAccountLockoutDuration = 15 * time.Minute // is how long an email stays locked out
+	LoginClientFreeAttempts     = 20               // is the number of failed logins of a client IP allowed before the backoff starts
+	LoginClientMaxAttempts      = 100              // is the number of failed logins that locks a client IP out
+	LoginClientLockoutDuration  = time.Hour        // is how long a client IP stays locked out
+	LoginBackoffBaseDelay       = time.Second      // is the first backoff delay, it doubles on every failed login
+	LoginBackoffMaxDelay        = time.Minute      // caps the backoff delay between two logins
+	LoginAttemptsResetAfter     = time.Hour        // forgets the failed logins of an email or a client IP not tried for this long
+
+	LockoutScopeAccount = "account" // is the scope of a lockout of the password login of an email
+	LockoutScopeClient  = "client"  // is the scope of a lockout of a client IP
+	LockoutScopeMFA     = "mfa"     // is the scope of a lockout of the second login step of a user
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials") // ErrInvalidCredentials is returned when the email is unknown or the password is wrong
@@ -0,0 +1,30 @@
+package constant
+
+import "time"
+
+type EventType string
+
+// EventMatchCreated, EventMessageCreated, EventMessageDelivered, EventMessageRead, EventLikeReceived and EventTyping are the events
+// delivered to the connected devices of a user, EventResync tells a device that resumed too late to reload its matches and messages. EventPing is the heartbeat
+// of a connection that the client answers with EventPong
+const (
+	EventMatchCreated     EventType = "match.created"
+	EventMessageCreated   EventType = "message.created"
+	EventMessageDelivered EventType = "message.delivered"
+	EventMessageRead      EventType = "message.read"
+	EventLikeReceived     EventType = "like.received"
+	EventTyping           EventType = "typing"
+	EventResync           EventType = "resync"
+	EventPing             EventType = "ping"
+	EventPong             EventType = "pong"
+)
+
+const (
+	EventBufferSize        = 64               // is the number of events buffered for a connected device, a device that falls further behind is disconnected
+	EventLogSize           = 100              // is the number of the latest events of a user kept for the devices that resume
+	EventLogRetention      = 10 * time.Minute // is how long the events of a user are kept after the latest one
+	EventHeartbeatInterval = 30 * time.Second // is how often a connection is pinged, a WebSocket silent for two intervals is closed
+	EventWriteTimeout      = 10 * time.Second // is how long writing an event to a connection may take
+	AccessTokenQueryParam  = "access_token"   // is the query parameter that carries the access token of the connections browsers cannot set headers on
+	LastEventIDHeader      = "Last-Event-ID"  // is the header of the event stream that carries the id of the last event the device received
+)
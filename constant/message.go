@@ -0,0 +1,14 @@
+package constant
+
+import "errors"
+
+const (
+	MaxMessageLength     = 2000 // is the longest message in characters
+	DefaultMessagesLimit = 30   // is the page size of a conversation when the client does not set one
+	MaxMessagesLimit     = 100  // is the largest page size of a conversation
+)
+
+var (
+	ErrMatchUnmatched = errors.New("match has been unmatched") // ErrMatchUnmatched is returned for the messages of a match that has been unmatched
+	ErrEmptyMessage   = errors.New("message is empty")         // ErrEmptyMessage is returned for a message without any text
+)
@@ -10,6 +10,60 @@ const (
 	UserGenderFemale UserGender = "FEMALE"
 
 	DefaultDiscoveryDistance = 5000
+	DefaultPreferredMaxAge   = 100 // is the oldest age discovered when the user has not chosen an age range
+	DefaultDiscoveryLimit    = 20  // is the page size of the discovery when the client does not set one
+	MaxDiscoveryLimit        = 50  // is the largest page size of the discovery
+	DefaultMatchesLimit      = 20  // is the page size of the match list when the client does not set one
+	MaxMatchesLimit          = 50  // is the largest page size of the match list
+
+	MinimumUserAge    = 18           // is the minimum age a user must have to register
+	MinPasswordLength = 8            // is the minimum length of a user's password
+	DateOfBirthLayout = "2006-01-02" // is the layout that clients use to send the date of birth
+)
+
+type DiscoverySort string
+
+// DiscoverySortDistance, DiscoverySortNewest, DiscoverySortRecentlyActive and DiscoverySortRelevance are the orders of the discovery,
+// relevance ranks the candidates that share more interests with the user first and the closer ones first among them
+const (
+	DiscoverySortDistance       DiscoverySort = "distance"
+	DiscoverySortNewest         DiscoverySort = "newest"
+	DiscoverySortRecentlyActive DiscoverySort = "recently_active"
+	DiscoverySortRelevance      DiscoverySort = "relevance"
+)
+
+type SwipeConflictMode string
+
+// SwipeConflictUpsert lets the latest swipe on a user replace the previous one, SwipeConflictReject refuses a second swipe on the same user
+const (
+	SwipeConflictUpsert SwipeConflictMode = "upsert"
+	SwipeConflictReject SwipeConflictMode = "reject"
 )
 
-var ErrEmailInUse = errors.New("email already in use") // ErrEmailInUse is the error message when the email is already in use
+type UnmatchReason string
+
+// UnmatchReasonNotInterested, UnmatchReasonInappropriate, UnmatchReasonSpam and UnmatchReasonOther are the reasons a user can give for undoing a match
+const (
+	UnmatchReasonNotInterested UnmatchReason = "not_interested"
+	UnmatchReasonInappropriate UnmatchReason = "inappropriate"
+	UnmatchReasonSpam          UnmatchReason = "spam"
+	UnmatchReasonOther         UnmatchReason = "other"
+)
+
+// UnmatchReasonBlocked is recorded for the matches undone by a block, users cannot give it as their reason
+const UnmatchReasonBlocked UnmatchReason = "blocked"
+
+var (
+	ErrEmailInUse    = errors.New("email already in use")        // ErrEmailInUse is the error message when the email is already in use
+	ErrUserNotFound  = errors.New("user not found")              // ErrUserNotFound is returned for unknown users and for users that are not visible yet
+	ErrInvalidCursor = errors.New("invalid cursor")              // ErrInvalidCursor is returned when a page cursor cannot be decoded
+	ErrSwipeConflict = errors.New("already swiped on this user") // ErrSwipeConflict is returned for a second swipe on the same user when swipes cannot be changed
+
+	ErrSelfSwipe      = errors.New("cannot swipe on yourself")           // ErrSelfSwipe is returned when a user swipes on their own profile
+	ErrTargetNotFound = errors.New("target user not found")              // ErrTargetNotFound is returned when the target of a swipe does not exist or has been deleted
+	ErrTargetBlocked  = errors.New("target user does not accept swipes") // ErrTargetBlocked is returned when the target of a swipe cannot be swiped by the user
+	ErrMatchNotFound  = errors.New("match not found")                    // ErrMatchNotFound is returned for unknown and unmatched matches and for the matches of other users
+
+	ErrSelfBlock     = errors.New("cannot block yourself") // ErrSelfBlock is returned when a user blocks themselves
+	ErrBlockNotFound = errors.New("block not found")       // ErrBlockNotFound is returned when the user has not blocked the other user
+)
@@ -1,10 +1,16 @@
 package auth
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
+	"github.com/a-berahman/dating-app/constant"
 	"github.com/a-berahman/dating-app/internal/logic"
+	"github.com/a-berahman/dating-app/internal/model"
 	"github.com/a-berahman/dating-app/pkg/decode"
+	"github.com/a-berahman/dating-app/pkg/lockout"
 	"github.com/a-berahman/dating-app/pkg/utils"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
@@ -35,12 +41,187 @@ func (ah *AuthHandler) Login(c echo.Context) error {
 		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
 	}
 
-	token, err := ah.authLogic.GenerateToken(c.Request().Context(), req.Email, req.Password)
+	tokens, err := ah.authLogic.GenerateToken(c.Request().Context(), req.Email, req.Password, c.RealIP())
 	if err != nil {
-		ah.logger.Error("Invalid credentials", zap.String("email", req.Email), zap.Error(err))
-		return utils.ErrorResponse(c, http.StatusUnauthorized, "invalid credentials")
+		if locked := lockedError(err); locked != nil {
+			return tooManyAttempts(c, locked)
+		}
+		if errors.Is(err, constant.ErrInvalidCredentials) {
+			ah.logger.Debug("Invalid credentials")
+			return utils.ErrorResponse(c, http.StatusUnauthorized, "invalid credentials")
+		}
+		ah.logger.Error("Failed to login", zap.Error(err))
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to login")
 	}
 
-	ah.logger.Info("User logged in", zap.String("email", req.Email))
-	return c.JSON(http.StatusOK, echo.Map{"token": token})
+	if tokens.MFAToken != "" {
+		return c.JSON(http.StatusOK, MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    tokens.MFAToken,
+			ExpiresAt:   tokens.ExpiresAt,
+		})
+	}
+
+	ah.logger.Info("User logged in")
+	return c.JSON(http.StatusOK, formatTokenResponse(tokens))
+}
+
+// LoginMFA completes the login of a user with two-factor authentication
+func (ah *AuthHandler) LoginMFA(c echo.Context) error {
+	var req MFALoginRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	tokens, err := ah.authLogic.VerifyMFA(c.Request().Context(), req.MFAToken, req.Code, c.RealIP())
+	if err != nil {
+		if locked := lockedError(err); locked != nil {
+			return tooManyAttempts(c, locked)
+		}
+		if errors.Is(err, constant.ErrInvalidMFAToken) || errors.Is(err, constant.ErrInvalidMFACode) {
+			ah.logger.Debug("Second factor rejected", zap.Error(err))
+			return utils.ErrorResponse(c, http.StatusUnauthorized, err.Error())
+		}
+		ah.logger.Error("Failed to verify second factor", zap.Error(err))
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to login")
+	}
+
+	return c.JSON(http.StatusOK, formatTokenResponse(tokens))
+}
+
+// EnrollTOTP starts the TOTP enrollment of the user and returns the secret to add to an authenticator app
+func (ah *AuthHandler) EnrollTOTP(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	if userID == 0 {
+		ah.logger.Debug("Unauthorized totp enrollment attempt")
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	enrollment, err := ah.authLogic.EnrollTOTP(c.Request().Context(), userID)
+	if err != nil {
+		if errors.Is(err, constant.ErrMFAAlreadyEnabled) {
+			return utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		}
+		ah.logger.Error("Failed to enroll totp", zap.Error(err))
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to enroll two-factor authentication")
+	}
+
+	return c.JSON(http.StatusOK, TOTPEnrollResponse{Secret: enrollment.Secret, URI: enrollment.URI})
+}
+
+// ConfirmTOTP enables two-factor authentication with a code of the authenticator app and returns the recovery codes
+func (ah *AuthHandler) ConfirmTOTP(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	if userID == 0 {
+		ah.logger.Debug("Unauthorized totp confirmation attempt")
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	var req TOTPConfirmRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	recoveryCodes, err := ah.authLogic.ConfirmTOTP(c.Request().Context(), userID, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, constant.ErrInvalidMFACode), errors.Is(err, constant.ErrMFANotEnrolled):
+			return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		case errors.Is(err, constant.ErrMFAAlreadyEnabled):
+			return utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		}
+		ah.logger.Error("Failed to confirm totp", zap.Error(err))
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to enable two-factor authentication")
+	}
+
+	return c.JSON(http.StatusOK, TOTPConfirmResponse{RecoveryCodes: recoveryCodes})
+}
+
+// RefreshToken rotates the refresh token and issues a new access token
+func (ah *AuthHandler) RefreshToken(c echo.Context) error {
+	var req RefreshRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	tokens, err := ah.authLogic.RefreshToken(c.Request().Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, constant.ErrInvalidRefreshToken) || errors.Is(err, constant.ErrRefreshTokenReused) {
+			ah.logger.Debug("Refresh token rejected", zap.Error(err))
+			return utils.ErrorResponse(c, http.StatusUnauthorized, err.Error())
+		}
+		ah.logger.Error("Failed to refresh token", zap.Error(err))
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to refresh token")
+	}
+
+	return c.JSON(http.StatusOK, formatTokenResponse(tokens))
+}
+
+// Logout revokes the token of the request and the session's refresh tokens
+func (ah *AuthHandler) Logout(c echo.Context) error {
+	claims := utils.GetClaimsFromContext(c)
+	if claims == nil {
+		ah.logger.Debug("Unauthorized logout attempt")
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	var req LogoutRequest
+	if c.Request().ContentLength > 0 {
+		if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+	}
+
+	if err := ah.authLogic.Logout(c.Request().Context(), claims, req.RefreshToken); err != nil {
+		ah.logger.Error("Failed to logout", zap.Error(err))
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to logout")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// LogoutAll invalidates every session of the user
+func (ah *AuthHandler) LogoutAll(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	if userID == 0 {
+		ah.logger.Debug("Unauthorized logout attempt")
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	if err := ah.authLogic.LogoutAll(c.Request().Context(), userID); err != nil {
+		ah.logger.Error("Failed to logout all sessions", zap.Error(err))
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to logout")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// JWKS serves the public keys that verify the access tokens
+func (ah *AuthHandler) JWKS(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(http.StatusOK, ah.authLogic.PublicKeys())
+}
+
+// lockedError returns the lockout error wrapped in err or nil
+func lockedError(err error) *lockout.LockedError {
+	var locked *lockout.LockedError
+	if errors.As(err, &locked) {
+		return locked
+	}
+	return nil
+}
+
+// tooManyAttempts answers a throttled login with the number of seconds to wait before the next attempt
+func tooManyAttempts(c echo.Context, locked *lockout.LockedError) error {
+	seconds := int(math.Ceil(locked.RetryAfter.Seconds()))
+	c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(seconds))
+	return utils.ErrorResponse(c, http.StatusTooManyRequests, "too many login attempts, try again later")
+}
+
+func formatTokenResponse(tokens *model.TokenPair) TokenResponse {
+	return TokenResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
+	}
 }
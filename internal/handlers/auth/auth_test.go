@@ -7,9 +7,15 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/a-berahman/dating-app/constant"
 	"github.com/a-berahman/dating-app/internal/logic"
+	"github.com/a-berahman/dating-app/internal/model"
+	"github.com/a-berahman/dating-app/pkg/keyring"
+	"github.com/a-berahman/dating-app/pkg/lockout"
 	"github.com/go-playground/validator"
 	"go.uber.org/zap"
 
@@ -18,12 +24,46 @@ import (
 )
 
 type MockAuthLogic struct {
-	Token string
-	Err   error
+	Tokens *model.TokenPair
+	Err    error
 }
 
-func (m *MockAuthLogic) GenerateToken(ctx context.Context, email, password string) (string, error) {
-	return m.Token, m.Err
+func (m *MockAuthLogic) GenerateToken(ctx context.Context, email, password, clientIP string) (*model.TokenPair, error) {
+	return m.Tokens, m.Err
+}
+
+func (m *MockAuthLogic) VerifyMFA(ctx context.Context, mfaToken, code, clientIP string) (*model.TokenPair, error) {
+	return m.Tokens, m.Err
+}
+
+func (m *MockAuthLogic) EnrollTOTP(ctx context.Context, userID uint) (*model.TOTPEnrollment, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return &model.TOTPEnrollment{Secret: "SECRET", URI: "otpauth://totp/Dating%20App:jane@example.com?secret=SECRET"}, nil
+}
+
+func (m *MockAuthLogic) ConfirmTOTP(ctx context.Context, userID uint, code string) ([]string, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return []string{"abcde-fghjk"}, nil
+}
+
+func (m *MockAuthLogic) RefreshToken(ctx context.Context, refreshToken string) (*model.TokenPair, error) {
+	return m.Tokens, m.Err
+}
+
+func (m *MockAuthLogic) Logout(ctx context.Context, claims *model.Claims, refreshToken string) error {
+	return m.Err
+}
+
+func (m *MockAuthLogic) LogoutAll(ctx context.Context, userID uint) error {
+	return m.Err
+}
+
+func (m *MockAuthLogic) PublicKeys() keyring.JWKSet {
+	return keyring.JWKSet{Keys: []keyring.JWK{{Kty: "OKP", Kid: "key-1", Use: "sig", Alg: "EdDSA", Crv: "Ed25519", X: "x"}}}
 }
 
 func TestAuthHandler_Login(t *testing.T) {
@@ -46,8 +86,8 @@ func TestAuthHandler_Login(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			expectToken:    true,
 			setupMock: &MockAuthLogic{
-				Token: "token",
-				Err:   nil,
+				Tokens: &model.TokenPair{AccessToken: "token", RefreshToken: "refresh"},
+				Err:    nil,
 			},
 		},
 		{
@@ -59,8 +99,44 @@ func TestAuthHandler_Login(t *testing.T) {
 			expectedStatus: http.StatusUnauthorized,
 			expectToken:    false,
 			setupMock: &MockAuthLogic{
-				Token: "",
-				Err:   errors.New("invalid credentials"),
+				Tokens: nil,
+				Err:    constant.ErrInvalidCredentials,
+			},
+		},
+		{
+			name: "Too Many Attempts",
+			requestBody: map[string]string{
+				"email":    "user@example.com",
+				"password": "wrongpassword",
+			},
+			expectedStatus: http.StatusTooManyRequests,
+			expectToken:    false,
+			setupMock: &MockAuthLogic{
+				Err: &lockout.LockedError{RetryAfter: 1500 * time.Millisecond},
+			},
+		},
+		{
+			name: "Internal Error",
+			requestBody: map[string]string{
+				"email":    "user@example.com",
+				"password": "password123",
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectToken:    false,
+			setupMock: &MockAuthLogic{
+				Err: errors.New("database error"),
+			},
+		},
+		{
+			name: "Second Factor Required",
+			requestBody: map[string]string{
+				"email":    "user@example.com",
+				"password": "password123",
+			},
+			expectedStatus: http.StatusOK,
+			expectToken:    false,
+			setupMock: &MockAuthLogic{
+				Tokens: &model.TokenPair{MFAToken: "mfa-token"},
 			},
 		},
 		{
@@ -85,8 +161,14 @@ func TestAuthHandler_Login(t *testing.T) {
 			handler := New(tc.setupMock, logger)
 			if assert.NoError(t, handler.Login(c)) {
 				assert.Equal(t, tc.expectedStatus, rec.Code)
+				if tc.expectedStatus == http.StatusTooManyRequests {
+					assert.Equal(t, "2", rec.Header().Get(echo.HeaderRetryAfter))
+				}
 				if tc.expectToken {
-					assert.Contains(t, rec.Body.String(), "token")
+					assert.Contains(t, rec.Body.String(), `"token":"token"`)
+					assert.Contains(t, rec.Body.String(), `"refreshToken":"refresh"`)
+				} else {
+					assert.NotContains(t, rec.Body.String(), `"token"`)
 				}
 			}
 
@@ -94,6 +176,261 @@ func TestAuthHandler_Login(t *testing.T) {
 	}
 }
 
+func TestAuthHandler_RefreshToken(t *testing.T) {
+	e := echo.New()
+	e.Validator = &Validator{validator: validator.New()}
+
+	tests := []struct {
+		name           string
+		requestBody    string
+		setupMock      logic.AuthInterface
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Successful Refresh",
+			requestBody:    `{"refreshToken":"refresh"}`,
+			setupMock:      &MockAuthLogic{Tokens: &model.TokenPair{AccessToken: "new-token", RefreshToken: "new-refresh"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"refreshToken":"new-refresh"`,
+		},
+		{
+			name:           "Missing Refresh Token",
+			requestBody:    `{}`,
+			setupMock:      &MockAuthLogic{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `'required' tag`,
+		},
+		{
+			name:           "Reused Refresh Token",
+			requestBody:    `{"refreshToken":"refresh"}`,
+			setupMock:      &MockAuthLogic{Err: constant.ErrRefreshTokenReused},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   constant.ErrRefreshTokenReused.Error(),
+		},
+		{
+			name:           "Internal Error",
+			requestBody:    `{"refreshToken":"refresh"}`,
+			setupMock:      &MockAuthLogic{Err: errors.New("database error")},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `failed to refresh token`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/token/refresh", bytes.NewReader([]byte(tc.requestBody)))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			logger, _ := zap.NewDevelopment()
+			handler := New(tc.setupMock, logger)
+			if assert.NoError(t, handler.RefreshToken(c)) {
+				assert.Equal(t, tc.expectedStatus, rec.Code)
+				assert.Contains(t, rec.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_Logout(t *testing.T) {
+	e := echo.New()
+	e.Validator = &Validator{validator: validator.New()}
+
+	tests := []struct {
+		name           string
+		requestBody    string
+		claims         *model.Claims
+		setupMock      logic.AuthInterface
+		expectedStatus int
+	}{
+		{
+			name:           "Successful Logout",
+			requestBody:    `{"refreshToken":"refresh"}`,
+			claims:         &model.Claims{UserID: 1},
+			setupMock:      &MockAuthLogic{},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Logout Without Body",
+			claims:         &model.Claims{UserID: 1},
+			setupMock:      &MockAuthLogic{},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Unauthenticated",
+			setupMock:      &MockAuthLogic{},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Internal Error",
+			claims:         &model.Claims{UserID: 1},
+			setupMock:      &MockAuthLogic{Err: errors.New("database error")},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/logout", bytes.NewReader([]byte(tc.requestBody)))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if tc.claims != nil {
+				c.Set("userID", tc.claims.UserID)
+				c.Set("claims", tc.claims)
+			}
+			logger, _ := zap.NewDevelopment()
+			handler := New(tc.setupMock, logger)
+			if assert.NoError(t, handler.Logout(c)) {
+				assert.Equal(t, tc.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_JWKS(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	logger, _ := zap.NewDevelopment()
+	handler := New(&MockAuthLogic{}, logger)
+
+	if assert.NoError(t, handler.JWKS(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"keys":[{"kty":"OKP","kid":"key-1","use":"sig","alg":"EdDSA","crv":"Ed25519","x":"x"}]}`, rec.Body.String())
+	}
+}
+
+func TestAuthHandler_LoginMFA(t *testing.T) {
+	e := echo.New()
+	e.Validator = &Validator{validator: validator.New()}
+
+	tests := []struct {
+		name           string
+		requestBody    string
+		setupMock      logic.AuthInterface
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Successful Second Factor",
+			requestBody:    `{"mfaToken":"mfa-token","code":"123456"}`,
+			setupMock:      &MockAuthLogic{Tokens: &model.TokenPair{AccessToken: "token", RefreshToken: "refresh"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"token":"token"`,
+		},
+		{
+			name:           "Missing Code",
+			requestBody:    `{"mfaToken":"mfa-token"}`,
+			setupMock:      &MockAuthLogic{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `'required' tag`,
+		},
+		{
+			name:           "Invalid Code",
+			requestBody:    `{"mfaToken":"mfa-token","code":"000000"}`,
+			setupMock:      &MockAuthLogic{Err: constant.ErrInvalidMFACode},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `invalid authentication code`,
+		},
+		{
+			name:           "Expired MFA Token",
+			requestBody:    `{"mfaToken":"mfa-token","code":"123456"}`,
+			setupMock:      &MockAuthLogic{Err: constant.ErrInvalidMFAToken},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `invalid or expired mfa token`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/login/mfa", strings.NewReader(tc.requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			logger, _ := zap.NewDevelopment()
+			handler := New(tc.setupMock, logger)
+			if assert.NoError(t, handler.LoginMFA(c)) {
+				assert.Equal(t, tc.expectedStatus, rec.Code)
+				assert.Contains(t, rec.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_TOTPEnrollment(t *testing.T) {
+	e := echo.New()
+	e.Validator = &Validator{validator: validator.New()}
+	logger, _ := zap.NewDevelopment()
+
+	tests := []struct {
+		name           string
+		requestBody    string
+		setupMock      logic.AuthInterface
+		confirm        bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Successful Enrollment",
+			setupMock:      &MockAuthLogic{},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"secret":"SECRET"`,
+		},
+		{
+			name:           "Already Enabled",
+			setupMock:      &MockAuthLogic{Err: constant.ErrMFAAlreadyEnabled},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "Successful Confirmation",
+			requestBody:    `{"code":"123456"}`,
+			setupMock:      &MockAuthLogic{},
+			confirm:        true,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"recoveryCodes":["abcde-fghjk"]`,
+		},
+		{
+			name:           "Malformed Code",
+			requestBody:    `{"code":"12ab"}`,
+			setupMock:      &MockAuthLogic{},
+			confirm:        true,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Wrong Code",
+			requestBody:    `{"code":"123456"}`,
+			setupMock:      &MockAuthLogic{Err: constant.ErrInvalidMFACode},
+			confirm:        true,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/mfa/totp/enroll", strings.NewReader(tc.requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("userID", uint(1))
+			handler := New(tc.setupMock, logger)
+
+			var err error
+			if tc.confirm {
+				err = handler.ConfirmTOTP(c)
+			} else {
+				err = handler.EnrollTOTP(c)
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.expectedStatus, rec.Code)
+				assert.Contains(t, rec.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
 type Validator struct {
 	validator *validator.Validate
 }
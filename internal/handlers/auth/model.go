@@ -0,0 +1,50 @@
+package auth
+
+import "time"
+
+// RefreshRequest defines the structure of the request for the token refresh
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+// LogoutRequest defines the structure of the request for the logout, the refresh token is optional
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// TokenResponse defines the structure of the response for the login and the token refresh
+type TokenResponse struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refreshToken"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// MFAChallengeResponse defines the structure of the login response of users with two-factor authentication,
+// the MFA token must be sent with a code to the second login step
+type MFAChallengeResponse struct {
+	MFARequired bool      `json:"mfaRequired"`
+	MFAToken    string    `json:"mfaToken"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// MFALoginRequest defines the structure of the request of the second login step, the code is a TOTP or a recovery code
+type MFALoginRequest struct {
+	MFAToken string `json:"mfaToken" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+// TOTPEnrollResponse defines the structure of the response of the TOTP enrollment
+type TOTPEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// TOTPConfirmRequest defines the structure of the request that confirms the TOTP enrollment
+type TOTPConfirmRequest struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
+
+// TOTPConfirmResponse defines the structure of the response of the TOTP confirmation, the recovery codes are only shown once
+type TOTPConfirmResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
@@ -0,0 +1,94 @@
+package block
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/logic"
+	"github.com/a-berahman/dating-app/pkg/decode"
+	"github.com/a-berahman/dating-app/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+type BlockHandler struct {
+	blockLogic logic.BlockInterface
+	logger     *zap.Logger
+}
+
+func New(blockLogic logic.BlockInterface, logger *zap.Logger) *BlockHandler {
+	return &BlockHandler{
+		blockLogic: blockLogic,
+		logger:     logger,
+	}
+}
+
+// Block blocks a user for the user, the users do not see each other anymore and their match is undone
+func (bh *BlockHandler) Block(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	if userID == 0 {
+		bh.logger.Warn("Unauthorized access attempt", zap.Uint("userID", userID))
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	var req BlockRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	if err := bh.blockLogic.Block(c.Request().Context(), userID, req.UserID); err != nil {
+		switch {
+		case errors.Is(err, constant.ErrSelfBlock):
+			return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		case errors.Is(err, constant.ErrUserNotFound):
+			return utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		}
+		bh.logger.Error("Failed to block user", zap.Error(err))
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "error blocking user")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Unblock removes a block of the user
+func (bh *BlockHandler) Unblock(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	if userID == 0 {
+		bh.logger.Warn("Unauthorized access attempt", zap.Uint("userID", userID))
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	var req BlockRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	if err := bh.blockLogic.Unblock(c.Request().Context(), userID, req.UserID); err != nil {
+		if errors.Is(err, constant.ErrBlockNotFound) {
+			return utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		}
+		bh.logger.Error("Failed to unblock user", zap.Error(err))
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "error unblocking user")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListBlocks lists the users blocked by the user
+func (bh *BlockHandler) ListBlocks(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	if userID == 0 {
+		bh.logger.Warn("Unauthorized access attempt", zap.Uint("userID", userID))
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	blocks, err := bh.blockLogic.ListBlocks(c.Request().Context(), userID)
+	if err != nil {
+		bh.logger.Error("Failed to list blocks", zap.Error(err))
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "error listing blocks")
+	}
+	results := make([]BlockedUser, 0, len(blocks))
+	for _, block := range blocks {
+		results = append(results, BlockedUser{ID: block.UserID, Name: block.Name, BlockedAt: block.BlockedAt})
+	}
+	return c.JSON(http.StatusOK, ListBlocksResponse{Results: results})
+}
@@ -0,0 +1,182 @@
+package block
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/model"
+	"github.com/go-playground/validator"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// MockBlockLogic is a mock type for the BlockLogic interface
+type MockBlockLogic struct {
+	Blocks []model.Block
+	Err    error
+}
+
+func (m *MockBlockLogic) Block(ctx context.Context, userID, blockedUserID uint) error {
+	return m.Err
+}
+
+func (m *MockBlockLogic) Unblock(ctx context.Context, userID, blockedUserID uint) error {
+	return m.Err
+}
+
+func (m *MockBlockLogic) ListBlocks(ctx context.Context, userID uint) ([]model.Block, error) {
+	return m.Blocks, m.Err
+}
+
+func TestBlockHandler(t *testing.T) {
+	e := echo.New()
+	e.Validator = &Validator{validator: validator.New()}
+
+	scenarios := []struct {
+		name           string
+		method         string
+		userID         string
+		setupMock      *MockBlockLogic
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Successful Block",
+			method:         http.MethodPost,
+			userID:         "2",
+			setupMock:      &MockBlockLogic{},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Invalid User ID",
+			method:         http.MethodPost,
+			userID:         "abc",
+			setupMock:      &MockBlockLogic{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Self Block",
+			method:         http.MethodPost,
+			userID:         "1",
+			setupMock:      &MockBlockLogic{Err: constant.ErrSelfBlock},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"cannot block yourself"}`,
+		},
+		{
+			name:           "Unknown User",
+			method:         http.MethodPost,
+			userID:         "3",
+			setupMock:      &MockBlockLogic{Err: constant.ErrUserNotFound},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"user not found"}`,
+		},
+		{
+			name:           "Block Failure",
+			method:         http.MethodPost,
+			userID:         "2",
+			setupMock:      &MockBlockLogic{Err: errors.New("database error")},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"error blocking user"}`,
+		},
+		{
+			name:           "Successful Unblock",
+			method:         http.MethodDelete,
+			userID:         "2",
+			setupMock:      &MockBlockLogic{},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Block Not Found",
+			method:         http.MethodDelete,
+			userID:         "3",
+			setupMock:      &MockBlockLogic{Err: constant.ErrBlockNotFound},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"block not found"}`,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			req := httptest.NewRequest(scenario.method, "/blocks/"+scenario.userID, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("userId")
+			c.SetParamValues(scenario.userID)
+			c.Set("userID", uint(1))
+			logger, _ := zap.NewDevelopment()
+			h := New(scenario.setupMock, logger)
+
+			handle := h.Block
+			if scenario.method == http.MethodDelete {
+				handle = h.Unblock
+			}
+			if assert.NoError(t, handle(c)) {
+				assert.Equal(t, scenario.expectedStatus, rec.Code)
+				if scenario.expectedBody != "" {
+					assert.JSONEq(t, scenario.expectedBody, rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestListBlocksHandler(t *testing.T) {
+	e := echo.New()
+	blockedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	scenarios := []struct {
+		name           string
+		setupMock      *MockBlockLogic
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Successful List",
+			setupMock:      &MockBlockLogic{Blocks: []model.Block{{UserID: 2, Name: "blocked", BlockedAt: blockedAt}}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"results":[{"id":2,"name":"blocked","blockedAt":"2024-05-01T12:00:00Z"}]}`,
+		},
+		{
+			name:           "No Blocks",
+			setupMock:      &MockBlockLogic{},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"results":[]}`,
+		},
+		{
+			name:           "List Failure",
+			setupMock:      &MockBlockLogic{Err: errors.New("database error")},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"error listing blocks"}`,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/blocks", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("userID", uint(1))
+			logger, _ := zap.NewDevelopment()
+			h := New(scenario.setupMock, logger)
+
+			if assert.NoError(t, h.ListBlocks(c)) {
+				assert.Equal(t, scenario.expectedStatus, rec.Code)
+				assert.JSONEq(t, scenario.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+type Validator struct {
+	validator *validator.Validate
+}
+
+func (v *Validator) Validate(i interface{}) error {
+	return v.validator.Struct(i)
+}
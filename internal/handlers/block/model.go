@@ -0,0 +1,20 @@
+package block
+
+import "time"
+
+// BlockRequest represents the request to block or unblock a user
+type BlockRequest struct {
+	UserID uint `param:"userId" validate:"required"`
+}
+
+// BlockedUser represents a user blocked by the user
+type BlockedUser struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	BlockedAt time.Time `json:"blockedAt"`
+}
+
+// ListBlocksResponse represents the users blocked by the user, the latest block first
+type ListBlocksResponse struct {
+	Results []BlockedUser `json:"results"`
+}
@@ -2,7 +2,12 @@ package handlers
 
 import (
 	"github.com/a-berahman/dating-app/internal/handlers/auth"
+	"github.com/a-berahman/dating-app/internal/handlers/block"
 	"github.com/a-berahman/dating-app/internal/handlers/match"
+	"github.com/a-berahman/dating-app/internal/handlers/message"
+	"github.com/a-berahman/dating-app/internal/handlers/notification"
+	"github.com/a-berahman/dating-app/internal/handlers/password"
+	"github.com/a-berahman/dating-app/internal/handlers/profile"
 	"github.com/a-berahman/dating-app/internal/handlers/swipe"
 	"github.com/a-berahman/dating-app/internal/handlers/user"
 	"github.com/a-berahman/dating-app/internal/logic"
@@ -12,29 +17,77 @@ import (
 
 type UserInterface interface {
 	CreateFakeUser(c echo.Context) error
+	RegisterUser(c echo.Context) error
+	VerifyEmail(c echo.Context) error
+	ResendVerification(c echo.Context) error
 }
 type AuthInterface interface {
 	Login(c echo.Context) error
+	LoginMFA(c echo.Context) error
+	EnrollTOTP(c echo.Context) error
+	ConfirmTOTP(c echo.Context) error
+	RefreshToken(c echo.Context) error
+	Logout(c echo.Context) error
+	LogoutAll(c echo.Context) error
+	JWKS(c echo.Context) error
 }
 type MatchInterface interface {
 	DiscoverMatches(c echo.Context) error
+	ListMatches(c echo.Context) error
+	Unmatch(c echo.Context) error
+}
+type MessageInterface interface {
+	SendMessage(c echo.Context) error
+	ListMessages(c echo.Context) error
+	MarkRead(c echo.Context) error
+}
+type NotificationInterface interface {
+	WebSocket(c echo.Context) error
+	Events(c echo.Context) error
 }
 type SwipeInterface interface {
 	Swipe(c echo.Context) error
 }
+type BlockInterface interface {
+	Block(c echo.Context) error
+	Unblock(c echo.Context) error
+	ListBlocks(c echo.Context) error
+}
+type PasswordInterface interface {
+	ForgotPassword(c echo.Context) error
+	ResetPassword(c echo.Context) error
+}
+type ProfileInterface interface {
+	GetMe(c echo.Context) error
+	UpdateMe(c echo.Context) error
+	GetUser(c echo.Context) error
+	GetPreferences(c echo.Context) error
+	UpdatePreferences(c echo.Context) error
+}
 type Handler struct {
-	UserHandler  UserInterface
-	AuthHandler  AuthInterface
-	MatchHandler MatchInterface
-	SwapHadnler  SwipeInterface
+	UserHandler     UserInterface
+	AuthHandler     AuthInterface
+	MatchHandler    MatchInterface
+	SwapHadnler     SwipeInterface
+	PasswordHandler PasswordInterface
+	ProfileHandler  ProfileInterface
+	MessageHandler  MessageInterface
+	BlockHandler    BlockInterface
+	// NotificationHandler keeps the connections of the devices that receive the events of the users
+	NotificationHandler NotificationInterface
 }
 
 // New returns a new Handler
 func New(l *logic.Logic, logger *zap.Logger) *Handler {
 	return &Handler{
-		UserHandler:  user.New(l.UserLogic, logger),
-		AuthHandler:  auth.New(l.AuthLogic, logger),
-		MatchHandler: match.New(l.MatchLogic, logger),
-		SwapHadnler:  swipe.New(l.SwipeLogic, logger),
+		UserHandler:         user.New(l.UserLogic, logger),
+		AuthHandler:         auth.New(l.AuthLogic, logger),
+		MatchHandler:        match.New(l.MatchLogic, logger),
+		SwapHadnler:         swipe.New(l.SwipeLogic, logger),
+		PasswordHandler:     password.New(l.PasswordLogic, logger),
+		ProfileHandler:      profile.New(l.ProfileLogic, logger),
+		MessageHandler:      message.New(l.MessageLogic, logger),
+		BlockHandler:        block.New(l.BlockLogic, logger),
+		NotificationHandler: notification.New(l.Hub, l.MessageLogic, l.Revocations, logger),
 	}
 }
@@ -1,6 +1,8 @@
 package match
 
 import (
+	"errors"
+	"math"
 	"net/http"
 
 	"github.com/a-berahman/dating-app/constant"
@@ -8,7 +10,6 @@ import (
 	"github.com/a-berahman/dating-app/internal/logic/match"
 	"github.com/a-berahman/dating-app/internal/model"
 	"github.com/a-berahman/dating-app/pkg/decode"
-	"github.com/a-berahman/dating-app/pkg/geo"
 	"github.com/a-berahman/dating-app/pkg/utils"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
@@ -38,35 +39,141 @@ func (mh *MatchHandler) DiscoverMatches(c echo.Context) error {
 	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
 		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
 	}
-	if req.Distance < 4000 {
-		req.Distance = constant.DefaultDiscoveryDistance
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "lat and lng must be given together")
+	}
 
+	opts := []match.MatchOption{match.WithAgeRange(req.MinAge, req.MaxAge), match.WithLimit(req.Limit), match.WithCursor(req.Cursor),
+		match.WithSort(constant.DiscoverySort(req.Sort))}
+	if req.Latitude != nil {
+		opts = append(opts, match.WithLocation(*req.Latitude, *req.Longitude))
+	}
+	if req.Distance > 0 {
+		if req.Distance < 4000 {
+			req.Distance = constant.DefaultDiscoveryDistance
+		}
+		opts = append(opts, match.WithDistance(req.Distance))
 	}
-	// req.Latitude, req.Longitude, req.Distance, constant.UserGender(req.Gender), req.MinAge, req.MaxAge
-	// find matches based on the user's preferences
-	matches, err := mh.matchLogic.FindMatches(c.Request().Context(), userID,
-		match.WithLocation(req.Latitude, req.Longitude), match.WithDistance(req.Distance),
-		match.WithGender(constant.UserGender(req.Gender)), match.WithAgeRange(req.MinAge, req.MaxAge))
+	if req.Gender != "" {
+		opts = append(opts, match.WithGender(constant.UserGender(req.Gender)))
+	}
+
+	// find matches based on the given filters and the user's stored preferences
+	discovery, err := mh.matchLogic.FindMatches(c.Request().Context(), userID, opts...)
 	if err != nil {
+		if errors.Is(err, constant.ErrInvalidCursor) {
+			return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
 		mh.logger.Error("Failed to find matches", zap.Error(err))
 		return utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 	}
 
-	results := formatMatches(matches, &req) // format the matches
+	results := formatMatches(discovery) // format the matches
 	return c.JSON(http.StatusOK, results)
 }
 
-func formatMatches(matches []model.UserDTO, req *DiscoverRequest) DiscoverResponse {
-	results := make([]MatchResult, 0, len(matches))
-	for _, match := range matches {
+func formatMatches(discovery *model.Discovery) DiscoverResponse {
+	results := make([]MatchResult, 0, len(discovery.Matches))
+	for _, match := range discovery.Matches {
 		result := MatchResult{
-			ID:             match.ID,
-			Name:           match.Name,
-			Gender:         match.Gender,
-			Age:            match.Age,
-			DistanceFromMe: geo.CalculateDistance(req.Latitude, req.Longitude, match.Location.Lat, match.Location.Lng),
+			ID:            match.ID,
+			Name:          match.Name,
+			Gender:        match.Gender,
+			Age:           match.Age,
+			ProfileFields: formatProfile(match.Profile),
+		}
+		if match.Distance != nil {
+			meters, kilometers := int(math.Round(*match.Distance)), int(math.Round(*match.Distance/1000))
+			result.DistanceMeters, result.DistanceFromMe = &meters, &kilometers
 		}
 		results = append(results, result)
 	}
-	return DiscoverResponse{Results: results}
+	return DiscoverResponse{Results: results, NextCursor: discovery.NextCursor}
+}
+
+// ListMatches returns a page of the matches of the user, the most recently active first
+func (mh *MatchHandler) ListMatches(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	if userID == 0 {
+		mh.logger.Warn("Unauthorized access attempt", zap.Uint("userID", userID))
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	var req ListMatchesRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	list, err := mh.matchLogic.ListMatches(c.Request().Context(), userID, req.Limit, req.Cursor)
+	if err != nil {
+		if errors.Is(err, constant.ErrInvalidCursor) {
+			return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+		mh.logger.Error("Failed to list matches", zap.Error(err))
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "error listing matches")
+	}
+	return c.JSON(http.StatusOK, formatMatchList(list))
+}
+
+// Unmatch undoes a match of the user, the users of the match do not appear in the discovery of each other anymore
+func (mh *MatchHandler) Unmatch(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	if userID == 0 {
+		mh.logger.Warn("Unauthorized access attempt", zap.Uint("userID", userID))
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	var req UnmatchRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	if err := mh.matchLogic.Unmatch(c.Request().Context(), userID, req.ID, constant.UnmatchReason(req.Reason)); err != nil {
+		if errors.Is(err, constant.ErrMatchNotFound) {
+			return utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		}
+		mh.logger.Error("Failed to unmatch", zap.Error(err))
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "error unmatching")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func formatMatchList(list *model.MatchList) ListMatchesResponse {
+	results := make([]MatchSummary, 0, len(list.Matches))
+	for _, match := range list.Matches {
+		results = append(results, MatchSummary{
+			ID: match.ID,
+			User: MatchedUser{
+				ID:            match.User.ID,
+				Name:          match.User.Name,
+				Gender:        match.User.Gender,
+				Age:           match.User.Age,
+				ProfileFields: formatProfile(match.User.Profile),
+			},
+			MatchedAt:      match.MatchedAt,
+			LastActivityAt: match.LastActivityAt,
+			UnreadCount:    match.UnreadCount,
+		})
+	}
+	return ListMatchesResponse{Results: results, NextCursor: list.NextCursor}
+}
+
+// formatProfile formats the public profile of a user, a user without a profile has no profile fields
+func formatProfile(profile *model.Profile) ProfileFields {
+	var result ProfileFields
+	if profile == nil {
+		return result
+	}
+	result.Bio = profile.Bio
+	result.JobTitle = profile.JobTitle
+	result.School = profile.School
+	result.Height = profile.Height
+	result.Interests = profile.Interests
+	for _, prompt := range profile.Prompts {
+		result.Prompts = append(result.Prompts, Prompt{Question: prompt.Question, Answer: prompt.Answer})
+	}
+	for _, photo := range profile.Photos {
+		result.Photos = append(result.Photos, Photo{URL: photo.URL, Width: photo.Width, Height: photo.Height})
+	}
+	return result
 }
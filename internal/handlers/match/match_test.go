@@ -2,9 +2,12 @@ package match
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/a-berahman/dating-app/constant"
 	"github.com/a-berahman/dating-app/internal/logic"
@@ -18,15 +21,31 @@ import (
 
 // MockMatchLogic is a mock type for the MatchLogic interface
 type MockMatchLogic struct {
-	Users   []model.UserDTO
-	Err     error
-	Match   bool
-	MatchID uint
+	Users      []model.UserDTO
+	Matches    []model.Match
+	NextCursor string
+	Err        error
+	Match      bool
+	MatchID    uint
 }
 
-func (m *MockMatchLogic) FindMatches(ctx context.Context, userID uint, opts ...match.MatchOption) ([]model.UserDTO, error) {
-	return m.Users, m.Err
+func (m *MockMatchLogic) FindMatches(ctx context.Context, userID uint, opts ...match.MatchOption) (*model.Discovery, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return &model.Discovery{Matches: m.Users, NextCursor: m.NextCursor}, nil
+}
+func (m *MockMatchLogic) ListMatches(ctx context.Context, userID uint, limit int, cursor string) (*model.MatchList, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return &model.MatchList{Matches: m.Matches, NextCursor: m.NextCursor}, nil
+}
+
+func (m *MockMatchLogic) Unmatch(ctx context.Context, userID, matchID uint, reason constant.UnmatchReason) error {
+	return m.Err
 }
+
 func (m *MockMatchLogic) ProcessSwipe(ctx context.Context, userID, targetUserID uint, swipedRight bool) (bool, uint, error) {
 	return m.Match, m.MatchID, m.Err
 }
@@ -40,6 +59,7 @@ func TestDiscoverHandler(t *testing.T) {
 	}
 	v.RegisterValidation("gender", genderValdiation)
 	e.Validator = &Validator{validator: v}
+	distance := 3935432.6
 
 	scenarios := []struct {
 		name           string
@@ -54,20 +74,79 @@ func TestDiscoverHandler(t *testing.T) {
 			setupMock: &MockMatchLogic{
 				Users: []model.UserDTO{
 					{
-						ID:     1,
-						Name:   "test name",
-						Gender: constant.UserGenderMale,
-						Age:    25,
-						Location: model.Point{
-							Lat: 40.7128,
-							Lng: -74.0060,
-						},
+						ID:       1,
+						Name:     "test name",
+						Gender:   constant.UserGenderMale,
+						Age:      25,
+						Distance: &distance,
 					},
 				},
 				Err: nil,
 			},
 			expectedStatus: http.StatusOK,
-			expectedBody:   `{"results":[{"id":1,"name":"test name","gender":"MALE","age":25,"distanceFromMe":3935}]}`,
+			expectedBody:   `{"results":[{"id":1,"name":"test name","gender":"MALE","age":25,"distanceMeters":3935433,"distanceFromMe":3935}]}`,
+		},
+		{
+			name:        "Discovery From Stored Preferences",
+			requestPath: "/discover",
+			setupMock: &MockMatchLogic{
+				Users: []model.UserDTO{
+					{
+						ID:       1,
+						Name:     "test name",
+						Gender:   constant.UserGenderMale,
+						Age:      25,
+						Distance: &distance,
+						Profile:  &model.Profile{Bio: "hello", Interests: []string{"hiking"}},
+					},
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"results":[{"id":1,"name":"test name","gender":"MALE","age":25,"distanceMeters":3935433,"distanceFromMe":3935,"bio":"hello","interests":["hiking"]}]}`,
+		},
+		{
+			name:        "Discovery Without Location",
+			requestPath: "/discover",
+			setupMock: &MockMatchLogic{
+				Users: []model.UserDTO{{ID: 1, Name: "test name", Gender: constant.UserGenderMale, Age: 25}},
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"results":[{"id":1,"name":"test name","gender":"MALE","age":25}]}`,
+		},
+		{
+			name:           "Next Page",
+			requestPath:    "/discover?limit=1&cursor=abc&sort=newest",
+			setupMock:      &MockMatchLogic{Users: []model.UserDTO{{ID: 1, Name: "test name", Gender: constant.UserGenderMale, Age: 25}}, NextCursor: "def"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"results":[{"id":1,"name":"test name","gender":"MALE","age":25}],"nextCursor":"def"}`,
+		},
+		{
+			name:           "Invalid Sort",
+			requestPath:    "/discover?sort=popular",
+			setupMock:      &MockMatchLogic{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Key: 'DiscoverRequest.Sort' Error:Field validation for 'Sort' failed on the 'oneof' tag"}`,
+		},
+		{
+			name:           "Invalid Cursor",
+			requestPath:    "/discover?cursor=abc",
+			setupMock:      &MockMatchLogic{Err: constant.ErrInvalidCursor},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"invalid cursor"}`,
+		},
+		{
+			name:           "Limit Too Large",
+			requestPath:    "/discover?limit=500",
+			setupMock:      &MockMatchLogic{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Key: 'DiscoverRequest.Limit' Error:Field validation for 'Limit' failed on the 'lte' tag"}`,
+		},
+		{
+			name:           "Latitude Without Longitude",
+			requestPath:    "/discover?lat=34.0522",
+			setupMock:      &MockMatchLogic{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"lat and lng must be given together"}`,
 		},
 		{
 			name:           "Invalid Parameters",
@@ -95,6 +174,148 @@ func TestDiscoverHandler(t *testing.T) {
 	}
 }
 
+func TestListMatchesHandler(t *testing.T) {
+	e := echo.New()
+	e.Validator = &Validator{validator: validator.New()}
+	matchedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	scenarios := []struct {
+		name           string
+		requestPath    string
+		setupMock      logic.MatchInterface
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:        "Successful List",
+			requestPath: "/matches?limit=1",
+			setupMock: &MockMatchLogic{
+				Matches: []model.Match{{
+					ID:             7,
+					User:           model.UserDTO{ID: 2, Name: "test name", Gender: constant.UserGenderFemale, Age: 25, Profile: &model.Profile{Bio: "hello"}},
+					MatchedAt:      matchedAt,
+					LastActivityAt: matchedAt.Add(time.Hour),
+					UnreadCount:    2,
+				}},
+				NextCursor: "abc",
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"results":[{"id":7,"user":{"id":2,"name":"test name","gender":"FEMALE","age":25,"bio":"hello"},` +
+				`"matchedAt":"2024-05-01T12:00:00Z","lastActivityAt":"2024-05-01T13:00:00Z","unreadCount":2}],"nextCursor":"abc"}`,
+		},
+		{
+			name:           "No Matches",
+			requestPath:    "/matches",
+			setupMock:      &MockMatchLogic{},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"results":[]}`,
+		},
+		{
+			name:           "Invalid Cursor",
+			requestPath:    "/matches?cursor=abc",
+			setupMock:      &MockMatchLogic{Err: constant.ErrInvalidCursor},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"invalid cursor"}`,
+		},
+		{
+			name:           "Limit Too Large",
+			requestPath:    "/matches?limit=500",
+			setupMock:      &MockMatchLogic{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Key: 'ListMatchesRequest.Limit' Error:Field validation for 'Limit' failed on the 'lte' tag"}`,
+		},
+		{
+			name:           "Internal Server Error",
+			requestPath:    "/matches",
+			setupMock:      &MockMatchLogic{Err: errors.New("database error")},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"error listing matches"}`,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, scenario.requestPath, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("userID", uint(1))
+			logger, _ := zap.NewDevelopment()
+			h := New(scenario.setupMock, logger)
+
+			if assert.NoError(t, h.ListMatches(c)) {
+				assert.Equal(t, scenario.expectedStatus, rec.Code)
+				assert.JSONEq(t, scenario.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestUnmatchHandler(t *testing.T) {
+	e := echo.New()
+	e.Validator = &Validator{validator: validator.New()}
+
+	scenarios := []struct {
+		name           string
+		matchID        string
+		requestBody    string
+		setupMock      logic.MatchInterface
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Successful Unmatch",
+			matchID:        "7",
+			requestBody:    `{"reason":"not_interested"}`,
+			setupMock:      &MockMatchLogic{},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Unmatch Without Reason",
+			matchID:        "7",
+			setupMock:      &MockMatchLogic{},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Unknown Reason",
+			matchID:        "7",
+			requestBody:    `{"reason":"bored"}`,
+			setupMock:      &MockMatchLogic{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Key: 'UnmatchRequest.Reason' Error:Field validation for 'Reason' failed on the 'oneof' tag"}`,
+		},
+		{
+			name:           "Match Not Found",
+			matchID:        "8",
+			setupMock:      &MockMatchLogic{Err: constant.ErrMatchNotFound},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"match not found"}`,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/matches/"+scenario.matchID, strings.NewReader(scenario.requestBody))
+			if scenario.requestBody != "" {
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(scenario.matchID)
+			c.Set("userID", uint(1))
+			logger, _ := zap.NewDevelopment()
+			h := New(scenario.setupMock, logger)
+
+			if assert.NoError(t, h.Unmatch(c)) {
+				assert.Equal(t, scenario.expectedStatus, rec.Code)
+				if scenario.expectedBody != "" {
+					assert.JSONEq(t, scenario.expectedBody, rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
 type Validator struct {
 	validator *validator.Validate
 }
@@ -1,15 +1,22 @@
 package match
 
-import "github.com/a-berahman/dating-app/constant"
+import (
+	"time"
 
-// DiscoverRequest represents the request to discover potential matches
+	"github.com/a-berahman/dating-app/constant"
+)
+
+// DiscoverRequest represents the request to discover potential matches, the parameters left out fall back to the stored preferences
 type DiscoverRequest struct {
-	Latitude  float64 `query:"lat" validate:"required"`
-	Longitude float64 `query:"lng" validate:"required"`
-	Distance  float64 `query:"distance" validate:"gte=0"`
-	MinAge    int     `query:"minAge"`
-	MaxAge    int     `query:"maxAge"`
-	Gender    string  `query:"gender" validate:"required,gender"`
+	Latitude  *float64 `query:"lat" validate:"omitempty,gte=-90,lte=90"`
+	Longitude *float64 `query:"lng" validate:"omitempty,gte=-180,lte=180"`
+	Distance  float64  `query:"distance" validate:"gte=0"`
+	MinAge    int      `query:"minAge" validate:"gte=0"`
+	MaxAge    int      `query:"maxAge" validate:"gte=0"`
+	Gender    string   `query:"gender" validate:"omitempty,gender"`
+	Sort      string   `query:"sort" validate:"omitempty,oneof=distance newest recently_active relevance"`
+	Limit     int      `query:"limit" validate:"gte=0,lte=50"`
+	Cursor    string   `query:"cursor"` // the nextCursor of the previous page
 }
 
 // MatchResult represents a single potential match
@@ -18,10 +25,73 @@ type MatchResult struct {
 	Name           string              `json:"name"`
 	Gender         constant.UserGender `json:"gender"`
 	Age            int                 `json:"age"`
-	DistanceFromMe int                 `json:"distanceFromMe"`
+	DistanceMeters *int                `json:"distanceMeters,omitempty"` // is left out when the user has no location
+	DistanceFromMe *int                `json:"distanceFromMe,omitempty"` // kilometers rounded for display
+	ProfileFields
+}
+
+// ProfileFields is the public profile of a user, the fields the user did not fill are left out
+type ProfileFields struct {
+	Bio       string   `json:"bio,omitempty"`
+	JobTitle  string   `json:"jobTitle,omitempty"`
+	School    string   `json:"school,omitempty"`
+	Height    *int     `json:"height,omitempty"`
+	Interests []string `json:"interests,omitempty"`
+	Prompts   []Prompt `json:"prompts,omitempty"`
+	Photos    []Photo  `json:"photos,omitempty"`
+}
+
+// Prompt is the answer of a match to a profile question
+type Prompt struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// Photo is the metadata of a profile photo of a match
+type Photo struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
 }
 
 // DiscoverResponse represents the collection of match results
 type DiscoverResponse struct {
-	Results []MatchResult `json:"results"`
+	Results    []MatchResult `json:"results"`
+	NextCursor string        `json:"nextCursor,omitempty"` // is empty on the last page
+}
+
+// ListMatchesRequest represents the request for a page of the matches of the user
+type ListMatchesRequest struct {
+	Limit  int    `query:"limit" validate:"gte=0,lte=50"`
+	Cursor string `query:"cursor"` // the nextCursor of the previous page
+}
+
+// MatchedUser is the other user of a match
+type MatchedUser struct {
+	ID     uint                `json:"id"`
+	Name   string              `json:"name"`
+	Gender constant.UserGender `json:"gender"`
+	Age    int                 `json:"age"`
+	ProfileFields
+}
+
+// MatchSummary represents a match of the user
+type MatchSummary struct {
+	ID             uint        `json:"id"`
+	User           MatchedUser `json:"user"`
+	MatchedAt      time.Time   `json:"matchedAt"`
+	LastActivityAt time.Time   `json:"lastActivityAt"`
+	UnreadCount    int         `json:"unreadCount"` // is the number of the messages of the other user the user has not read
+}
+
+// ListMatchesResponse represents a page of the matches of the user
+type ListMatchesResponse struct {
+	Results    []MatchSummary `json:"results"`
+	NextCursor string         `json:"nextCursor,omitempty"` // is empty on the last page
+}
+
+// UnmatchRequest represents the request to undo a match, the reason is optional
+type UnmatchRequest struct {
+	ID     uint   `param:"id" validate:"required"`
+	Reason string `json:"reason" validate:"omitempty,oneof=not_interested inappropriate spam other"`
 }
@@ -0,0 +1,118 @@
+package message
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/logic"
+	"github.com/a-berahman/dating-app/internal/model"
+	"github.com/a-berahman/dating-app/pkg/decode"
+	"github.com/a-berahman/dating-app/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// MessageHandler handles the messages between matched users
+type MessageHandler struct {
+	messageLogic logic.MessageInterface
+	logger       *zap.Logger
+}
+
+// New creates a new handler for the messages
+func New(messageLogic logic.MessageInterface, logger *zap.Logger) *MessageHandler {
+	return &MessageHandler{
+		messageLogic: messageLogic,
+		logger:       logger,
+	}
+}
+
+// SendMessage sends a message to the other user of a match
+func (mh *MessageHandler) SendMessage(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	if userID == 0 {
+		mh.logger.Debug("Unauthorized message attempt")
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	var req SendMessageRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	message, err := mh.messageLogic.SendMessage(c.Request().Context(), userID, req.MatchID, req.Body)
+	if err != nil {
+		return mh.errorResponse(c, err, "error sending message")
+	}
+	return c.JSON(http.StatusCreated, MessageResponse{Result: formatMessage(message)})
+}
+
+// ListMessages returns a page of the messages of a match, the newest first
+func (mh *MessageHandler) ListMessages(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	if userID == 0 {
+		mh.logger.Debug("Unauthorized message attempt")
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	var req ListMessagesRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	list, err := mh.messageLogic.ListMessages(c.Request().Context(), userID, req.MatchID, req.Limit, req.Cursor)
+	if err != nil {
+		return mh.errorResponse(c, err, "error listing messages")
+	}
+	results := make([]MessageResult, 0, len(list.Messages))
+	for i := range list.Messages {
+		results = append(results, formatMessage(&list.Messages[i]))
+	}
+	return c.JSON(http.StatusOK, ListMessagesResponse{Results: results, NextCursor: list.NextCursor})
+}
+
+// MarkRead marks the messages of a match as read by the user, the other user gets a read receipt
+func (mh *MessageHandler) MarkRead(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	if userID == 0 {
+		mh.logger.Debug("Unauthorized message attempt")
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	var req MarkReadRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	lastRead, err := mh.messageLogic.MarkRead(c.Request().Context(), userID, req.MatchID, req.MessageID)
+	if err != nil {
+		return mh.errorResponse(c, err, "error marking messages read")
+	}
+	return c.JSON(http.StatusOK, MarkReadResponse{Result: ReadResult{MatchID: req.MatchID, LastReadMessageID: lastRead}})
+}
+
+// errorResponse maps the errors of the message logic, the matches of other users are not found so their existence is not revealed
+func (mh *MessageHandler) errorResponse(c echo.Context, err error, message string) error {
+	switch {
+	case errors.Is(err, constant.ErrEmptyMessage), errors.Is(err, constant.ErrInvalidCursor):
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, constant.ErrMatchNotFound):
+		return utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, constant.ErrMatchUnmatched):
+		return utils.ErrorResponse(c, http.StatusGone, err.Error())
+	}
+	mh.logger.Error("Failed to process message request", zap.Error(err))
+	return utils.ErrorResponse(c, http.StatusInternalServerError, message)
+}
+
+func formatMessage(message *model.Message) MessageResult {
+	return MessageResult{
+		ID:        message.ID,
+		MatchID:   message.MatchID,
+		SenderID:  message.SenderID,
+		Body:      message.Body,
+		CreatedAt: message.CreatedAt,
+		Delivered: message.Delivered,
+		Read:      message.Read,
+	}
+}
@@ -0,0 +1,268 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/model"
+	"github.com/go-playground/validator"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type MockMessageLogic struct {
+	Message    *model.Message
+	Messages   []model.Message
+	NextCursor string
+	LastRead   uint
+	Err        error
+}
+
+func (m *MockMessageLogic) SendMessage(ctx context.Context, userID, matchID uint, body string) (*model.Message, error) {
+	return m.Message, m.Err
+}
+
+func (m *MockMessageLogic) MarkRead(ctx context.Context, userID, matchID, messageID uint) (uint, error) {
+	return m.LastRead, m.Err
+}
+
+func (m *MockMessageLogic) MarkDelivered(ctx context.Context, userID, matchID, messageID uint) error {
+	return m.Err
+}
+
+func (m *MockMessageLogic) Typing(ctx context.Context, userID, matchID uint) error {
+	return m.Err
+}
+
+func (m *MockMessageLogic) ListMessages(ctx context.Context, userID, matchID uint, limit int, cursor string) (*model.MessageList, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return &model.MessageList{Messages: m.Messages, NextCursor: m.NextCursor}, nil
+}
+
+var sentAt = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func TestSendMessage(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		setupMock      *MockMessageLogic
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Successful Message",
+			requestBody:    `{"body":"hello"}`,
+			setupMock:      &MockMessageLogic{Message: &model.Message{ID: 3, MatchID: 7, SenderID: 1, Body: "hello", CreatedAt: sentAt}},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"result":{"id":3,"matchId":7,"senderId":1,"body":"hello","createdAt":"2024-05-01T12:00:00Z","delivered":false,"read":false}}`,
+		},
+		{
+			name:           "Missing Body",
+			requestBody:    `{}`,
+			setupMock:      &MockMessageLogic{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Key: 'SendMessageRequest.Body' Error:Field validation for 'Body' failed on the 'required' tag"}`,
+		},
+		{
+			name:           "Message Too Long",
+			requestBody:    `{"body":"` + strings.Repeat("a", constant.MaxMessageLength+1) + `"}`,
+			setupMock:      &MockMessageLogic{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Key: 'SendMessageRequest.Body' Error:Field validation for 'Body' failed on the 'max' tag"}`,
+		},
+		{
+			name:           "Blank Message",
+			requestBody:    `{"body":"  "}`,
+			setupMock:      &MockMessageLogic{Err: constant.ErrEmptyMessage},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"message is empty"}`,
+		},
+		{
+			name:           "Match Of Other Users",
+			requestBody:    `{"body":"hello"}`,
+			setupMock:      &MockMessageLogic{Err: constant.ErrMatchNotFound},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"match not found"}`,
+		},
+		{
+			name:           "Unmatched Match",
+			requestBody:    `{"body":"hello"}`,
+			setupMock:      &MockMessageLogic{Err: constant.ErrMatchUnmatched},
+			expectedStatus: http.StatusGone,
+			expectedBody:   `{"error":"match has been unmatched"}`,
+		},
+		{
+			name:           "Internal Server Error",
+			requestBody:    `{"body":"hello"}`,
+			setupMock:      &MockMessageLogic{Err: errors.New("database error")},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"error sending message"}`,
+		},
+	}
+
+	e := echo.New()
+	e.Validator = &Validator{validator: validator.New()}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/matches/7/messages", strings.NewReader(tc.requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("7")
+			c.Set("userID", uint(1))
+			logger, _ := zap.NewDevelopment()
+			h := New(tc.setupMock, logger)
+
+			if assert.NoError(t, h.SendMessage(c)) {
+				assert.Equal(t, tc.expectedStatus, rec.Code)
+				assert.JSONEq(t, tc.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestListMessages(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestPath    string
+		setupMock      *MockMessageLogic
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:        "Successful List",
+			requestPath: "/matches/7/messages?limit=1",
+			setupMock: &MockMessageLogic{
+				Messages:   []model.Message{{ID: 3, MatchID: 7, SenderID: 2, Body: "hi", CreatedAt: sentAt, Delivered: true, Read: true}},
+				NextCursor: "abc",
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"results":[{"id":3,"matchId":7,"senderId":2,"body":"hi","createdAt":"2024-05-01T12:00:00Z","delivered":true,"read":true}],"nextCursor":"abc"}`,
+		},
+		{
+			name:           "Empty Conversation",
+			requestPath:    "/matches/7/messages",
+			setupMock:      &MockMessageLogic{},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"results":[]}`,
+		},
+		{
+			name:           "Limit Too Large",
+			requestPath:    "/matches/7/messages?limit=500",
+			setupMock:      &MockMessageLogic{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Key: 'ListMessagesRequest.Limit' Error:Field validation for 'Limit' failed on the 'lte' tag"}`,
+		},
+		{
+			name:           "Invalid Cursor",
+			requestPath:    "/matches/7/messages?cursor=abc",
+			setupMock:      &MockMessageLogic{Err: constant.ErrInvalidCursor},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"invalid cursor"}`,
+		},
+		{
+			name:           "Match Of Other Users",
+			requestPath:    "/matches/7/messages",
+			setupMock:      &MockMessageLogic{Err: constant.ErrMatchNotFound},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"match not found"}`,
+		},
+	}
+
+	e := echo.New()
+	e.Validator = &Validator{validator: validator.New()}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.requestPath, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("7")
+			c.Set("userID", uint(1))
+			logger, _ := zap.NewDevelopment()
+			h := New(tc.setupMock, logger)
+
+			if assert.NoError(t, h.ListMessages(c)) {
+				assert.Equal(t, tc.expectedStatus, rec.Code)
+				assert.JSONEq(t, tc.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestMarkRead(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		setupMock      *MockMessageLogic
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Up To A Message",
+			requestBody:    `{"messageId":30}`,
+			setupMock:      &MockMessageLogic{LastRead: 30},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":{"matchId":7,"lastReadMessageId":30}}`,
+		},
+		{
+			name:           "All Messages",
+			setupMock:      &MockMessageLogic{LastRead: 42},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":{"matchId":7,"lastReadMessageId":42}}`,
+		},
+		{
+			name:           "Match Of Other Users",
+			setupMock:      &MockMessageLogic{Err: constant.ErrMatchNotFound},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"match not found"}`,
+		},
+		{
+			name:           "Unmatched Match",
+			setupMock:      &MockMessageLogic{Err: constant.ErrMatchUnmatched},
+			expectedStatus: http.StatusGone,
+			expectedBody:   `{"error":"match has been unmatched"}`,
+		},
+	}
+
+	e := echo.New()
+	e.Validator = &Validator{validator: validator.New()}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/matches/7/read", strings.NewReader(tc.requestBody))
+			if tc.requestBody != "" {
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("7")
+			c.Set("userID", uint(1))
+			logger, _ := zap.NewDevelopment()
+			h := New(tc.setupMock, logger)
+
+			if assert.NoError(t, h.MarkRead(c)) {
+				assert.Equal(t, tc.expectedStatus, rec.Code)
+				assert.JSONEq(t, tc.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+type Validator struct {
+	validator *validator.Validate
+}
+
+func (v *Validator) Validate(i interface{}) error {
+	return v.validator.Struct(i)
+}
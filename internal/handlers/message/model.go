@@ -0,0 +1,56 @@
+package message
+
+import "time"
+
+// SendMessageRequest defines the structure of the request to send a message to the other user of a match
+type SendMessageRequest struct {
+	MatchID uint   `param:"id" validate:"required"`
+	Body    string `json:"body" validate:"required,max=2000"`
+}
+
+// ListMessagesRequest defines the structure of the request for a page of the messages of a match
+type ListMessagesRequest struct {
+	MatchID uint   `param:"id" validate:"required"`
+	Limit   int    `query:"limit" validate:"gte=0,lte=100"`
+	Cursor  string `query:"cursor"` // the nextCursor of the previous page
+}
+
+// MarkReadRequest defines the structure of the request to mark the messages of a match as read,
+// up to the given message or all of them when it is left out
+type MarkReadRequest struct {
+	MatchID   uint `param:"id" validate:"required"`
+	MessageID uint `json:"messageId"`
+}
+
+// MessageResult is a message of a match, delivered tells whether it has reached a device of the recipient and read whether the recipient has read it
+type MessageResult struct {
+	ID        uint      `json:"id"`
+	MatchID   uint      `json:"matchId"`
+	SenderID  uint      `json:"senderId"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+	Delivered bool      `json:"delivered"`
+	Read      bool      `json:"read"`
+}
+
+// ReadResult is the last message of a match the user has read
+type ReadResult struct {
+	MatchID           uint `json:"matchId"`
+	LastReadMessageID uint `json:"lastReadMessageId"`
+}
+
+// MarkReadResponse defines the structure of the response for marking messages as read
+type MarkReadResponse struct {
+	Result ReadResult `json:"result"`
+}
+
+// MessageResponse defines the structure of the response for a sent message
+type MessageResponse struct {
+	Result MessageResult `json:"result"`
+}
+
+// ListMessagesResponse defines the structure of the response for a page of messages, the newest first
+type ListMessagesResponse struct {
+	Results    []MessageResult `json:"results"`
+	NextCursor string          `json:"nextCursor,omitempty"` // is empty on the last page
+}
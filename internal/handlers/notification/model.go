@@ -0,0 +1,10 @@
+package notification
+
+import "github.com/a-berahman/dating-app/constant"
+
+// ClientMessage represents a message of a connected device, the pong answering the ping of the heartbeat
+// or the typing of the user in a match
+type ClientMessage struct {
+	Type    constant.EventType `json:"type"`
+	MatchID uint               `json:"matchId,omitempty"`
+}
@@ -0,0 +1,282 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/logic"
+	"github.com/a-berahman/dating-app/internal/model"
+	"github.com/a-berahman/dating-app/pkg/hub"
+	"github.com/a-berahman/dating-app/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+// NotificationHandler delivers the events of the users to their connected devices
+type NotificationHandler struct {
+	hub          *hub.Hub
+	messageLogic logic.MessageInterface
+	revocations  logic.RevocationInterface
+	heartbeat    time.Duration
+	logger       *zap.Logger
+}
+
+// New creates a new handler for the connections of the devices, a connection lives as long as the token it was opened with
+// so the revocations of the tokens are checked on every heartbeat
+func New(events *hub.Hub, messageLogic logic.MessageInterface, revocations logic.RevocationInterface, logger *zap.Logger) *NotificationHandler {
+	return &NotificationHandler{
+		hub:          events,
+		messageLogic: messageLogic,
+		revocations:  revocations,
+		heartbeat:    constant.EventHeartbeatInterval,
+		logger:       logger,
+	}
+}
+
+// WebSocket upgrades the request to a WebSocket that receives the events of the user until either side closes it.
+// The origin is not checked, the connection is authenticated by the token and not by cookies a foreign page could use
+func (nh *NotificationHandler) WebSocket(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	claims := utils.GetClaimsFromContext(c)
+	if userID == 0 || claims == nil {
+		nh.logger.Debug("Unauthorized websocket attempt")
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		nh.serve(c.Request().Context(), ws, claims)
+	}}
+	server.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
+// Events streams the events of the user as Server-Sent Events for the clients behind proxies that break the WebSocket.
+// A client that reconnects with the Last-Event-ID header gets the events it missed, or a resync event when they are
+// not kept anymore. Every event is the JSON of the WebSocket event so the clients decode both the same way.
+// The stream ends when the token expires or is revoked
+func (nh *NotificationHandler) Events(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	claims := utils.GetClaimsFromContext(c)
+	if userID == 0 || claims == nil {
+		nh.logger.Debug("Unauthorized event stream attempt")
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	var client *hub.Client
+	var missed []hub.Event
+	complete := true
+	if header := c.Request().Header.Get(constant.LastEventIDHeader); header != "" {
+		var err error
+		client, missed, complete, err = nh.hub.SubscribeSince(userID, header)
+		if err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("%s must be the id of an event", constant.LastEventIDHeader))
+		}
+	} else {
+		client = nh.hub.Subscribe(userID)
+	}
+	defer nh.hub.Unsubscribe(client)
+
+	if !complete {
+		// the client reloads its state instead, the resync carries the latest id so the next resume starts from there
+		resync := hub.Event{Type: constant.EventResync}
+		if len(missed) > 0 {
+			resync.ID = missed[len(missed)-1].ID
+		}
+		missed = []hub.Event{resync}
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	// the proxies that buffer the responses would hold the events back
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	controller := http.NewResponseController(res)
+	defer controller.SetWriteDeadline(time.Time{})
+
+	ctx := c.Request().Context()
+	if err := nh.stream(controller, res, missed...); err != nil {
+		return nil
+	}
+	nh.delivered(ctx, userID, missed...)
+	expiry := time.NewTimer(time.Until(time.Unix(claims.ExpiresAt, 0)))
+	defer expiry.Stop()
+	ticker := time.NewTicker(nh.heartbeat)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case event := <-client.Events():
+			if err = nh.stream(controller, res, event); err == nil {
+				nh.delivered(ctx, userID, event)
+			}
+		case <-expiry.C:
+			nh.logger.Debug("Closing event stream of an expired token", zap.Uint("userID", userID))
+			return nil
+		case <-ticker.C:
+			if nh.revoked(ctx, claims) {
+				return nil
+			}
+			// a comment keeps the idle connection open through the proxies, the clients ignore it
+			err = nh.flush(controller, func() error {
+				_, err := io.WriteString(res, ": ping\n\n")
+				return err
+			})
+		case <-client.Dropped():
+			nh.logger.Warn("Closing event stream of a slow device", zap.Uint("userID", userID))
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+		if err != nil {
+			nh.logger.Debug("Failed to write to event stream", zap.Uint("userID", userID), zap.Error(err))
+			return nil
+		}
+	}
+}
+
+// stream writes the events in the format of Server-Sent Events, the ephemeral events have no id
+// so they do not move the Last-Event-ID of the client
+func (nh *NotificationHandler) stream(controller *http.ResponseController, w io.Writer, events ...hub.Event) error {
+	return nh.flush(controller, func() error {
+		for _, event := range events {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			if event.ID != "" {
+				if _, err := fmt.Fprintf(w, "id: %s\n", event.ID); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// flush writes within the write timeout and sends the written bytes to the client right away
+func (nh *NotificationHandler) flush(controller *http.ResponseController, write func() error) error {
+	if err := controller.SetWriteDeadline(time.Now().Add(constant.EventWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	return controller.Flush()
+}
+
+// serve writes the events of the user and the heartbeat to the connection, it is the only writer of the connection, and marks
+// the messages it writes as delivered.
+// The connection is closed when the device stops answering, falls too far behind its events or its token expires or is revoked
+func (nh *NotificationHandler) serve(ctx context.Context, ws *websocket.Conn, claims *model.Claims) {
+	userID := claims.UserID
+	client := nh.hub.Subscribe(userID)
+	defer nh.hub.Unsubscribe(client)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		nh.read(ctx, ws, userID)
+	}()
+
+	expiry := time.NewTimer(time.Until(time.Unix(claims.ExpiresAt, 0)))
+	defer expiry.Stop()
+	ticker := time.NewTicker(nh.heartbeat)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case event := <-client.Events():
+			if err = nh.write(ws, event); err == nil {
+				nh.delivered(ctx, userID, event)
+			}
+		case <-expiry.C:
+			nh.logger.Debug("Closing websocket of an expired token", zap.Uint("userID", userID))
+			return
+		case <-ticker.C:
+			if nh.revoked(ctx, claims) {
+				return
+			}
+			err = nh.write(ws, hub.Event{Type: constant.EventPing})
+		case <-client.Dropped():
+			nh.logger.Warn("Closing websocket of a slow device", zap.Uint("userID", userID))
+			return
+		case <-done:
+			return
+		}
+		if err != nil {
+			nh.logger.Debug("Failed to write to websocket", zap.Uint("userID", userID), zap.Error(err))
+			return
+		}
+	}
+}
+
+// delivered marks the messages of the other users among the events written to a device of the user as delivered, a failure
+// is only logged as the messages are delivered again when the user lists them
+func (nh *NotificationHandler) delivered(ctx context.Context, userID uint, events ...hub.Event) {
+	for _, event := range events {
+		message, ok := event.Data.(model.MessageCreatedEvent)
+		if event.Type != constant.EventMessageCreated || !ok || message.SenderID == userID {
+			continue
+		}
+		if err := nh.messageLogic.MarkDelivered(ctx, userID, message.MatchID, message.ID); err != nil {
+			nh.logger.Debug("Failed to mark message delivered", zap.Uint("userID", userID), zap.Uint("messageID", message.ID), zap.Error(err))
+		}
+	}
+}
+
+// revoked reports whether the token of the connection has been revoked since it was opened by a logout or a password reset,
+// the connection is closed when the revocation cannot be checked like the request of a token would be refused
+func (nh *NotificationHandler) revoked(ctx context.Context, claims *model.Claims) bool {
+	revoked, err := nh.revocations.IsRevoked(ctx, claims)
+	if err != nil {
+		nh.logger.Error("Failed to check token revocation", zap.Uint("userID", claims.UserID), zap.Error(err))
+		return true
+	}
+	if revoked {
+		nh.logger.Debug("Closing connection of a revoked token", zap.Uint("userID", claims.UserID))
+	}
+	return revoked
+}
+
+// read handles the messages of the device, a device that sends nothing for two heartbeats is gone
+func (nh *NotificationHandler) read(ctx context.Context, ws *websocket.Conn, userID uint) {
+	for {
+		if err := ws.SetReadDeadline(time.Now().Add(2 * nh.heartbeat)); err != nil {
+			return
+		}
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			return
+		}
+
+		var message ClientMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			nh.logger.Debug("Ignoring malformed websocket message", zap.Uint("userID", userID), zap.Error(err))
+			continue
+		}
+		if message.Type != constant.EventTyping {
+			continue
+		}
+		if err := nh.messageLogic.Typing(ctx, userID, message.MatchID); err != nil {
+			nh.logger.Debug("Ignoring typing event", zap.Uint("userID", userID), zap.Uint("matchID", message.MatchID), zap.Error(err))
+		}
+	}
+}
+
+func (nh *NotificationHandler) write(ws *websocket.Conn, event hub.Event) error {
+	if err := ws.SetWriteDeadline(time.Now().Add(constant.EventWriteTimeout)); err != nil {
+		return err
+	}
+	return websocket.JSON.Send(ws, event)
+}
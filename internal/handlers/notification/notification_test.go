@@ -0,0 +1,347 @@
+package notification
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/logic"
+	"github.com/a-berahman/dating-app/internal/model"
+	"github.com/a-berahman/dating-app/pkg/hub"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+// MockMessageLogic publishes the typing to the user 2 and records the delivered messages, the handler does not use the other methods
+type MockMessageLogic struct {
+	logic.MessageInterface
+	Hub *hub.Hub
+
+	mu        sync.Mutex
+	delivered [][3]uint
+}
+
+func (m *MockMessageLogic) MarkDelivered(ctx context.Context, userID, matchID, messageID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.delivered = append(m.delivered, [3]uint{userID, matchID, messageID})
+	return nil
+}
+
+// Delivered returns the user, match and message of every delivery so far
+func (m *MockMessageLogic) Delivered() [][3]uint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([][3]uint(nil), m.delivered...)
+}
+
+func (m *MockMessageLogic) Typing(ctx context.Context, userID, matchID uint) error {
+	if matchID != 7 {
+		return constant.ErrMatchNotFound
+	}
+	m.Hub.Publish(hub.Event{Type: constant.EventTyping, Data: model.TypingEvent{MatchID: matchID, UserID: userID}}, 2)
+	return nil
+}
+
+// MockRevocations revokes the tokens of the users in Revoked
+type MockRevocations struct {
+	mu      sync.Mutex
+	Revoked map[uint]bool
+}
+
+func (m *MockRevocations) IsRevoked(ctx context.Context, claims *model.Claims) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Revoked[claims.UserID], nil
+}
+
+func (m *MockRevocations) Revoke(userID uint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Revoked[userID] = true
+}
+
+// received is an event as the device decodes it
+type received struct {
+	Type constant.EventType     `json:"type"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// setupServer serves the websocket and the event stream behind an authentication that takes the user id from the user query parameter,
+// the tokens expire after an hour unless the expires query parameter gives their lifetime in milliseconds
+func setupServer(t *testing.T, heartbeat time.Duration) (*hub.Hub, *MockMessageLogic, *MockRevocations, *httptest.Server) {
+	logger, _ := zap.NewDevelopment()
+	events := hub.New(constant.EventBufferSize, constant.EventLogSize, constant.EventLogRetention)
+	messages := &MockMessageLogic{Hub: events}
+	revocations := &MockRevocations{Revoked: map[uint]bool{}}
+	handler := New(events, messages, revocations, logger)
+	handler.heartbeat = heartbeat
+
+	e := echo.New()
+	auth := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if userID, err := strconv.Atoi(c.QueryParam("user")); err == nil {
+				lifetime := time.Hour
+				if expires, err := strconv.Atoi(c.QueryParam("expires")); err == nil {
+					lifetime = time.Duration(expires) * time.Millisecond
+				}
+				c.Set("userID", uint(userID))
+				c.Set("claims", &model.Claims{StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(lifetime).Unix()}, UserID: uint(userID)})
+			}
+			return next(c)
+		}
+	}
+	e.GET("/ws", handler.WebSocket, auth)
+	e.GET("/events", handler.Events, auth)
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	return events, messages, revocations, server
+}
+
+func connect(t *testing.T, server *httptest.Server, userID uint) *websocket.Conn {
+	return connectWithQuery(t, server, "user="+strconv.Itoa(int(userID)))
+}
+
+func connectWithQuery(t *testing.T, server *httptest.Server, query string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?" + query
+	ws, err := websocket.Dial(url, "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func receive(t *testing.T, ws *websocket.Conn) received {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var event received
+	if err := websocket.JSON.Receive(ws, &event); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+// waitForConnections waits until the hub has subscribed the devices of the user
+func waitForConnections(t *testing.T, events *hub.Hub, userID uint, connections int) {
+	assert.Eventually(t, func() bool { return events.Connections(userID) == connections }, time.Second, time.Millisecond)
+}
+
+func TestWebSocketFanOut(t *testing.T) {
+	events, _, _, server := setupServer(t, time.Minute)
+	phone, laptop, other := connect(t, server, 1), connect(t, server, 1), connect(t, server, 2)
+	waitForConnections(t, events, 1, 2)
+	waitForConnections(t, events, 2, 1)
+
+	events.Publish(hub.Event{Type: constant.EventMatchCreated, Data: model.MatchCreatedEvent{MatchID: 7, UserID: 2}}, 1)
+	for _, ws := range []*websocket.Conn{phone, laptop} {
+		event := receive(t, ws)
+		assert.Equal(t, constant.EventMatchCreated, event.Type)
+		assert.Equal(t, map[string]interface{}{"matchId": float64(7), "userId": float64(2)}, event.Data)
+	}
+
+	// the typing of a device reaches the other user of the match, unknown messages and matches are ignored
+	assert.NoError(t, websocket.Message.Send(other, "not json"))
+	assert.NoError(t, websocket.JSON.Send(phone, ClientMessage{Type: constant.EventTyping, MatchID: 9}))
+	assert.NoError(t, websocket.JSON.Send(phone, ClientMessage{Type: constant.EventTyping, MatchID: 7}))
+	event := receive(t, other)
+	assert.Equal(t, constant.EventTyping, event.Type)
+	assert.Equal(t, map[string]interface{}{"matchId": float64(7), "userId": float64(1)}, event.Data)
+
+	// a closed device is unsubscribed
+	laptop.Close()
+	waitForConnections(t, events, 1, 1)
+}
+
+func TestWebSocketHeartbeat(t *testing.T) {
+	events, _, _, server := setupServer(t, 20*time.Millisecond)
+	ws := connect(t, server, 1)
+
+	assert.Equal(t, constant.EventPing, receive(t, ws).Type)
+	assert.NoError(t, websocket.JSON.Send(ws, ClientMessage{Type: constant.EventPong}))
+	assert.Equal(t, constant.EventPing, receive(t, ws).Type)
+
+	// a device that stops answering is disconnected after two heartbeats
+	waitForConnections(t, events, 1, 0)
+}
+
+func TestWebSocketSessionEnd(t *testing.T) {
+	events, _, revocations, server := setupServer(t, 20*time.Millisecond)
+
+	// a revoked token is noticed on the next heartbeat
+	connect(t, server, 1)
+	waitForConnections(t, events, 1, 1)
+	revocations.Revoke(1)
+	waitForConnections(t, events, 1, 0)
+
+	// an expired token closes the connection without waiting for a heartbeat
+	events, _, _, server = setupServer(t, time.Minute)
+	connectWithQuery(t, server, "user=2&expires=1")
+	assert.Eventually(t, func() bool { return events.Connections(2) == 0 }, time.Second+100*time.Millisecond, 10*time.Millisecond)
+}
+
+func TestWebSocketDelivery(t *testing.T) {
+	events, messages, _, server := setupServer(t, time.Minute)
+	recipient, sender := connect(t, server, 1), connect(t, server, 2)
+	waitForConnections(t, events, 1, 1)
+	waitForConnections(t, events, 2, 1)
+
+	// the message is delivered once it is written to a device of the recipient, the devices of the sender do not deliver it
+	events.Publish(hub.Event{Type: constant.EventMessageCreated, Data: model.MessageCreatedEvent{ID: 3, MatchID: 7, SenderID: 2, Body: "hi"}}, 1, 2)
+	for _, ws := range []*websocket.Conn{recipient, sender} {
+		assert.Equal(t, constant.EventMessageCreated, receive(t, ws).Type)
+	}
+	assert.Eventually(t, func() bool { return len(messages.Delivered()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, [][3]uint{{1, 7, 3}}, messages.Delivered())
+}
+
+func TestWebSocketUnauthorized(t *testing.T) {
+	_, _, _, server := setupServer(t, time.Minute)
+
+	resp, err := http.Get(server.URL + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+// streamEvents opens the event stream of the user and returns the lines of the stream
+func streamEvents(t *testing.T, server *httptest.Server, userID uint, lastEventID string) (*http.Response, <-chan string) {
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/events?user="+strconv.Itoa(int(userID)), nil)
+	if lastEventID != "" {
+		req.Header.Set(constant.LastEventIDHeader, lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	lines := make(chan string, 100)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	return resp, lines
+}
+
+// nextLines returns the next lines of the stream
+func nextLines(t *testing.T, lines <-chan string, n int) []string {
+	t.Helper()
+	var received []string
+	for len(received) < n {
+		select {
+		case line := <-lines:
+			received = append(received, line)
+		case <-time.After(time.Second):
+			t.Fatalf("received %q, want %d lines", received, n)
+		}
+	}
+	return received
+}
+
+// eventID returns the id the hub gives to the event with the given number
+func eventID(events *hub.Hub, n int) string {
+	return events.Epoch() + "-" + strconv.Itoa(n)
+}
+
+func TestEvents(t *testing.T) {
+	events, _, _, server := setupServer(t, time.Minute)
+	for matchID := uint(1); matchID <= 3; matchID++ {
+		events.Publish(hub.Event{Type: constant.EventMatchCreated, Data: model.MatchCreatedEvent{MatchID: matchID, UserID: 2}}, 1)
+	}
+	id := func(n int) string { return eventID(events, n) }
+
+	// a device that resumes gets the events it missed and then the new ones
+	resp, lines := streamEvents(t, server, 1, id(1))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get(echo.HeaderContentType))
+	assert.Equal(t, []string{
+		"id: " + id(2), `data: {"id":"` + id(2) + `","type":"match.created","data":{"matchId":2,"userId":2}}`, "",
+		"id: " + id(3), `data: {"id":"` + id(3) + `","type":"match.created","data":{"matchId":3,"userId":2}}`, "",
+	}, nextLines(t, lines, 6))
+
+	events.Publish(hub.Event{Type: constant.EventTyping, Data: model.TypingEvent{MatchID: 3, UserID: 2}, Ephemeral: true}, 1)
+	events.Publish(hub.Event{Type: constant.EventLikeReceived}, 1)
+	assert.Equal(t, []string{
+		`data: {"type":"typing","data":{"matchId":3,"userId":2}}`, "",
+		"id: " + id(4), `data: {"id":"` + id(4) + `","type":"like.received"}`, "",
+	}, nextLines(t, lines, 5))
+
+	// a new device only gets the new events
+	_, fresh := streamEvents(t, server, 1, "")
+	waitForConnections(t, events, 1, 2)
+	events.Publish(hub.Event{Type: constant.EventLikeReceived}, 1)
+	assert.Equal(t, []string{"id: " + id(5), `data: {"id":"` + id(5) + `","type":"like.received"}`, ""}, nextLines(t, fresh, 3))
+}
+
+func TestEventsResync(t *testing.T) {
+	events, _, _, server := setupServer(t, 20*time.Millisecond)
+	for i := 0; i < constant.EventLogSize+2; i++ {
+		events.Publish(hub.Event{Type: constant.EventLikeReceived}, 1)
+	}
+
+	latest := eventID(events, constant.EventLogSize+2)
+	resync := []string{"id: " + latest, `data: {"id":"` + latest + `","type":"resync"}`, ""}
+
+	// the events after 1 are not all kept anymore, the device reloads its state and resumes from the latest event
+	_, lines := streamEvents(t, server, 1, eventID(events, 1))
+	assert.Equal(t, resync, nextLines(t, lines, 3))
+	// the heartbeat keeps the idle stream open
+	assert.Equal(t, []string{": ping", ""}, nextLines(t, lines, 2))
+
+	// the numbers start over when the process restarts, an id given before is never taken for a recent one
+	_, lines = streamEvents(t, server, 1, "previous-3")
+	assert.Equal(t, resync, nextLines(t, lines, 3))
+
+	resp, _ := streamEvents(t, server, 1, "not an id")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = streamEvents(t, server, 0, "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestEventsSessionEnd(t *testing.T) {
+	events, _, revocations, server := setupServer(t, 20*time.Millisecond)
+
+	// a revoked token ends the stream on the next heartbeat
+	_, lines := streamEvents(t, server, 1, "")
+	waitForConnections(t, events, 1, 1)
+	revocations.Revoke(1)
+	waitForConnections(t, events, 1, 0)
+	for {
+		select {
+		case _, open := <-lines:
+			if !open {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatal("the stream of the revoked token is still open")
+		}
+	}
+}
+
+func TestEventsDelivery(t *testing.T) {
+	events, messages, _, server := setupServer(t, time.Minute)
+	events.Publish(hub.Event{Type: constant.EventLikeReceived}, 1)
+	events.Publish(hub.Event{Type: constant.EventMessageCreated, Data: model.MessageCreatedEvent{ID: 3, MatchID: 7, SenderID: 2, Body: "hi"}}, 1)
+
+	// the missed messages are delivered when the device resumes
+	_, lines := streamEvents(t, server, 1, eventID(events, 1))
+	nextLines(t, lines, 3)
+	assert.Eventually(t, func() bool { return len(messages.Delivered()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, [][3]uint{{1, 7, 3}}, messages.Delivered())
+}
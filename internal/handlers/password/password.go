@@ -0,0 +1,60 @@
+package password
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/logic"
+	"github.com/a-berahman/dating-app/pkg/decode"
+	"github.com/a-berahman/dating-app/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// PasswordHandler is a handler for password reset operations
+type PasswordHandler struct {
+	passwordLogic logic.PasswordInterface
+	logger        *zap.Logger
+}
+
+// New creates a new handler for password reset operations
+func New(passwordLogic logic.PasswordInterface, logger *zap.Logger) *PasswordHandler {
+	return &PasswordHandler{
+		passwordLogic: passwordLogic,
+		logger:        logger,
+	}
+}
+
+// ForgotPassword sends a password reset email, it answers the same way whether the email is registered or not
+func (ph *PasswordHandler) ForgotPassword(c echo.Context) error {
+	var req ForgotPasswordRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	if err := ph.passwordLogic.ForgotPassword(c.Request().Context(), req.Email); err != nil {
+		ph.logger.Error("Failed to process forgot password", zap.Error(err))
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to process the request")
+	}
+
+	return c.JSON(http.StatusAccepted, echo.Map{"message": "if the email is registered a reset link has been sent"})
+}
+
+// ResetPassword sets a new password with a reset token
+func (ph *PasswordHandler) ResetPassword(c echo.Context) error {
+	var req ResetPasswordRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	if err := ph.passwordLogic.ResetPassword(c.Request().Context(), req.Token, req.Password); err != nil {
+		if errors.Is(err, constant.ErrInvalidResetToken) {
+			return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+		ph.logger.Error("Failed to reset password", zap.Error(err))
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to reset password")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
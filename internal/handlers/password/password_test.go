@@ -0,0 +1,141 @@
+package password
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/logic"
+	"github.com/go-playground/validator"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type MockPasswordLogic struct {
+	Err error
+}
+
+func (m *MockPasswordLogic) ForgotPassword(ctx context.Context, email string) error {
+	return m.Err
+}
+
+func (m *MockPasswordLogic) ResetPassword(ctx context.Context, token, password string) error {
+	return m.Err
+}
+
+func TestForgotPassword(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		setupMock      logic.PasswordInterface
+		expectedStatus int
+	}{
+		{
+			name:           "Accepted",
+			requestBody:    `{"email":"jane@example.com"}`,
+			setupMock:      &MockPasswordLogic{},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "Invalid Email",
+			requestBody:    `{"email":"jane"}`,
+			setupMock:      &MockPasswordLogic{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Internal Error",
+			requestBody:    `{"email":"jane@example.com"}`,
+			setupMock:      &MockPasswordLogic{Err: errors.New("database error")},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	e := newEcho()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/password/forgot", strings.NewReader(tc.requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			logger, _ := zap.NewDevelopment()
+			h := New(tc.setupMock, logger)
+
+			if assert.NoError(t, h.ForgotPassword(c)) {
+				assert.Equal(t, tc.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		setupMock      logic.PasswordInterface
+		expectedStatus int
+	}{
+		{
+			name:           "Successful Reset",
+			requestBody:    `{"token":"token","password":"N3wPassword"}`,
+			setupMock:      &MockPasswordLogic{},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Weak Password",
+			requestBody:    `{"token":"token","password":"weak"}`,
+			setupMock:      &MockPasswordLogic{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid Token",
+			requestBody:    `{"token":"token","password":"N3wPassword"}`,
+			setupMock:      &MockPasswordLogic{Err: constant.ErrInvalidResetToken},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Internal Error",
+			requestBody:    `{"token":"token","password":"N3wPassword"}`,
+			setupMock:      &MockPasswordLogic{Err: errors.New("database error")},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	e := newEcho()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/password/reset", strings.NewReader(tc.requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			logger, _ := zap.NewDevelopment()
+			h := New(tc.setupMock, logger)
+
+			if assert.NoError(t, h.ResetPassword(c)) {
+				assert.Equal(t, tc.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func newEcho() *echo.Echo {
+	e := echo.New()
+	v := validator.New()
+	v.RegisterValidation("password", func(fl validator.FieldLevel) bool {
+		return len(fl.Field().String()) >= constant.MinPasswordLength
+	})
+	e.Validator = &Validator{validator: v}
+	return e
+}
+
+type Validator struct {
+	validator *validator.Validate
+}
+
+func (v *Validator) Validate(i interface{}) error {
+	return v.validator.Struct(i)
+}
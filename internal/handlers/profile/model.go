@@ -0,0 +1,97 @@
+package profile
+
+import "github.com/a-berahman/dating-app/constant"
+
+// UpdateProfileRequest defines the structure of the request for a partial profile update, the fields left out keep their value
+type UpdateProfileRequest struct {
+	Bio       *string   `json:"bio" validate:"omitempty,max=500"`
+	JobTitle  *string   `json:"jobTitle" validate:"omitempty,max=100"`
+	School    *string   `json:"school" validate:"omitempty,max=100"`
+	Height    *int      `json:"height" validate:"omitempty,eq=0|min=90,max=250"` // centimeters, 0 removes it
+	Interests *[]string `json:"interests" validate:"omitempty,max=10,dive,min=1,max=30"`
+	Prompts   *[]Prompt `json:"prompts" validate:"omitempty,max=3,dive"`
+	Photos    *[]Photo  `json:"photos" validate:"omitempty,max=6,dive"`
+}
+
+// GetUserRequest defines the structure of the request for the public profile of a user
+type GetUserRequest struct {
+	ID uint `param:"id" validate:"required"`
+}
+
+// Prompt is the answer of the user to a profile question
+type Prompt struct {
+	Question string `json:"question" validate:"required,max=150"`
+	Answer   string `json:"answer" validate:"required,max=300"`
+}
+
+// Photo is the metadata of a profile photo
+type Photo struct {
+	URL    string `json:"url" validate:"required,url,max=2048"`
+	Width  int    `json:"width,omitempty" validate:"gte=0"`
+	Height int    `json:"height,omitempty" validate:"gte=0"`
+}
+
+// ProfileResult is the profile shown to other users
+type ProfileResult struct {
+	Bio       string   `json:"bio"`
+	JobTitle  string   `json:"jobTitle"`
+	School    string   `json:"school"`
+	Height    *int     `json:"height"`
+	Interests []string `json:"interests"`
+	Prompts   []Prompt `json:"prompts"`
+	Photos    []Photo  `json:"photos"`
+}
+
+// PublicProfileResult is the information of a user that is visible to other users
+type PublicProfileResult struct {
+	ID     uint                `json:"id"`
+	Name   string              `json:"name"`
+	Gender constant.UserGender `json:"gender"`
+	Age    int                 `json:"age"`
+	ProfileResult
+}
+
+// MeResult is the information of the authenticated user with their profile
+type MeResult struct {
+	ID          uint                `json:"id"`
+	Email       string              `json:"email"`
+	Name        string              `json:"name"`
+	Gender      constant.UserGender `json:"gender"`
+	DateOfBirth string              `json:"dateOfBirth"`
+	Age         int                 `json:"age"`
+	Verified    bool                `json:"verified"`
+	ProfileResult
+}
+
+// MeResponse defines the structure of the response for the profile of the authenticated user
+type MeResponse struct {
+	Result MeResult `json:"result"`
+}
+
+// PublicProfileResponse defines the structure of the response for the public profile of a user
+type PublicProfileResponse struct {
+	Result PublicProfileResult `json:"result"`
+}
+
+// PreferencesRequest defines the structure of the request that replaces the discovery preferences, no genders means every gender
+type PreferencesRequest struct {
+	Genders     []string `json:"genders" validate:"max=2,dive,gender"`
+	MinAge      int      `json:"minAge" validate:"required,gte=18,lte=100"`
+	MaxAge      int      `json:"maxAge" validate:"required,gtefield=MinAge,lte=100"`
+	MaxDistance float64  `json:"maxDistance" validate:"required,gt=0,lte=500000"` // meters
+	ShowMe      *bool    `json:"showMe" validate:"required"`
+}
+
+// PreferencesResult is the discovery preferences of the authenticated user
+type PreferencesResult struct {
+	Genders     []constant.UserGender `json:"genders"`
+	MinAge      int                   `json:"minAge"`
+	MaxAge      int                   `json:"maxAge"`
+	MaxDistance float64               `json:"maxDistance"`
+	ShowMe      bool                  `json:"showMe"`
+}
+
+// PreferencesResponse defines the structure of the response for the discovery preferences
+type PreferencesResponse struct {
+	Result PreferencesResult `json:"result"`
+}
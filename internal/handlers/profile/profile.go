@@ -0,0 +1,218 @@
+package profile
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/logic"
+	"github.com/a-berahman/dating-app/internal/logic/profile"
+	"github.com/a-berahman/dating-app/internal/model"
+	"github.com/a-berahman/dating-app/pkg/decode"
+	"github.com/a-berahman/dating-app/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+type ProfileHandler struct {
+	profileLogic logic.ProfileInterface
+	logger       *zap.Logger
+}
+
+// New creates a new handler for profile operations
+func New(profileLogic logic.ProfileInterface, logger *zap.Logger) *ProfileHandler {
+	return &ProfileHandler{
+		profileLogic: profileLogic,
+		logger:       logger,
+	}
+}
+
+// GetMe returns the authenticated user with their profile
+func (h *ProfileHandler) GetMe(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	if userID == 0 {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	user, err := h.profileLogic.GetProfile(c.Request().Context(), userID)
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, MeResponse{Result: formatMe(user)})
+}
+
+// UpdateMe updates the fields of the profile that are present in the request body
+func (h *ProfileHandler) UpdateMe(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	if userID == 0 {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	var req UpdateProfileRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	user, err := h.profileLogic.UpdateProfile(c.Request().Context(), userID, profileOptions(&req)...)
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, MeResponse{Result: formatMe(user)})
+}
+
+// GetUser returns the public profile of a user
+func (h *ProfileHandler) GetUser(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	if userID == 0 {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	var req GetUserRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	user, err := h.profileLogic.GetPublicProfile(c.Request().Context(), userID, req.ID)
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, PublicProfileResponse{Result: PublicProfileResult{
+		ID:            user.ID,
+		Name:          user.Name,
+		Gender:        user.Gender,
+		Age:           user.Age,
+		ProfileResult: formatProfile(user.Profile),
+	}})
+}
+
+// GetPreferences returns the discovery preferences of the authenticated user
+func (h *ProfileHandler) GetPreferences(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	if userID == 0 {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	preferences, err := h.profileLogic.GetPreferences(c.Request().Context(), userID)
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, PreferencesResponse{Result: formatPreferences(preferences)})
+}
+
+// UpdatePreferences replaces the discovery preferences of the authenticated user
+func (h *ProfileHandler) UpdatePreferences(c echo.Context) error {
+	userID := utils.GetUserIDFromContext(c)
+	if userID == 0 {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+	}
+
+	var req PreferencesRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	genders := make([]constant.UserGender, 0, len(req.Genders))
+	for _, gender := range req.Genders {
+		genders = append(genders, constant.UserGender(gender))
+	}
+	preferences, err := h.profileLogic.UpdatePreferences(c.Request().Context(), userID, model.Preferences{
+		Genders:     genders,
+		MinAge:      req.MinAge,
+		MaxAge:      req.MaxAge,
+		MaxDistance: req.MaxDistance,
+		ShowMe:      *req.ShowMe,
+	})
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, PreferencesResponse{Result: formatPreferences(preferences)})
+}
+
+func (h *ProfileHandler) errorResponse(c echo.Context, err error) error {
+	if errors.Is(err, constant.ErrUserNotFound) {
+		return utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+	}
+	h.logger.Error("Failed to process profile request", zap.Error(err))
+	return utils.ErrorResponse(c, http.StatusInternalServerError, "error processing profile")
+}
+
+func profileOptions(req *UpdateProfileRequest) []profile.ProfileOption {
+	var opts []profile.ProfileOption
+	if req.Bio != nil {
+		opts = append(opts, profile.WithBio(*req.Bio))
+	}
+	if req.JobTitle != nil {
+		opts = append(opts, profile.WithJobTitle(*req.JobTitle))
+	}
+	if req.School != nil {
+		opts = append(opts, profile.WithSchool(*req.School))
+	}
+	if req.Height != nil {
+		opts = append(opts, profile.WithHeight(*req.Height))
+	}
+	if req.Interests != nil {
+		opts = append(opts, profile.WithInterests(*req.Interests))
+	}
+	if req.Prompts != nil {
+		prompts := make([]model.Prompt, 0, len(*req.Prompts))
+		for _, prompt := range *req.Prompts {
+			prompts = append(prompts, model.Prompt{Question: prompt.Question, Answer: prompt.Answer})
+		}
+		opts = append(opts, profile.WithPrompts(prompts))
+	}
+	if req.Photos != nil {
+		photos := make([]model.Photo, 0, len(*req.Photos))
+		for _, photo := range *req.Photos {
+			photos = append(photos, model.Photo{URL: photo.URL, Width: photo.Width, Height: photo.Height})
+		}
+		opts = append(opts, profile.WithPhotos(photos))
+	}
+	return opts
+}
+
+func formatMe(user *model.UserDTO) MeResult {
+	return MeResult{
+		ID:            user.ID,
+		Email:         user.Email,
+		Name:          user.Name,
+		Gender:        user.Gender,
+		DateOfBirth:   user.DateOfBirth.Format(constant.DateOfBirthLayout),
+		Age:           user.Age,
+		Verified:      user.Verified,
+		ProfileResult: formatProfile(user.Profile),
+	}
+}
+
+// formatProfile formats the profile for the responses, a missing profile is returned empty so clients always get the same shape
+func formatProfile(p *model.Profile) ProfileResult {
+	result := ProfileResult{
+		Interests: []string{},
+		Prompts:   []Prompt{},
+		Photos:    []Photo{},
+	}
+	if p == nil {
+		return result
+	}
+	result.Bio = p.Bio
+	result.JobTitle = p.JobTitle
+	result.School = p.School
+	result.Height = p.Height
+	result.Interests = append(result.Interests, p.Interests...)
+	for _, prompt := range p.Prompts {
+		result.Prompts = append(result.Prompts, Prompt{Question: prompt.Question, Answer: prompt.Answer})
+	}
+	for _, photo := range p.Photos {
+		result.Photos = append(result.Photos, Photo{URL: photo.URL, Width: photo.Width, Height: photo.Height})
+	}
+	return result
+}
+
+func formatPreferences(p *model.Preferences) PreferencesResult {
+	return PreferencesResult{
+		Genders:     p.Genders,
+		MinAge:      p.MinAge,
+		MaxAge:      p.MaxAge,
+		MaxDistance: p.MaxDistance,
+		ShowMe:      p.ShowMe,
+	}
+}
@@ -0,0 +1,298 @@
+package profile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/logic/profile"
+	"github.com/a-berahman/dating-app/internal/model"
+	"github.com/go-playground/validator"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type Validator struct {
+	validator *validator.Validate
+}
+
+func (v *Validator) Validate(i interface{}) error {
+	return v.validator.Struct(i)
+}
+
+type MockProfileLogic struct {
+	User        *model.UserDTO
+	Preferences *model.Preferences
+	Err         error
+	Options     int
+}
+
+func (m *MockProfileLogic) GetProfile(ctx context.Context, userID uint) (*model.UserDTO, error) {
+	return m.User, m.Err
+}
+
+func (m *MockProfileLogic) GetPublicProfile(ctx context.Context, viewerID, userID uint) (*model.UserDTO, error) {
+	return m.User, m.Err
+}
+
+func (m *MockProfileLogic) UpdateProfile(ctx context.Context, userID uint, opts ...profile.ProfileOption) (*model.UserDTO, error) {
+	m.Options = len(opts)
+	return m.User, m.Err
+}
+
+func (m *MockProfileLogic) GetPreferences(ctx context.Context, userID uint) (*model.Preferences, error) {
+	return m.Preferences, m.Err
+}
+
+func (m *MockProfileLogic) UpdatePreferences(ctx context.Context, userID uint, preferences model.Preferences) (*model.Preferences, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.Preferences = &preferences
+	return m.Preferences, nil
+}
+
+func testUser() *model.UserDTO {
+	height := 180
+	return &model.UserDTO{
+		ID:          1,
+		Email:       "user@example.com",
+		Name:        "test name",
+		Gender:      constant.UserGenderMale,
+		DateOfBirth: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
+		Age:         30,
+		Verified:    true,
+		Profile: &model.Profile{
+			Bio:       "hello",
+			Height:    &height,
+			Interests: []string{"hiking"},
+		},
+	}
+}
+
+func TestProfileHandler_UpdateMe(t *testing.T) {
+	e := echo.New()
+	e.Validator = &Validator{validator: validator.New()}
+
+	tests := []struct {
+		name            string
+		body            string
+		setupMock       *MockProfileLogic
+		expectedStatus  int
+		expectedOptions int
+	}{
+		{
+			name:            "Partial Update",
+			body:            `{"bio":"hello","height":180,"interests":["hiking"]}`,
+			setupMock:       &MockProfileLogic{User: testUser()},
+			expectedStatus:  http.StatusOK,
+			expectedOptions: 3,
+		},
+		{
+			name:            "Remove Height",
+			body:            `{"height":0}`,
+			setupMock:       &MockProfileLogic{User: testUser()},
+			expectedStatus:  http.StatusOK,
+			expectedOptions: 1,
+		},
+		{
+			name:           "Height Out Of Range",
+			body:           `{"height":30}`,
+			setupMock:      &MockProfileLogic{User: testUser()},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Bio Too Long",
+			body:           `{"bio":"` + strings.Repeat("a", 501) + `"}`,
+			setupMock:      &MockProfileLogic{User: testUser()},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Interest Too Long",
+			body:           `{"interests":["` + strings.Repeat("a", 31) + `"]}`,
+			setupMock:      &MockProfileLogic{User: testUser()},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Too Many Prompts",
+			body:           `{"prompts":[{"question":"a","answer":"b"},{"question":"a","answer":"b"},{"question":"a","answer":"b"},{"question":"a","answer":"b"}]}`,
+			setupMock:      &MockProfileLogic{User: testUser()},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid Photo URL",
+			body:           `{"photos":[{"url":"not a url"}]}`,
+			setupMock:      &MockProfileLogic{User: testUser()},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:            "Internal Error",
+			body:            `{"bio":"hello"}`,
+			setupMock:       &MockProfileLogic{Err: errors.New("database error")},
+			expectedStatus:  http.StatusInternalServerError,
+			expectedOptions: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, _ := zap.NewDevelopment()
+			handler := New(tt.setupMock, logger)
+
+			req := httptest.NewRequest(http.MethodPatch, "/me", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("userID", uint(1))
+
+			if assert.NoError(t, handler.UpdateMe(c)) {
+				assert.Equal(t, tt.expectedStatus, rec.Code)
+				assert.Equal(t, tt.expectedOptions, tt.setupMock.Options)
+			}
+		})
+	}
+}
+
+func TestProfileHandler_GetMe(t *testing.T) {
+	e := echo.New()
+	e.Validator = &Validator{validator: validator.New()}
+	logger, _ := zap.NewDevelopment()
+
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("userID", uint(1))
+
+	handler := New(&MockProfileLogic{User: testUser()}, logger)
+	if assert.NoError(t, handler.GetMe(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"result":{"id":1,"email":"user@example.com","name":"test name","gender":"MALE","dateOfBirth":"1990-01-01","age":30,"verified":true,
+			"bio":"hello","jobTitle":"","school":"","height":180,"interests":["hiking"],"prompts":[],"photos":[]}}`, rec.Body.String())
+	}
+}
+
+func TestProfileHandler_GetUser(t *testing.T) {
+	e := echo.New()
+	e.Validator = &Validator{validator: validator.New()}
+
+	tests := []struct {
+		name           string
+		id             string
+		setupMock      *MockProfileLogic
+		expectedStatus int
+	}{
+		{
+			name:           "Public Profile",
+			id:             "1",
+			setupMock:      &MockProfileLogic{User: testUser()},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "User Not Found",
+			id:             "2",
+			setupMock:      &MockProfileLogic{Err: constant.ErrUserNotFound},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Invalid ID",
+			id:             "abc",
+			setupMock:      &MockProfileLogic{User: testUser()},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, _ := zap.NewDevelopment()
+			handler := New(tt.setupMock, logger)
+
+			req := httptest.NewRequest(http.MethodGet, "/users/"+tt.id, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("userID", uint(2))
+			c.SetParamNames("id")
+			c.SetParamValues(tt.id)
+
+			if assert.NoError(t, handler.GetUser(c)) {
+				assert.Equal(t, tt.expectedStatus, rec.Code)
+				if tt.expectedStatus == http.StatusOK {
+					var resp map[string]map[string]interface{}
+					assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+					assert.NotContains(t, resp["result"], "email")
+					assert.Equal(t, "hello", resp["result"]["bio"])
+				}
+			}
+		})
+	}
+}
+
+func TestProfileHandler_UpdatePreferences(t *testing.T) {
+	e := echo.New()
+	v := validator.New()
+	v.RegisterValidation("gender", func(fl validator.FieldLevel) bool {
+		gender := fl.Field().String()
+		return gender == "MALE" || gender == "FEMALE"
+	})
+	e.Validator = &Validator{validator: v}
+
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      *MockProfileLogic
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Update Preferences",
+			body:           `{"genders":["FEMALE"],"minAge":25,"maxAge":35,"maxDistance":10000,"showMe":false}`,
+			setupMock:      &MockProfileLogic{},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":{"genders":["FEMALE"],"minAge":25,"maxAge":35,"maxDistance":10000,"showMe":false}}`,
+		},
+		{
+			name:           "Invalid Gender",
+			body:           `{"genders":["OTHER"],"minAge":25,"maxAge":35,"maxDistance":10000,"showMe":true}`,
+			setupMock:      &MockProfileLogic{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Max Age Below Min Age",
+			body:           `{"minAge":35,"maxAge":25,"maxDistance":10000,"showMe":true}`,
+			setupMock:      &MockProfileLogic{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Missing Show Me",
+			body:           `{"minAge":25,"maxAge":35,"maxDistance":10000}`,
+			setupMock:      &MockProfileLogic{},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, _ := zap.NewDevelopment()
+			handler := New(tt.setupMock, logger)
+
+			req := httptest.NewRequest(http.MethodPut, "/me/preferences", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("userID", uint(1))
+
+			if assert.NoError(t, handler.UpdatePreferences(c)) {
+				assert.Equal(t, tt.expectedStatus, rec.Code)
+				if tt.expectedBody != "" {
+					assert.JSONEq(t, tt.expectedBody, rec.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package swipe
 
 import (
+	"errors"
 	"net/http"
 
+	"github.com/a-berahman/dating-app/constant"
 	"github.com/a-berahman/dating-app/internal/logic"
 	"github.com/a-berahman/dating-app/pkg/decode"
 	"github.com/a-berahman/dating-app/pkg/utils"
@@ -39,6 +41,16 @@ func (sh *SwipeHandler) Swipe(c echo.Context) error {
 	// process the swipe
 	matched, matchID, err := sh.swipeLogic.ProcessSwipe(c.Request().Context(), userID, req.TargetUserID, req.Preference == "YES")
 	if err != nil {
+		switch {
+		case errors.Is(err, constant.ErrSelfSwipe):
+			return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		case errors.Is(err, constant.ErrEmailNotVerified), errors.Is(err, constant.ErrTargetBlocked):
+			return utils.ErrorResponse(c, http.StatusForbidden, err.Error())
+		case errors.Is(err, constant.ErrTargetNotFound), errors.Is(err, constant.ErrTargetNotVerified):
+			return utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		case errors.Is(err, constant.ErrSwipeConflict):
+			return utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		}
 		sh.logger.Error("Failed to process swipe", zap.Error(err))
 		return utils.ErrorResponse(c, http.StatusInternalServerError, "error processing swipe")
 	}
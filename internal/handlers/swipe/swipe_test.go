@@ -8,6 +8,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/a-berahman/dating-app/constant"
 	"github.com/a-berahman/dating-app/internal/logic"
 	"github.com/go-playground/validator"
 	"github.com/labstack/echo/v4"
@@ -73,6 +74,48 @@ func TestSwipe(t *testing.T) {
 			expectedStatus: http.StatusInternalServerError,
 			expectedBody:   `{"error":"error processing swipe"}`,
 		},
+		{
+			name:           "Unverified Swiper",
+			requestBody:    `{"targetUserId": 2, "preference": "YES"}`,
+			setupMock:      &MockSwipeLogic{Err: constant.ErrEmailNotVerified},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"error":"email is not verified"}`,
+		},
+		{
+			name:           "Unverified Target",
+			requestBody:    `{"targetUserId": 2, "preference": "YES"}`,
+			setupMock:      &MockSwipeLogic{Err: constant.ErrTargetNotVerified},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"target user is not available"}`,
+		},
+		{
+			name:           "Self Swipe",
+			requestBody:    `{"targetUserId": 1, "preference": "YES"}`,
+			setupMock:      &MockSwipeLogic{Err: constant.ErrSelfSwipe},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"cannot swipe on yourself"}`,
+		},
+		{
+			name:           "Target Not Found",
+			requestBody:    `{"targetUserId": 99, "preference": "YES"}`,
+			setupMock:      &MockSwipeLogic{Err: constant.ErrTargetNotFound},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"target user not found"}`,
+		},
+		{
+			name:           "Target Blocked",
+			requestBody:    `{"targetUserId": 2, "preference": "YES"}`,
+			setupMock:      &MockSwipeLogic{Err: constant.ErrTargetBlocked},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"error":"target user does not accept swipes"}`,
+		},
+		{
+			name:           "Second Swipe Rejected",
+			requestBody:    `{"targetUserId": 2, "preference": "NO"}`,
+			setupMock:      &MockSwipeLogic{Err: constant.ErrSwipeConflict},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"error":"already swiped on this user"}`,
+		},
 	}
 
 	e := echo.New()
@@ -0,0 +1,42 @@
+package user
+
+// RegisterRequest defines the structure of the request for the user registration
+type RegisterRequest struct {
+	Email       string    `json:"email" validate:"required,email"`
+	Password    string    `json:"password" validate:"required,password"`
+	Name        string    `json:"name" validate:"required,max=100"`
+	Gender      string    `json:"gender" validate:"required,gender"`
+	DateOfBirth string    `json:"dateOfBirth" validate:"required,adult"`
+	Location    *Location `json:"location" validate:"required"`
+}
+
+// Location is the coordinate of the user at the registration time, it is required since the discovery
+// falls back to it when no location is given
+type Location struct {
+	Latitude  float64 `json:"lat" validate:"gte=-90,lte=90"`
+	Longitude float64 `json:"lng" validate:"gte=-180,lte=180"`
+}
+
+// UserResult is the public information of a registered user
+type UserResult struct {
+	ID     uint   `json:"id"`
+	Email  string `json:"email"`
+	Name   string `json:"name"`
+	Gender string `json:"gender"`
+	Age    int    `json:"age"`
+}
+
+// UserResponse defines the structure of the response for the user registration
+type UserResponse struct {
+	Result UserResult `json:"result"`
+}
+
+// VerifyEmailRequest defines the structure of the request sent by the link of the verification email
+type VerifyEmailRequest struct {
+	Token string `query:"token" validate:"required"`
+}
+
+// ResendVerificationRequest defines the structure of the request to receive a new verification email
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
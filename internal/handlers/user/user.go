@@ -1,10 +1,14 @@
 package user
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
+	"github.com/a-berahman/dating-app/constant"
 	"github.com/a-berahman/dating-app/internal/logic"
 	"github.com/a-berahman/dating-app/internal/logic/user"
+	"github.com/a-berahman/dating-app/pkg/decode"
 	"github.com/a-berahman/dating-app/pkg/utils"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
@@ -33,8 +37,12 @@ func (h *UserHandler) CreateFakeUser(c echo.Context) error {
 		user.WithName(fakeUser.Name),
 		user.WithGender(fakeUser.Gender),
 		user.WithDOB(fakeUser.DateOfBirth),
-		user.WithLocation(fakeUser.Latitude, fakeUser.Longitude))
+		user.WithLocation(fakeUser.Latitude, fakeUser.Longitude),
+		user.WithVerified())
 	if err != nil {
+		if errors.Is(err, constant.ErrEmailInUse) {
+			return utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		}
 		h.logger.Error("Failed to create fake user", zap.Error(err))
 		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to create fake user")
 	}
@@ -50,3 +58,74 @@ func (h *UserHandler) CreateFakeUser(c echo.Context) error {
 		},
 	})
 }
+
+// RegisterUser registers a user with the information provided in the request body
+func (h *UserHandler) RegisterUser(c echo.Context) error {
+	var req RegisterRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	dob, err := time.Parse(constant.DateOfBirthLayout, req.DateOfBirth)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "invalid date of birth")
+	}
+
+	userID, err := h.userLogic.RegisterUser(c.Request().Context(),
+		user.WithEmail(req.Email),
+		user.WithPassword(req.Password),
+		user.WithName(req.Name),
+		user.WithGender(constant.UserGender(req.Gender)),
+		user.WithDOB(dob),
+		user.WithLocation(req.Location.Latitude, req.Location.Longitude))
+	if err != nil {
+		if errors.Is(err, constant.ErrEmailInUse) {
+			return utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		}
+		h.logger.Error("Failed to register user", zap.Error(err))
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to register user")
+	}
+
+	return c.JSON(http.StatusCreated, UserResponse{
+		Result: UserResult{
+			ID:     userID,
+			Email:  utils.NormalizeEmail(req.Email),
+			Name:   req.Name,
+			Gender: req.Gender,
+			Age:    utils.CalculateAge(dob),
+		},
+	})
+}
+
+// VerifyEmail verifies the email of a user with the token of the link sent by email
+func (h *UserHandler) VerifyEmail(c echo.Context) error {
+	var req VerifyEmailRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	if err := h.userLogic.VerifyEmail(c.Request().Context(), req.Token); err != nil {
+		if errors.Is(err, constant.ErrInvalidVerificationToken) {
+			return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+		h.logger.Error("Failed to verify email", zap.Error(err))
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to verify email")
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "email verified"})
+}
+
+// ResendVerification sends a new verification email, it answers the same way whether the email is registered or not
+func (h *UserHandler) ResendVerification(c echo.Context) error {
+	var req ResendVerificationRequest
+	if err := decode.DecodeAndValidateRequest(c.Request().Context(), &req, &decode.EchoDecoder{C: c}, &decode.EchoValidator{C: c}); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	if err := h.userLogic.ResendVerification(c.Request().Context(), req.Email); err != nil {
+		h.logger.Error("Failed to resend verification email", zap.Error(err))
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to process the request")
+	}
+
+	return c.JSON(http.StatusAccepted, echo.Map{"message": "if the email is registered and not verified a verification link has been sent"})
+}
@@ -5,10 +5,14 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/a-berahman/dating-app/constant"
 	"github.com/a-berahman/dating-app/internal/logic"
 	"github.com/a-berahman/dating-app/internal/logic/user"
+	"github.com/go-playground/validator"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
@@ -24,6 +28,14 @@ func (m *MockUserLogic) RegisterUser(ctx context.Context, opts ...user.UserOptio
 	return m.UserID, m.Err
 }
 
+func (m *MockUserLogic) VerifyEmail(ctx context.Context, token string) error {
+	return m.Err
+}
+
+func (m *MockUserLogic) ResendVerification(ctx context.Context, email string) error {
+	return m.Err
+}
+
 func TestRegisterUser(t *testing.T) {
 	e := echo.New()
 
@@ -42,6 +54,11 @@ func TestRegisterUser(t *testing.T) {
 			setupMock:      &MockUserLogic{UserID: 1, Err: errors.New("error")},
 			expectedStatus: http.StatusInternalServerError,
 		},
+		{
+			name:           "Email Already In Use",
+			setupMock:      &MockUserLogic{UserID: 0, Err: constant.ErrEmailInUse},
+			expectedStatus: http.StatusConflict,
+		},
 	}
 
 	for _, tt := range tests {
@@ -60,3 +77,149 @@ func TestRegisterUser(t *testing.T) {
 		})
 	}
 }
+
+func TestRegisterUserWithPayload(t *testing.T) {
+	e := echo.New()
+	v := validator.New()
+	v.RegisterValidation("gender", func(fl validator.FieldLevel) bool {
+		gender := fl.Field().String()
+		return gender == "MALE" || gender == "FEMALE"
+	})
+	v.RegisterValidation("password", func(fl validator.FieldLevel) bool {
+		return len(fl.Field().String()) >= constant.MinPasswordLength
+	})
+	v.RegisterValidation("adult", func(fl validator.FieldLevel) bool {
+		dob, err := time.Parse(constant.DateOfBirthLayout, fl.Field().String())
+		return err == nil && dob.Before(time.Now().AddDate(-constant.MinimumUserAge, 0, 0))
+	})
+	e.Validator = &Validator{validator: v}
+
+	tests := []struct {
+		name           string
+		requestBody    string
+		setupMock      logic.UserInterface
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Successful Registration",
+			requestBody:    `{"email":"Jane@Example.com","password":"Secr3tPass","name":"Jane","gender":"FEMALE","dateOfBirth":"1990-05-01","location":{"lat":52.52,"lng":13.40}}`,
+			setupMock:      &MockUserLogic{UserID: 7},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `"id":7,"email":"jane@example.com"`,
+		},
+		{
+			name:           "Missing Location",
+			requestBody:    `{"email":"jane@example.com","password":"Secr3tPass","name":"Jane","gender":"FEMALE","dateOfBirth":"1990-05-01"}`,
+			setupMock:      &MockUserLogic{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `'Location' failed on the 'required' tag`,
+		},
+		{
+			name:           "Underage User",
+			requestBody:    `{"email":"kid@example.com","password":"Secr3tPass","name":"Kid","gender":"MALE","dateOfBirth":"` + time.Now().AddDate(-10, 0, 0).Format(constant.DateOfBirthLayout) + `","location":{"lat":52.52,"lng":13.40}}`,
+			setupMock:      &MockUserLogic{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `'adult' tag`,
+		},
+		{
+			name:           "Latitude Out Of Bounds",
+			requestBody:    `{"email":"jane@example.com","password":"Secr3tPass","name":"Jane","gender":"FEMALE","dateOfBirth":"1990-05-01","location":{"lat":95,"lng":13.40}}`,
+			setupMock:      &MockUserLogic{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `'Latitude' failed on the 'lte' tag`,
+		},
+		{
+			name:           "Email Already In Use",
+			requestBody:    `{"email":"jane@example.com","password":"Secr3tPass","name":"Jane","gender":"FEMALE","dateOfBirth":"1990-05-01","location":{"lat":52.52,"lng":13.40}}`,
+			setupMock:      &MockUserLogic{Err: constant.ErrEmailInUse},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `email already in use`,
+		},
+		{
+			name:           "Internal Error",
+			requestBody:    `{"email":"jane@example.com","password":"Secr3tPass","name":"Jane","gender":"FEMALE","dateOfBirth":"1990-05-01","location":{"lat":52.52,"lng":13.40}}`,
+			setupMock:      &MockUserLogic{Err: errors.New("database error")},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `failed to register user`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, _ := zap.NewDevelopment()
+			handler := New(tt.setupMock, logger)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/users", strings.NewReader(tt.requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			if assert.NoError(t, handler.RegisterUser(c)) {
+				assert.Equal(t, tt.expectedStatus, rec.Code)
+				assert.Contains(t, rec.Body.String(), tt.expectedBody)
+				assert.NotContains(t, rec.Body.String(), "password")
+			}
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	e := echo.New()
+	e.Validator = &Validator{validator: validator.New()}
+
+	tests := []struct {
+		name           string
+		target         string
+		setupMock      logic.UserInterface
+		expectedStatus int
+	}{
+		{
+			name:           "Successful Verification",
+			target:         "/verify-email?token=abc",
+			setupMock:      &MockUserLogic{},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Missing Token",
+			target:         "/verify-email",
+			setupMock:      &MockUserLogic{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid Token",
+			target:         "/verify-email?token=abc",
+			setupMock:      &MockUserLogic{Err: constant.ErrInvalidVerificationToken},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Internal Error",
+			target:         "/verify-email?token=abc",
+			setupMock:      &MockUserLogic{Err: errors.New("database error")},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, _ := zap.NewDevelopment()
+			handler := New(tt.setupMock, logger)
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			if assert.NoError(t, handler.VerifyEmail(c)) {
+				assert.Equal(t, tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+type Validator struct {
+	validator *validator.Validate
+}
+
+func (v *Validator) Validate(i interface{}) error {
+	return v.validator.Struct(i)
+}
@@ -1,7 +1,6 @@
 package auth
 
 import (
-	"cmp"
 	"context"
 	"os"
 	"time"
@@ -9,6 +8,9 @@ import (
 	"github.com/a-berahman/dating-app/constant"
 	"github.com/a-berahman/dating-app/internal/model"
 	"github.com/a-berahman/dating-app/internal/repository"
+	hash "github.com/a-berahman/dating-app/pkg/hash"
+	"github.com/a-berahman/dating-app/pkg/keyring"
+	"github.com/a-berahman/dating-app/pkg/utils"
 	"github.com/golang-jwt/jwt"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -16,48 +18,224 @@ import (
 )
 
 type AuthLogic struct {
-	userRepo repository.UserRepository
-	logger   *zap.Logger
+	userRepo    repository.UserRepository
+	tokenRepo   repository.TokenRepository
+	mfaRepo     repository.MFARepository
+	revocations *RevocationStore
+	throttle    *LoginThrottle
+	keys        *keyring.Keyring
+	logger      *zap.Logger
 }
 
-func NewAuthLogic(userRepo repository.UserRepository, logger *zap.Logger) *AuthLogic {
+func NewAuthLogic(userRepo repository.UserRepository, tokenRepo repository.TokenRepository, mfaRepo repository.MFARepository, revocations *RevocationStore, throttle *LoginThrottle, keys *keyring.Keyring, logger *zap.Logger) *AuthLogic {
 	return &AuthLogic{
-		userRepo: userRepo,
-		logger:   logger,
+		userRepo:    userRepo,
+		tokenRepo:   tokenRepo,
+		mfaRepo:     mfaRepo,
+		revocations: revocations,
+		throttle:    throttle,
+		keys:        keys,
+		logger:      logger,
 	}
 }
 
-func (al *AuthLogic) GenerateToken(ctx context.Context, email, password string) (string, error) {
+// GenerateToken authenticates the user and issues an access token with a refresh token of a new token family,
+// users with two-factor authentication only get an MFA token that VerifyMFA exchanges for the tokens.
+// Repeated logins of the email or from the client IP are throttled before the password is checked
+func (al *AuthLogic) GenerateToken(ctx context.Context, email, password, clientIP string) (*model.TokenPair, error) {
+	if err := al.throttle.Attempt(ctx, email, clientIP); err != nil {
+		return nil, err
+	}
+
 	user, err := al.userRepo.Authenticate(ctx, email, password)
 	if err != nil {
-		al.logger.Error("Failed to authenticate user", zap.String("email", email), zap.Error(err))
-		return "", errors.Wrap(err, "authentication failed")
+		if errors.Is(err, constant.ErrInvalidCredentials) {
+			al.logger.Info("Failed login attempt")
+			return nil, err
+		}
+		al.logger.Error("Failed to authenticate user", zap.Error(err))
+		return nil, errors.Wrap(err, "authentication failed")
+	}
+	if err := al.throttle.Succeeded(ctx, email, clientIP); err != nil {
+		al.logger.Error("Failed to reset login attempts", zap.Uint("userID", user.ID), zap.Error(err))
 	}
 
-	duration := constant.JWT_DEFAULT_DURATION_VALUE
-	if os.Getenv(constant.JWT_CONFIG_DURATION_KEY) != "" {
-		d, err := time.ParseDuration(os.Getenv(constant.JWT_CONFIG_DURATION_KEY))
-		if err != nil {
-			return "", errors.Wrap(err, "failed to parse the duration")
-		}
-		duration = d
+	credential, err := al.mfaRepo.FindTOTPCredential(ctx, user.ID)
+	if err != nil {
+		al.logger.Error("Failed to find totp credential", zap.Uint("userID", user.ID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to find the totp credential")
+	}
+	if credential != nil && credential.ConfirmedAt != nil {
+		return al.issueMFAToken(user.ID)
 	}
 
-	expirationTime := time.Now().Add(duration)
+	return al.startSession(ctx, user.ID)
+}
+
+// startSession issues the tokens of a new login
+func (al *AuthLogic) startSession(ctx context.Context, userID uint) (*model.TokenPair, error) {
+	familyID, err := utils.GenerateRandomToken(constant.RefreshTokenSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate the token family")
+	}
+
+	return al.issueTokenPair(ctx, userID, familyID)
+}
+
+// RefreshToken rotates a refresh token, presenting an already used refresh token revokes its whole family
+func (al *AuthLogic) RefreshToken(ctx context.Context, refreshToken string) (*model.TokenPair, error) {
+	stored, err := al.tokenRepo.FindRefreshToken(ctx, hash.SHA256(refreshToken))
+	if err != nil {
+		al.logger.Error("Failed to find refresh token", zap.Error(err))
+		return nil, errors.Wrap(err, "failed to find the refresh token")
+	}
+	if stored == nil || stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, constant.ErrInvalidRefreshToken
+	}
+	if stored.UsedAt != nil {
+		return nil, al.revokeReusedFamily(ctx, stored)
+	}
+
+	marked, err := al.tokenRepo.MarkRefreshTokenUsed(ctx, stored.ID)
+	if err != nil {
+		al.logger.Error("Failed to mark refresh token as used", zap.Error(err))
+		return nil, errors.Wrap(err, "failed to rotate the refresh token")
+	}
+	if !marked {
+		// another request rotated the same token in the meantime
+		return nil, al.revokeReusedFamily(ctx, stored)
+	}
+
+	return al.issueTokenPair(ctx, stored.UserID, stored.FamilyID)
+}
+
+// Logout revokes the access token of the claims and the refresh token family of the session if it is given
+func (al *AuthLogic) Logout(ctx context.Context, claims *model.Claims, refreshToken string) error {
+	if err := al.revocations.Revoke(ctx, claims); err != nil {
+		return err
+	}
+	if refreshToken == "" {
+		return nil
+	}
+
+	stored, err := al.tokenRepo.FindRefreshToken(ctx, hash.SHA256(refreshToken))
+	if err != nil {
+		al.logger.Error("Failed to find refresh token", zap.Error(err))
+		return errors.Wrap(err, "failed to find the refresh token")
+	}
+	if stored == nil || stored.UserID != claims.UserID {
+		return nil
+	}
+	if err := al.tokenRepo.RevokeRefreshTokenFamily(ctx, stored.FamilyID); err != nil {
+		al.logger.Error("Failed to revoke refresh token family", zap.Error(err))
+		return errors.Wrap(err, "failed to revoke the token family")
+	}
+	return nil
+}
+
+// LogoutAll invalidates every access token issued to the user so far and revokes all of their refresh tokens
+func (al *AuthLogic) LogoutAll(ctx context.Context, userID uint) error {
+	if err := al.revocations.RevokeAll(ctx, userID); err != nil {
+		return err
+	}
+	if err := al.tokenRepo.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		al.logger.Error("Failed to revoke refresh tokens", zap.Uint("userID", userID), zap.Error(err))
+		return errors.Wrap(err, "failed to revoke the refresh tokens")
+	}
+	al.logger.Info("User logged out of all sessions", zap.Uint("userID", userID))
+	return nil
+}
+
+func (al *AuthLogic) revokeReusedFamily(ctx context.Context, stored *repository.RefreshToken) error {
+	al.logger.Warn("Refresh token reuse detected, revoking the token family", zap.Uint("userID", stored.UserID), zap.String("familyID", stored.FamilyID))
+	if err := al.tokenRepo.RevokeRefreshTokenFamily(ctx, stored.FamilyID); err != nil {
+		al.logger.Error("Failed to revoke refresh token family", zap.Error(err))
+		return errors.Wrap(err, "failed to revoke the token family")
+	}
+	return constant.ErrRefreshTokenReused
+}
+
+func (al *AuthLogic) issueTokenPair(ctx context.Context, userID uint, familyID string) (*model.TokenPair, error) {
+	accessToken, expirationTime, err := al.signAccessToken(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshDuration, err := durationFromEnv(constant.JWT_CONFIG_REFRESH_DURATION_KEY, constant.JWT_DEFAULT_REFRESH_DURATION_VALUE)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the refresh duration")
+	}
+	refreshToken, err := utils.GenerateRandomToken(constant.RefreshTokenSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate the refresh token")
+	}
+	if err := al.tokenRepo.CreateRefreshToken(ctx, &repository.RefreshToken{
+		UserID:    userID,
+		TokenHash: hash.SHA256(refreshToken),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(refreshDuration),
+	}); err != nil {
+		al.logger.Error("Failed to store refresh token", zap.Error(err))
+		return nil, errors.Wrap(err, "failed to store the refresh token")
+	}
+	// a login or a refresh is the activity that the discovery sorts recently active users by
+	if err := al.userRepo.UpdateLastActive(ctx, userID, time.Now()); err != nil {
+		al.logger.Error("Failed to update last active", zap.Uint("userID", userID), zap.Error(err))
+	}
+
+	return &model.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expirationTime,
+	}, nil
+}
+
+func (al *AuthLogic) signAccessToken(userID uint) (string, time.Time, error) {
+	duration, err := durationFromEnv(constant.JWT_CONFIG_DURATION_KEY, constant.JWT_DEFAULT_DURATION_VALUE)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "failed to parse the duration")
+	}
+	return al.signToken(userID, duration, false)
+}
+
+func (al *AuthLogic) signToken(userID uint, duration time.Duration, mfaPending bool) (string, time.Time, error) {
+	tokenID, err := utils.GenerateRandomToken(constant.TokenIDSize)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "failed to generate the token id")
+	}
+
+	now := time.Now()
+	expirationTime := now.Add(duration)
 	claims := &model.Claims{
 		StandardClaims: jwt.StandardClaims{
+			Id:        tokenID,
+			IssuedAt:  now.Unix(),
 			ExpiresAt: expirationTime.Unix(),
 		},
-		UserID: user.ID,
+		UserID:        userID,
+		IssuedAtMilli: now.UnixMilli(),
+		MFAPending:    mfaPending,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(cmp.Or(os.Getenv(constant.JWT_CONFIG_SECRET_KEY), constant.JWT_DEFAULT_SECRET_VALUE)))
+	tokenString, err := al.keys.Sign(claims)
 	if err != nil {
 		al.logger.Error("Failed to sign token", zap.Error(err))
-		return "", errors.Wrap(err, "failed to sign the token")
+		return "", time.Time{}, errors.Wrap(err, "failed to sign the token")
 	}
 
-	al.logger.Debug("Token generated", zap.String("token", tokenString), zap.Time("expires", expirationTime), zapcore.Field{Key: "userId", Type: zapcore.Uint64Type, Integer: int64(user.ID)})
-	return tokenString, nil
+	al.logger.Debug("Token generated", zap.Time("expires", expirationTime), zapcore.Field{Key: "userId", Type: zapcore.Uint64Type, Integer: int64(userID)})
+	return tokenString, expirationTime, nil
+}
+
+// PublicKeys returns the keys that verify the access tokens so other services can validate them
+func (al *AuthLogic) PublicKeys() keyring.JWKSet {
+	return al.keys.JWKS()
+}
+
+// durationFromEnv reads a duration from the environment and falls back to the default value when it is not set
+func durationFromEnv(key string, defaultValue time.Duration) (time.Duration, error) {
+	if os.Getenv(key) == "" {
+		return defaultValue, nil
+	}
+	return time.ParseDuration(os.Getenv(key))
 }
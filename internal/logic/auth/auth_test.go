@@ -2,12 +2,21 @@ package auth
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/model"
 	"github.com/a-berahman/dating-app/internal/repository"
+	hash "github.com/a-berahman/dating-app/pkg/hash"
+	"github.com/a-berahman/dating-app/pkg/keyring"
+	"github.com/a-berahman/dating-app/pkg/lockout"
+	"github.com/a-berahman/dating-app/pkg/totp"
+	"github.com/golang-jwt/jwt"
 
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
@@ -30,6 +39,134 @@ func (m *MockUserRepository) Create(ctx context.Context, email, password, name s
 func (m *MockUserRepository) FindByEmail(ctx context.Context, email string) (*repository.User, error) {
 	return nil, nil
 }
+func (m *MockUserRepository) FindByID(ctx context.Context, id uint) (*repository.User, error) {
+	return m.User, m.Err
+}
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, userID uint, password string) error {
+	return m.Err
+}
+func (m *MockUserRepository) MarkVerified(ctx context.Context, userID uint) error {
+	return m.Err
+}
+func (m *MockUserRepository) UpdateLocation(ctx context.Context, userID uint, lat, lng float64) error {
+	return m.Err
+}
+func (m *MockUserRepository) UpdateLastActive(ctx context.Context, userID uint, activeAt time.Time) error {
+	if m.User != nil {
+		m.User.LastActiveAt = &activeAt
+	}
+	return nil
+}
+func (m *MockUserRepository) SetTokensValidAfter(ctx context.Context, userID uint, validAfter time.Time) error {
+	if m.User != nil {
+		m.User.TokensValidAfter = &validAfter
+	}
+	return m.Err
+}
+
+type MockTokenRepository struct {
+	Stored          *repository.RefreshToken
+	Marked          bool
+	Err             error
+	Created         []*repository.RefreshToken
+	RevokedFamilies []string
+	RevokedUsers    []uint
+	RevokedTokens   map[string]bool
+	RevokedLookups  int
+}
+
+func (m *MockTokenRepository) CreateRefreshToken(ctx context.Context, token *repository.RefreshToken) error {
+	m.Created = append(m.Created, token)
+	return m.Err
+}
+func (m *MockTokenRepository) FindRefreshToken(ctx context.Context, tokenHash string) (*repository.RefreshToken, error) {
+	return m.Stored, m.Err
+}
+func (m *MockTokenRepository) MarkRefreshTokenUsed(ctx context.Context, id uint) (bool, error) {
+	return m.Marked, m.Err
+}
+func (m *MockTokenRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	m.RevokedFamilies = append(m.RevokedFamilies, familyID)
+	return m.Err
+}
+
+func (m *MockTokenRepository) RevokeUserRefreshTokens(ctx context.Context, userID uint) error {
+	m.RevokedUsers = append(m.RevokedUsers, userID)
+	return m.Err
+}
+func (m *MockTokenRepository) RevokeAccessToken(ctx context.Context, token *repository.RevokedToken) error {
+	if m.RevokedTokens == nil {
+		m.RevokedTokens = make(map[string]bool)
+	}
+	m.RevokedTokens[token.JTI] = true
+	return m.Err
+}
+func (m *MockTokenRepository) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	m.RevokedLookups++
+	return m.RevokedTokens[jti], m.Err
+}
+
+type MockMFARepository struct {
+	Credential    *repository.TOTPCredential
+	RecoveryCodes map[string]bool // hash of the recovery codes to whether they have been used
+	Err           error
+}
+
+func (m *MockMFARepository) FindTOTPCredential(ctx context.Context, userID uint) (*repository.TOTPCredential, error) {
+	return m.Credential, m.Err
+}
+func (m *MockMFARepository) SaveTOTPCredential(ctx context.Context, credential *repository.TOTPCredential) error {
+	m.Credential = credential
+	return m.Err
+}
+func (m *MockMFARepository) ConfirmTOTPCredential(ctx context.Context, userID uint, step int64) error {
+	now := time.Now()
+	m.Credential.ConfirmedAt = &now
+	m.Credential.LastUsedStep = step
+	return m.Err
+}
+func (m *MockMFARepository) UseTOTPStep(ctx context.Context, userID uint, step int64) (bool, error) {
+	if m.Credential.LastUsedStep >= step {
+		return false, m.Err
+	}
+	m.Credential.LastUsedStep = step
+	return true, m.Err
+}
+func (m *MockMFARepository) ReplaceRecoveryCodes(ctx context.Context, userID uint, codeHashes []string) error {
+	m.RecoveryCodes = make(map[string]bool, len(codeHashes))
+	for _, codeHash := range codeHashes {
+		m.RecoveryCodes[codeHash] = false
+	}
+	return m.Err
+}
+func (m *MockMFARepository) UseRecoveryCode(ctx context.Context, userID uint, codeHash string) (bool, error) {
+	used, ok := m.RecoveryCodes[codeHash]
+	if !ok || used {
+		return false, m.Err
+	}
+	m.RecoveryCodes[codeHash] = true
+	return true, m.Err
+}
+
+type MockLockoutRepository struct {
+	Events []*repository.LockoutEvent
+}
+
+func (m *MockLockoutRepository) RecordLockout(ctx context.Context, event *repository.LockoutEvent) error {
+	m.Events = append(m.Events, event)
+	return nil
+}
+
+func newTestThrottle(logger *zap.Logger) *LoginThrottle {
+	return NewLoginThrottle(lockout.NewMemoryStore(time.Hour), &MockLockoutRepository{}, logger)
+}
+
+func newTestKeyring(t *testing.T) *keyring.Keyring {
+	keys, err := keyring.NewEphemeral()
+	assert.NoError(t, err)
+	return keys
+}
+
 func TestGenerateToken(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
 	tests := []struct {
@@ -71,16 +208,341 @@ func TestGenerateToken(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			authLogic := NewAuthLogic(tt.setupMock, logger)
+			tokenRepo := &MockTokenRepository{}
+			authLogic := NewAuthLogic(tt.setupMock, tokenRepo, &MockMFARepository{}, NewRevocationStore(tt.setupMock, tokenRepo, logger), newTestThrottle(logger), newTestKeyring(t), logger)
 
-			token, err := authLogic.GenerateToken(context.Background(), tt.email, tt.password)
+			tokens, err := authLogic.GenerateToken(context.Background(), tt.email, tt.password, "127.0.0.1")
 
 			if tt.expectError {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
-				assert.NotEmpty(t, token, "Token should not be empty")
+				assert.NotEmpty(t, tokens.AccessToken, "Token should not be empty")
+				assert.NotEmpty(t, tokens.RefreshToken, "Refresh token should not be empty")
+				token, err := jwt.ParseWithClaims(tokens.AccessToken, &model.Claims{}, authLogic.keys.Keyfunc)
+				if assert.NoError(t, err) {
+					assert.Equal(t, "EdDSA", token.Method.Alg())
+					assert.Equal(t, "ephemeral", token.Header["kid"])
+					assert.NotEmpty(t, token.Claims.(*model.Claims).Id, "Token should have a jti")
+				}
+				if assert.Len(t, tokenRepo.Created, 1) {
+					assert.NotEqual(t, tokens.RefreshToken, tokenRepo.Created[0].TokenHash, "Refresh token should be stored hashed")
+					assert.NotEmpty(t, tokenRepo.Created[0].FamilyID)
+				}
+				assert.NotNil(t, tt.setupMock.(*MockUserRepository).User.LastActiveAt, "Login should mark the user as active")
 			}
 		})
 	}
 }
+
+func TestRefreshToken(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	usedAt := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name            string
+		tokenRepo       *MockTokenRepository
+		expectedErr     error
+		expectedRevoked []string
+	}{
+		{
+			name: "successful rotation",
+			tokenRepo: &MockTokenRepository{
+				Stored: &repository.RefreshToken{Model: gorm.Model{ID: 1}, UserID: 1, FamilyID: "family", ExpiresAt: time.Now().Add(time.Hour)},
+				Marked: true,
+			},
+		},
+		{
+			name:        "unknown token",
+			tokenRepo:   &MockTokenRepository{},
+			expectedErr: constant.ErrInvalidRefreshToken,
+		},
+		{
+			name: "expired token",
+			tokenRepo: &MockTokenRepository{
+				Stored: &repository.RefreshToken{Model: gorm.Model{ID: 1}, UserID: 1, FamilyID: "family", ExpiresAt: time.Now().Add(-time.Hour)},
+			},
+			expectedErr: constant.ErrInvalidRefreshToken,
+		},
+		{
+			name: "reused token revokes the family",
+			tokenRepo: &MockTokenRepository{
+				Stored: &repository.RefreshToken{Model: gorm.Model{ID: 1}, UserID: 1, FamilyID: "family", ExpiresAt: time.Now().Add(time.Hour), UsedAt: &usedAt},
+			},
+			expectedErr:     constant.ErrRefreshTokenReused,
+			expectedRevoked: []string{"family"},
+		},
+		{
+			name: "concurrent rotation revokes the family",
+			tokenRepo: &MockTokenRepository{
+				Stored: &repository.RefreshToken{Model: gorm.Model{ID: 1}, UserID: 1, FamilyID: "family", ExpiresAt: time.Now().Add(time.Hour)},
+				Marked: false,
+			},
+			expectedErr:     constant.ErrRefreshTokenReused,
+			expectedRevoked: []string{"family"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := &MockUserRepository{}
+			authLogic := NewAuthLogic(userRepo, tt.tokenRepo, &MockMFARepository{}, NewRevocationStore(userRepo, tt.tokenRepo, logger), newTestThrottle(logger), newTestKeyring(t), logger)
+			tokens, err := authLogic.RefreshToken(context.Background(), "refresh-token")
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.Nil(t, tokens)
+				assert.Empty(t, tt.tokenRepo.Created)
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, tokens.AccessToken)
+				if assert.Len(t, tt.tokenRepo.Created, 1) {
+					assert.Equal(t, "family", tt.tokenRepo.Created[0].FamilyID, "Rotated token should stay in the same family")
+				}
+			}
+			assert.Equal(t, tt.expectedRevoked, tt.tokenRepo.RevokedFamilies)
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	userRepo := &MockUserRepository{User: &repository.User{Model: gorm.Model{ID: 1}}}
+	tokenRepo := &MockTokenRepository{
+		Stored: &repository.RefreshToken{Model: gorm.Model{ID: 1}, UserID: 1, FamilyID: "family", ExpiresAt: time.Now().Add(time.Hour)},
+	}
+	revocations := NewRevocationStore(userRepo, tokenRepo, logger)
+	authLogic := NewAuthLogic(userRepo, tokenRepo, &MockMFARepository{}, revocations, newTestThrottle(logger), newTestKeyring(t), logger)
+
+	claims := &model.Claims{
+		StandardClaims: jwt.StandardClaims{Id: "jti", IssuedAt: time.Now().Unix(), ExpiresAt: time.Now().Add(time.Hour).Unix()},
+		UserID:         1,
+	}
+	revoked, err := revocations.IsRevoked(context.Background(), claims)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	assert.NoError(t, authLogic.Logout(context.Background(), claims, "refresh-token"))
+	assert.Equal(t, []string{"family"}, tokenRepo.RevokedFamilies)
+
+	revoked, err = revocations.IsRevoked(context.Background(), claims)
+	assert.NoError(t, err)
+	assert.True(t, revoked, "Logged out token should be revoked")
+}
+
+func TestLogoutAll(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	userRepo := &MockUserRepository{User: &repository.User{Model: gorm.Model{ID: 1}}}
+	tokenRepo := &MockTokenRepository{}
+	revocations := NewRevocationStore(userRepo, tokenRepo, logger)
+	authLogic := NewAuthLogic(userRepo, tokenRepo, &MockMFARepository{}, revocations, newTestThrottle(logger), newTestKeyring(t), logger)
+
+	oldClaims := &model.Claims{
+		StandardClaims: jwt.StandardClaims{Id: "old", IssuedAt: time.Now().Add(-time.Minute).Unix(), ExpiresAt: time.Now().Add(time.Hour).Unix()},
+		UserID:         1,
+	}
+	// tokens signed before the millisecond issue time only have the seconds of iat
+	sameSecondClaims := &model.Claims{
+		StandardClaims: jwt.StandardClaims{Id: "same-second", IssuedAt: time.Now().Unix(), ExpiresAt: time.Now().Add(time.Hour).Unix()},
+		UserID:         1,
+	}
+	assert.NoError(t, authLogic.LogoutAll(context.Background(), 1))
+	assert.Equal(t, []uint{1}, tokenRepo.RevokedUsers)
+
+	revoked, err := revocations.IsRevoked(context.Background(), oldClaims)
+	assert.NoError(t, err)
+	assert.True(t, revoked, "Tokens issued before the logout should be revoked")
+
+	revoked, err = revocations.IsRevoked(context.Background(), sameSecondClaims)
+	assert.NoError(t, err)
+	assert.True(t, revoked, "Tokens issued in the second of the logout should be revoked")
+
+	// a login straight after the logout, in the same second
+	validAfter := revocations.cutoffs[1].validAfter
+	sameSecondLoginClaims := &model.Claims{
+		StandardClaims: jwt.StandardClaims{Id: "same-second-login", IssuedAt: validAfter.Unix(), ExpiresAt: time.Now().Add(time.Hour).Unix()},
+		UserID:         1,
+		IssuedAtMilli:  validAfter.UnixMilli() + 1,
+	}
+	revoked, err = revocations.IsRevoked(context.Background(), sameSecondLoginClaims)
+	assert.NoError(t, err)
+	assert.False(t, revoked, "Tokens issued after the logout in the same second should stay valid")
+
+	sameMilliClaims := &model.Claims{
+		StandardClaims: jwt.StandardClaims{Id: "same-milli", IssuedAt: validAfter.Unix(), ExpiresAt: time.Now().Add(time.Hour).Unix()},
+		UserID:         1,
+		IssuedAtMilli:  validAfter.UnixMilli(),
+	}
+	revoked, err = revocations.IsRevoked(context.Background(), sameMilliClaims)
+	assert.NoError(t, err)
+	assert.True(t, revoked, "Tokens issued in the millisecond of the logout should be revoked")
+
+	newClaims := &model.Claims{
+		StandardClaims: jwt.StandardClaims{Id: "new", IssuedAt: time.Now().Add(time.Second).Unix(), ExpiresAt: time.Now().Add(time.Hour).Unix()},
+		UserID:         1,
+	}
+	revoked, err = revocations.IsRevoked(context.Background(), newClaims)
+	assert.NoError(t, err)
+	assert.False(t, revoked, "Tokens issued after the logout should stay valid")
+}
+
+func TestKeyRotation(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	newKey := func(id string) *keyring.Key {
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		assert.NoError(t, err)
+		return &keyring.Key{ID: id, Method: jwt.SigningMethodEdDSA, PrivateKey: privateKey, PublicKey: publicKey}
+	}
+	oldKey, newKeyOnly := newKey("2024-01"), newKey("2024-06")
+
+	oldKeys, err := keyring.New("2024-01", oldKey)
+	assert.NoError(t, err)
+	rotatedKeys, err := keyring.New("2024-06", oldKey, newKeyOnly)
+	assert.NoError(t, err)
+	unrelatedKeys, err := keyring.New("2024-06", newKeyOnly)
+	assert.NoError(t, err)
+
+	userRepo := &MockUserRepository{User: &repository.User{Model: gorm.Model{ID: 1}}}
+	tokenRepo := &MockTokenRepository{}
+	authLogic := NewAuthLogic(userRepo, tokenRepo, &MockMFARepository{}, NewRevocationStore(userRepo, tokenRepo, logger), newTestThrottle(logger), oldKeys, logger)
+	tokens, err := authLogic.GenerateToken(context.Background(), "test@example.com", "password", "127.0.0.1")
+	assert.NoError(t, err)
+
+	_, err = jwt.ParseWithClaims(tokens.AccessToken, &model.Claims{}, rotatedKeys.Keyfunc)
+	assert.NoError(t, err, "Tokens of the previous key should be valid after the rotation")
+
+	_, err = jwt.ParseWithClaims(tokens.AccessToken, &model.Claims{}, unrelatedKeys.Keyfunc)
+	assert.Error(t, err, "Tokens of a removed key should be rejected")
+
+	assert.Len(t, rotatedKeys.JWKS().Keys, 2)
+}
+
+func TestTOTPLogin(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := context.Background()
+	userRepo := &MockUserRepository{User: &repository.User{Model: gorm.Model{ID: 1}, Email: "jane@example.com"}}
+	tokenRepo := &MockTokenRepository{}
+	mfaRepo := &MockMFARepository{}
+	keys := newTestKeyring(t)
+	authLogic := NewAuthLogic(userRepo, tokenRepo, mfaRepo, NewRevocationStore(userRepo, tokenRepo, logger), newTestThrottle(logger), keys, logger)
+
+	// enrollment is only effective once it is confirmed
+	enrollment, err := authLogic.EnrollTOTP(ctx, 1)
+	assert.NoError(t, err)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/")
+	assert.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+	tokens, err := authLogic.GenerateToken(ctx, "jane@example.com", "password", "127.0.0.1")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken, "An unconfirmed enrollment should not require a second factor")
+
+	_, err = authLogic.ConfirmTOTP(ctx, 1, "000000")
+	assert.ErrorIs(t, err, constant.ErrInvalidMFACode)
+
+	// a code of the previous time step is accepted for the confirmation so the login code is a fresh one
+	code, err := totp.Code(enrollment.Secret, time.Now().Add(-totp.Period))
+	assert.NoError(t, err)
+	recoveryCodes, err := authLogic.ConfirmTOTP(ctx, 1, code)
+	assert.NoError(t, err)
+	assert.Len(t, recoveryCodes, constant.RecoveryCodeCount)
+	assert.NotContains(t, mfaRepo.RecoveryCodes, recoveryCodes[0], "Recovery codes should only be stored hashed")
+	_, err = authLogic.EnrollTOTP(ctx, 1)
+	assert.ErrorIs(t, err, constant.ErrMFAAlreadyEnabled)
+
+	// the password login only returns an MFA token
+	tokens, err = authLogic.GenerateToken(ctx, "jane@example.com", "password", "127.0.0.1")
+	assert.NoError(t, err)
+	assert.Empty(t, tokens.AccessToken)
+	assert.Empty(t, tokens.RefreshToken)
+	claims := &model.Claims{}
+	_, err = jwt.ParseWithClaims(tokens.MFAToken, claims, keys.Keyfunc)
+	assert.NoError(t, err)
+	assert.True(t, claims.MFAPending)
+	mfaToken := tokens.MFAToken
+
+	_, err = authLogic.VerifyMFA(ctx, mfaToken, "000000", "127.0.0.1")
+	assert.ErrorIs(t, err, constant.ErrInvalidMFACode)
+	_, err = authLogic.VerifyMFA(ctx, "invalid", code, "127.0.0.1")
+	assert.ErrorIs(t, err, constant.ErrInvalidMFAToken)
+	_, err = authLogic.VerifyMFA(ctx, mfaToken, code, "127.0.0.1")
+	assert.ErrorIs(t, err, constant.ErrInvalidMFACode, "The code that confirmed the enrollment should not be accepted again")
+
+	code, err = totp.Code(enrollment.Secret, time.Now())
+	assert.NoError(t, err)
+	tokens, err = authLogic.VerifyMFA(ctx, mfaToken, code, "127.0.0.1")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	claims = &model.Claims{}
+	_, err = jwt.ParseWithClaims(tokens.AccessToken, claims, keys.Keyfunc)
+	assert.NoError(t, err)
+	assert.False(t, claims.MFAPending)
+
+	_, err = authLogic.VerifyMFA(ctx, mfaToken, recoveryCodes[0], "127.0.0.1")
+	assert.ErrorIs(t, err, constant.ErrInvalidMFAToken, "The MFA token should only be exchanged once")
+
+	// recovery codes replace the TOTP code once
+	tokens, err = authLogic.GenerateToken(ctx, "jane@example.com", "password", "127.0.0.1")
+	assert.NoError(t, err)
+	_, err = authLogic.VerifyMFA(ctx, tokens.MFAToken, strings.ToUpper(recoveryCodes[0]), "127.0.0.1")
+	assert.NoError(t, err)
+	assert.True(t, mfaRepo.RecoveryCodes[hash.SHA256(strings.ReplaceAll(recoveryCodes[0], "-", ""))])
+
+	tokens, err = authLogic.GenerateToken(ctx, "jane@example.com", "password", "127.0.0.1")
+	assert.NoError(t, err)
+	_, err = authLogic.VerifyMFA(ctx, tokens.MFAToken, recoveryCodes[0], "127.0.0.1")
+	assert.ErrorIs(t, err, constant.ErrInvalidMFACode, "A recovery code should only be used once")
+}
+
+func TestLoginThrottle(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := context.Background()
+	userRepo := &MockUserRepository{Err: constant.ErrInvalidCredentials}
+	tokenRepo := &MockTokenRepository{}
+	store := lockout.NewMemoryStore(time.Hour)
+	lockoutRepo := &MockLockoutRepository{}
+	authLogic := NewAuthLogic(userRepo, tokenRepo, &MockMFARepository{}, NewRevocationStore(userRepo, tokenRepo, logger), NewLoginThrottle(store, lockoutRepo, logger), newTestKeyring(t), logger)
+
+	// the free attempts are not delayed, the next one has to wait
+	for i := 0; i < constant.LoginAccountFreeAttempts; i++ {
+		_, err := authLogic.GenerateToken(ctx, "jane@example.com", "wrong", "10.0.0.1")
+		assert.ErrorIs(t, err, constant.ErrInvalidCredentials)
+	}
+	_, err := authLogic.GenerateToken(ctx, "Jane@Example.com", "wrong", "10.0.0.2")
+	var locked *lockout.LockedError
+	if assert.ErrorAs(t, err, &locked, "The backoff should apply to the email whatever the client IP") {
+		assert.LessOrEqual(t, locked.RetryAfter, constant.LoginBackoffBaseDelay)
+	}
+	_, err = authLogic.GenerateToken(ctx, "john@example.com", "wrong", "10.0.0.1")
+	assert.ErrorIs(t, err, constant.ErrInvalidCredentials, "Other emails of the same client IP should not wait")
+
+	// a successful login resets the attempts of the email
+	userRepo.User, userRepo.Err = &repository.User{Model: gorm.Model{ID: 1}}, nil
+	_, err = store.Update(ctx, accountKey("jane@example.com"), func(entry lockout.Entry, found bool) (lockout.Entry, bool) {
+		entry.LastAttempt = time.Now().Add(-time.Hour + time.Minute)
+		return entry, true
+	})
+	assert.NoError(t, err)
+	_, err = authLogic.GenerateToken(ctx, "jane@example.com", "password", "10.0.0.1")
+	assert.NoError(t, err)
+	userRepo.User, userRepo.Err = nil, constant.ErrInvalidCredentials
+	_, err = authLogic.GenerateToken(ctx, "jane@example.com", "wrong", "10.0.0.1")
+	assert.ErrorIs(t, err, constant.ErrInvalidCredentials)
+
+	// the last allowed failure locks the email out and is audited
+	_, err = store.Update(ctx, accountKey("jane@example.com"), func(entry lockout.Entry, found bool) (lockout.Entry, bool) {
+		return lockout.Entry{Attempts: constant.LoginAccountMaxAttempts - 1, LastAttempt: time.Now().Add(-constant.LoginBackoffMaxDelay)}, true
+	})
+	assert.NoError(t, err)
+	_, err = authLogic.GenerateToken(ctx, "jane@example.com", "wrong", "10.0.0.1")
+	assert.ErrorIs(t, err, constant.ErrInvalidCredentials)
+	if assert.Len(t, lockoutRepo.Events, 1) {
+		assert.Equal(t, constant.LockoutScopeAccount, lockoutRepo.Events[0].Scope)
+		assert.Equal(t, "jane@example.com", lockoutRepo.Events[0].Subject)
+		assert.Equal(t, "10.0.0.1", lockoutRepo.Events[0].ClientIP)
+	}
+
+	userRepo.User, userRepo.Err = &repository.User{Model: gorm.Model{ID: 1}}, nil
+	_, err = authLogic.GenerateToken(ctx, "jane@example.com", "password", "10.0.0.1")
+	if assert.ErrorAs(t, err, &locked, "A locked out email should be rejected even with the right password") {
+		assert.InDelta(t, constant.LoginAccountLockoutDuration.Seconds(), locked.RetryAfter.Seconds(), 5)
+	}
+}
@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"strings"
+	"time"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/model"
+	"github.com/a-berahman/dating-app/internal/repository"
+	hash "github.com/a-berahman/dating-app/pkg/hash"
+	"github.com/a-berahman/dating-app/pkg/totp"
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// recoveryCodeAlphabet leaves out characters that are easily mistaken for each other
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// EnrollTOTP starts the TOTP enrollment of the user, the credential is only used once ConfirmTOTP accepts a code of it
+func (al *AuthLogic) EnrollTOTP(ctx context.Context, userID uint) (*model.TOTPEnrollment, error) {
+	credential, err := al.mfaRepo.FindTOTPCredential(ctx, userID)
+	if err != nil {
+		al.logger.Error("Failed to find totp credential", zap.Uint("userID", userID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to find the totp credential")
+	}
+	if credential != nil && credential.ConfirmedAt != nil {
+		return nil, constant.ErrMFAAlreadyEnabled
+	}
+
+	user, err := al.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		al.logger.Error("Failed to find user", zap.Uint("userID", userID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to find the user")
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate the totp secret")
+	}
+	if err := al.mfaRepo.SaveTOTPCredential(ctx, &repository.TOTPCredential{UserID: userID, Secret: secret}); err != nil {
+		al.logger.Error("Failed to save totp credential", zap.Uint("userID", userID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to save the totp credential")
+	}
+
+	return &model.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.ProvisioningURI(constant.TOTPIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables the pending TOTP credential of the user with a code of the authenticator app and returns new recovery codes,
+// the recovery codes are only stored hashed so they cannot be shown again
+func (al *AuthLogic) ConfirmTOTP(ctx context.Context, userID uint, code string) ([]string, error) {
+	credential, err := al.mfaRepo.FindTOTPCredential(ctx, userID)
+	if err != nil {
+		al.logger.Error("Failed to find totp credential", zap.Uint("userID", userID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to find the totp credential")
+	}
+	if credential == nil {
+		return nil, constant.ErrMFANotEnrolled
+	}
+	if credential.ConfirmedAt != nil {
+		return nil, constant.ErrMFAAlreadyEnabled
+	}
+
+	step, ok := totp.Validate(credential.Secret, strings.TrimSpace(code), time.Now(), constant.TOTPSkew)
+	if !ok {
+		return nil, constant.ErrInvalidMFACode
+	}
+
+	codes := make([]string, 0, constant.RecoveryCodeCount)
+	codeHashes := make([]string, 0, constant.RecoveryCodeCount)
+	for i := 0; i < constant.RecoveryCodeCount; i++ {
+		recoveryCode, err := generateRecoveryCode()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to generate the recovery codes")
+		}
+		codes = append(codes, recoveryCode)
+		codeHashes = append(codeHashes, hash.SHA256(normalizeRecoveryCode(recoveryCode)))
+	}
+	if err := al.mfaRepo.ReplaceRecoveryCodes(ctx, userID, codeHashes); err != nil {
+		al.logger.Error("Failed to store recovery codes", zap.Uint("userID", userID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to store the recovery codes")
+	}
+	if err := al.mfaRepo.ConfirmTOTPCredential(ctx, userID, step); err != nil {
+		al.logger.Error("Failed to confirm totp credential", zap.Uint("userID", userID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to confirm the totp credential")
+	}
+
+	al.logger.Info("Two-factor authentication enabled", zap.Uint("userID", userID))
+	return codes, nil
+}
+
+// VerifyMFA exchanges the MFA token of a password login and a TOTP or recovery code for an access and a refresh token,
+// the MFA token can only be exchanged once and repeated codes of the same user are throttled
+func (al *AuthLogic) VerifyMFA(ctx context.Context, mfaToken, code, clientIP string) (*model.TokenPair, error) {
+	claims, err := al.parseMFAToken(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := al.throttle.AttemptMFA(ctx, claims.UserID, clientIP); err != nil {
+		return nil, err
+	}
+
+	credential, err := al.mfaRepo.FindTOTPCredential(ctx, claims.UserID)
+	if err != nil {
+		al.logger.Error("Failed to find totp credential", zap.Uint("userID", claims.UserID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to find the totp credential")
+	}
+	if credential == nil || credential.ConfirmedAt == nil {
+		return nil, constant.ErrInvalidMFAToken
+	}
+
+	accepted, err := al.checkSecondFactor(ctx, credential, code)
+	if err != nil {
+		return nil, err
+	}
+	if !accepted {
+		al.logger.Info("Invalid second factor", zap.Uint("userID", claims.UserID))
+		return nil, constant.ErrInvalidMFACode
+	}
+
+	if err := al.throttle.MFASucceeded(ctx, claims.UserID); err != nil {
+		al.logger.Error("Failed to reset mfa attempts", zap.Uint("userID", claims.UserID), zap.Error(err))
+	}
+
+	if err := al.revocations.Revoke(ctx, claims); err != nil {
+		return nil, err
+	}
+	return al.startSession(ctx, claims.UserID)
+}
+
+func (al *AuthLogic) issueMFAToken(userID uint) (*model.TokenPair, error) {
+	token, expiresAt, err := al.signToken(userID, constant.MFATokenTTL, true)
+	if err != nil {
+		return nil, err
+	}
+	return &model.TokenPair{MFAToken: token, ExpiresAt: expiresAt}, nil
+}
+
+func (al *AuthLogic) parseMFAToken(ctx context.Context, mfaToken string) (*model.Claims, error) {
+	token, err := jwt.ParseWithClaims(mfaToken, &model.Claims{}, al.keys.Keyfunc)
+	if err != nil {
+		return nil, constant.ErrInvalidMFAToken
+	}
+	claims, ok := token.Claims.(*model.Claims)
+	if !ok || !token.Valid || !claims.MFAPending {
+		return nil, constant.ErrInvalidMFAToken
+	}
+
+	revoked, err := al.revocations.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, constant.ErrInvalidMFAToken
+	}
+	return claims, nil
+}
+
+// checkSecondFactor accepts a TOTP code that has not been used yet or an unused recovery code
+func (al *AuthLogic) checkSecondFactor(ctx context.Context, credential *repository.TOTPCredential, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if step, ok := totp.Validate(credential.Secret, code, time.Now(), constant.TOTPSkew); ok {
+		used, err := al.mfaRepo.UseTOTPStep(ctx, credential.UserID, step)
+		if err != nil {
+			al.logger.Error("Failed to use totp step", zap.Uint("userID", credential.UserID), zap.Error(err))
+			return false, errors.Wrap(err, "failed to use the totp code")
+		}
+		return used, nil
+	}
+
+	used, err := al.mfaRepo.UseRecoveryCode(ctx, credential.UserID, hash.SHA256(normalizeRecoveryCode(code)))
+	if err != nil {
+		al.logger.Error("Failed to use recovery code", zap.Uint("userID", credential.UserID), zap.Error(err))
+		return false, errors.Wrap(err, "failed to use the recovery code")
+	}
+	if used {
+		al.logger.Warn("Recovery code used", zap.Uint("userID", credential.UserID))
+	}
+	return used, nil
+}
+
+// generateRecoveryCode returns a random code formatted as two groups of characters, like abcde-fghjk
+func generateRecoveryCode() (string, error) {
+	random := make([]byte, constant.RecoveryCodeSize)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	var code strings.Builder
+	for i, b := range random {
+		if i == constant.RecoveryCodeSize/2 {
+			code.WriteByte('-')
+		}
+		// the modulo bias is negligible for an alphabet of 31 characters
+		code.WriteByte(recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+	}
+	return code.String(), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
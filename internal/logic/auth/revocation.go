@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/model"
+	"github.com/a-berahman/dating-app/internal/repository"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// RevocationStore keeps track of revoked access tokens in the database and caches the lookups in memory,
+// revoked tokens stay cached until they expire while negative lookups are only trusted for a short time
+// so revocations made by other instances are picked up quickly
+type RevocationStore struct {
+	userRepo  repository.UserRepository
+	tokenRepo repository.TokenRepository
+	logger    *zap.Logger
+	cacheTTL  time.Duration
+
+	mu        sync.RWMutex
+	revoked   map[string]time.Time // jti of revoked tokens to the expiration of the token
+	valid     map[string]time.Time // jti of tokens found not revoked to the expiration of the cache entry
+	cutoffs   map[uint]cutoffEntry // user id to the time before which their tokens are invalid
+	lastPurge time.Time
+}
+
+type cutoffEntry struct {
+	validAfter  time.Time
+	userDeleted bool
+	cachedTill  time.Time
+}
+
+// NewRevocationStore creates a new instance of RevocationStore
+func NewRevocationStore(userRepo repository.UserRepository, tokenRepo repository.TokenRepository, logger *zap.Logger) *RevocationStore {
+	return &RevocationStore{
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		logger:    logger,
+		cacheTTL:  constant.RevocationCacheTTL,
+		revoked:   make(map[string]time.Time),
+		valid:     make(map[string]time.Time),
+		cutoffs:   make(map[uint]cutoffEntry),
+	}
+}
+
+// IsRevoked checks if the token has been revoked by a logout or was issued before the user logged out of all sessions
+func (rs *RevocationStore) IsRevoked(ctx context.Context, claims *model.Claims) (bool, error) {
+	cutoff, err := rs.userCutoff(ctx, claims.UserID)
+	if err != nil {
+		return false, err
+	}
+	if cutoff.userDeleted || issuedBefore(claims, cutoff.validAfter) {
+		return true, nil
+	}
+	if claims.Id == "" {
+		return false, nil
+	}
+
+	now := time.Now()
+	rs.mu.RLock()
+	_, revoked := rs.revoked[claims.Id]
+	validTill, valid := rs.valid[claims.Id]
+	rs.mu.RUnlock()
+	if revoked {
+		return true, nil
+	}
+	if valid && now.Before(validTill) {
+		return false, nil
+	}
+
+	revoked, err = rs.tokenRepo.IsAccessTokenRevoked(ctx, claims.Id)
+	if err != nil {
+		rs.logger.Error("Failed to check revoked token", zap.Error(err))
+		return false, errors.Wrap(err, "failed to check the revoked token")
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.purgeExpired(now)
+	if revoked {
+		rs.revoked[claims.Id] = time.Unix(claims.ExpiresAt, 0)
+	} else {
+		rs.valid[claims.Id] = now.Add(rs.cacheTTL)
+	}
+	return revoked, nil
+}
+
+// Revoke revokes the token of the claims until it expires
+func (rs *RevocationStore) Revoke(ctx context.Context, claims *model.Claims) error {
+	if claims.Id == "" {
+		return errors.New("token has no id")
+	}
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	if err := rs.tokenRepo.RevokeAccessToken(ctx, &repository.RevokedToken{
+		JTI:       claims.Id,
+		UserID:    claims.UserID,
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		rs.logger.Error("Failed to revoke token", zap.Error(err))
+		return errors.Wrap(err, "failed to revoke the token")
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	delete(rs.valid, claims.Id)
+	rs.revoked[claims.Id] = expiresAt
+	return nil
+}
+
+// RevokeAll invalidates every token of the user issued until now, the cutoff has the millisecond precision of the issue time of the tokens
+func (rs *RevocationStore) RevokeAll(ctx context.Context, userID uint) error {
+	now := time.Now().Truncate(time.Millisecond)
+	if err := rs.userRepo.SetTokensValidAfter(ctx, userID, now); err != nil {
+		rs.logger.Error("Failed to revoke user tokens", zap.Uint("userID", userID), zap.Error(err))
+		return errors.Wrap(err, "failed to revoke the user tokens")
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.cutoffs[userID] = cutoffEntry{validAfter: now, cachedTill: now.Add(rs.cacheTTL)}
+	return nil
+}
+
+// issuedBefore reports whether the token was issued until the cutoff, so a login right after a logout of all sessions
+// is not revoked. Tokens signed before the millisecond issue time existed only have the whole seconds of iat
+// and the ones issued in the second of the cutoff are revoked too
+func issuedBefore(claims *model.Claims, validAfter time.Time) bool {
+	if claims.IssuedAtMilli != 0 {
+		return claims.IssuedAtMilli <= validAfter.UnixMilli()
+	}
+	return claims.IssuedAt <= validAfter.Unix()
+}
+
+func (rs *RevocationStore) userCutoff(ctx context.Context, userID uint) (cutoffEntry, error) {
+	now := time.Now()
+	rs.mu.RLock()
+	entry, ok := rs.cutoffs[userID]
+	rs.mu.RUnlock()
+	if ok && now.Before(entry.cachedTill) {
+		return entry, nil
+	}
+
+	user, err := rs.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		rs.logger.Error("Failed to find user", zap.Uint("userID", userID), zap.Error(err))
+		return cutoffEntry{}, errors.Wrap(err, "failed to find the user")
+	}
+
+	entry = cutoffEntry{userDeleted: user == nil, cachedTill: now.Add(rs.cacheTTL)}
+	if user != nil && user.TokensValidAfter != nil {
+		entry.validAfter = *user.TokensValidAfter
+	}
+
+	rs.mu.Lock()
+	rs.cutoffs[userID] = entry
+	rs.mu.Unlock()
+	return entry, nil
+}
+
+// purgeExpired drops the cache entries that are no longer needed at most once per cache TTL, the caller must hold the lock
+func (rs *RevocationStore) purgeExpired(now time.Time) {
+	if now.Sub(rs.lastPurge) < rs.cacheTTL {
+		return
+	}
+	rs.lastPurge = now
+	for jti, expiresAt := range rs.revoked {
+		if now.After(expiresAt) {
+			delete(rs.revoked, jti)
+		}
+	}
+	for jti, cachedTill := range rs.valid {
+		if now.After(cachedTill) {
+			delete(rs.valid, jti)
+		}
+	}
+	for userID, entry := range rs.cutoffs {
+		if now.After(entry.cachedTill) {
+			delete(rs.cutoffs, userID)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/repository"
+	"github.com/a-berahman/dating-app/pkg/lockout"
+	"github.com/a-berahman/dating-app/pkg/utils"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// LoginThrottle slows down repeated logins of the same email and the same client IP with an exponential backoff
+// and locks them out after too many failures, every lockout is recorded for auditing
+type LoginThrottle struct {
+	accounts    *lockout.Limiter
+	clients     *lockout.Limiter
+	lockoutRepo repository.LockoutRepository
+	logger      *zap.Logger
+}
+
+// NewLoginThrottle creates a new instance of LoginThrottle that keeps the attempts in the given store
+func NewLoginThrottle(store lockout.Store, lockoutRepo repository.LockoutRepository, logger *zap.Logger) *LoginThrottle {
+	return &LoginThrottle{
+		accounts: lockout.NewLimiter(store, lockout.Policy{
+			FreeAttempts:    constant.LoginAccountFreeAttempts,
+			BaseDelay:       constant.LoginBackoffBaseDelay,
+			MaxDelay:        constant.LoginBackoffMaxDelay,
+			MaxAttempts:     constant.LoginAccountMaxAttempts,
+			LockoutDuration: constant.LoginAccountLockoutDuration,
+			ResetAfter:      constant.LoginAttemptsResetAfter,
+		}),
+		clients: lockout.NewLimiter(store, lockout.Policy{
+			FreeAttempts:    constant.LoginClientFreeAttempts,
+			BaseDelay:       constant.LoginBackoffBaseDelay,
+			MaxDelay:        constant.LoginBackoffMaxDelay,
+			MaxAttempts:     constant.LoginClientMaxAttempts,
+			LockoutDuration: constant.LoginClientLockoutDuration,
+			ResetAfter:      constant.LoginAttemptsResetAfter,
+		}),
+		lockoutRepo: lockoutRepo,
+		logger:      logger,
+	}
+}
+
+// Attempt counts a password login of the email from the client IP before the password is checked,
+// it returns a lockout.LockedError when either of them has to wait
+func (lt *LoginThrottle) Attempt(ctx context.Context, email, clientIP string) error {
+	if clientIP != "" {
+		lockedUntil, err := lt.clients.Attempt(ctx, clientKey(clientIP))
+		if err != nil {
+			return lt.attemptError(err)
+		}
+		lt.recordLockout(ctx, constant.LockoutScopeClient, clientIP, clientIP, lockedUntil)
+	}
+
+	lockedUntil, err := lt.accounts.Attempt(ctx, accountKey(email))
+	if err != nil {
+		return lt.attemptError(err)
+	}
+	lt.recordLockout(ctx, constant.LockoutScopeAccount, utils.NormalizeEmail(email), clientIP, lockedUntil)
+	return nil
+}
+
+// Succeeded resets the attempts of the email and takes back the attempt of the client IP,
+// other users behind the same IP keep being counted
+func (lt *LoginThrottle) Succeeded(ctx context.Context, email, clientIP string) error {
+	if err := lt.accounts.Reset(ctx, accountKey(email)); err != nil {
+		return errors.Wrap(err, "failed to reset the login attempts")
+	}
+	if clientIP == "" {
+		return nil
+	}
+	return errors.Wrap(lt.clients.Forgive(ctx, clientKey(clientIP)), "failed to forgive the login attempt")
+}
+
+// AttemptMFA counts a second factor attempt of the user, it returns a lockout.LockedError when the user has to wait
+func (lt *LoginThrottle) AttemptMFA(ctx context.Context, userID uint, clientIP string) error {
+	subject := strconv.FormatUint(uint64(userID), 10)
+	lockedUntil, err := lt.accounts.Attempt(ctx, mfaKey(subject))
+	if err != nil {
+		return lt.attemptError(err)
+	}
+	lt.recordLockout(ctx, constant.LockoutScopeMFA, subject, clientIP, lockedUntil)
+	return nil
+}
+
+// MFASucceeded resets the second factor attempts of the user
+func (lt *LoginThrottle) MFASucceeded(ctx context.Context, userID uint) error {
+	err := lt.accounts.Reset(ctx, mfaKey(strconv.FormatUint(uint64(userID), 10)))
+	return errors.Wrap(err, "failed to reset the mfa attempts")
+}
+
+func (lt *LoginThrottle) attemptError(err error) error {
+	var locked *lockout.LockedError
+	if errors.As(err, &locked) {
+		return err
+	}
+	lt.logger.Error("Failed to count login attempt", zap.Error(err))
+	return errors.Wrap(err, "failed to count the login attempt")
+}
+
+// recordLockout saves the audit record of a lockout that has just started, a failure is only logged
+// because the lockout itself is already in place
+func (lt *LoginThrottle) recordLockout(ctx context.Context, scope, subject, clientIP string, lockedUntil time.Time) {
+	if lockedUntil.IsZero() {
+		return
+	}
+	lt.logger.Warn("Login locked out", zap.String("scope", scope), zap.Time("lockedUntil", lockedUntil))
+	if err := lt.lockoutRepo.RecordLockout(ctx, &repository.LockoutEvent{
+		Scope:       scope,
+		Subject:     subject,
+		ClientIP:    clientIP,
+		LockedUntil: lockedUntil,
+	}); err != nil {
+		lt.logger.Error("Failed to record lockout", zap.String("scope", scope), zap.Error(err))
+	}
+}
+
+func accountKey(email string) string {
+	return constant.LockoutScopeAccount + ":" + utils.NormalizeEmail(email)
+}
+
+func clientKey(clientIP string) string {
+	return constant.LockoutScopeClient + ":" + clientIP
+}
+
+func mfaKey(userID string) string {
+	return constant.LockoutScopeMFA + ":" + userID
+}
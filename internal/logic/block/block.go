@@ -0,0 +1,98 @@
+package block
+
+import (
+	"context"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/model"
+	"github.com/a-berahman/dating-app/internal/repository"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// BlockLogic handles business logic for the blocks between users
+type BlockLogic struct {
+	userRepo  repository.UserRepository
+	blockRepo repository.BlockRepository
+	uow       repository.UnitOfWork
+	logger    *zap.Logger
+}
+
+// NewBlockLogic creates a new instance of BlockLogic, a block and the unmatch of the pair are saved in a transaction of the unit of work
+func NewBlockLogic(userRepo repository.UserRepository, blockRepo repository.BlockRepository, uow repository.UnitOfWork, logger *zap.Logger) *BlockLogic {
+	return &BlockLogic{
+		userRepo:  userRepo,
+		blockRepo: blockRepo,
+		uow:       uow,
+		logger:    logger,
+	}
+}
+
+// Block blocks the other user for the user and undoes their match, blocking a user twice keeps the first block.
+// The pair is kept apart in both directions and nothing is published so the blocked user cannot tell a block from an unmatch
+func (bl *BlockLogic) Block(ctx context.Context, userID, blockedUserID uint) error {
+	if userID == blockedUserID {
+		return constant.ErrSelfBlock
+	}
+	blockedUser, err := bl.userRepo.FindByID(ctx, blockedUserID)
+	if err != nil {
+		bl.logger.Error("Failed to find user", zap.Uint("userID", blockedUserID), zap.Error(err))
+		return errors.Wrap(err, "failed to find the user")
+	}
+	if blockedUser == nil {
+		return constant.ErrUserNotFound
+	}
+
+	err = bl.uow.WithinTransaction(ctx, func(repos *repository.Repository) error {
+		// a swipe of the pair waits for the block so it cannot create a match after the unmatch
+		if err := repos.SwipeRepo.LockUserPair(ctx, userID, blockedUserID); err != nil {
+			return errors.Wrap(err, "failed to lock users")
+		}
+		if _, err := repos.BlockRepo.Block(ctx, userID, blockedUserID); err != nil {
+			return errors.Wrap(err, "failed to block the user")
+		}
+		if _, err := repos.MatchRepo.UnmatchUser(ctx, userID, blockedUserID, string(constant.UnmatchReasonBlocked)); err != nil {
+			return errors.Wrap(err, "failed to unmatch the user")
+		}
+		return nil
+	})
+	if err != nil {
+		bl.logger.Error("Failed to block user", zap.Uint("userID", userID), zap.Uint("blockedUserID", blockedUserID), zap.Error(err))
+		return err
+	}
+	bl.logger.Info("User blocked", zap.Uint("userID", userID), zap.Uint("blockedUserID", blockedUserID))
+	return nil
+}
+
+// Unblock removes the block of the other user. The match undone by the block is not restored but no longer keeps
+// the pair apart, they can swipe on each other and match again unless the other user blocks too
+func (bl *BlockLogic) Unblock(ctx context.Context, userID, blockedUserID uint) error {
+	unblocked, err := bl.blockRepo.Unblock(ctx, userID, blockedUserID)
+	if err != nil {
+		bl.logger.Error("Failed to unblock user", zap.Uint("userID", userID), zap.Uint("blockedUserID", blockedUserID), zap.Error(err))
+		return errors.Wrap(err, "failed to unblock the user")
+	}
+	if !unblocked {
+		return constant.ErrBlockNotFound
+	}
+	bl.logger.Info("User unblocked", zap.Uint("userID", userID), zap.Uint("blockedUserID", blockedUserID))
+	return nil
+}
+
+// ListBlocks returns the users blocked by the user, the latest block first
+func (bl *BlockLogic) ListBlocks(ctx context.Context, userID uint) ([]model.Block, error) {
+	blocks, err := bl.blockRepo.ListBlocks(ctx, userID)
+	if err != nil {
+		bl.logger.Error("Failed to list blocks", zap.Uint("userID", userID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to list the blocks")
+	}
+	result := make([]model.Block, 0, len(blocks))
+	for _, block := range blocks {
+		dto := model.Block{UserID: block.BlockedUserID, BlockedAt: block.CreatedAt}
+		if block.BlockedUser != nil {
+			dto.Name = block.BlockedUser.Name
+		}
+		result = append(result, dto)
+	}
+	return result, nil
+}
@@ -0,0 +1,209 @@
+package block
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/logic/swipe"
+	"github.com/a-berahman/dating-app/internal/model"
+	"github.com/a-berahman/dating-app/internal/repository"
+	"github.com/a-berahman/dating-app/pkg/hub"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type MockUserRepository struct {
+	repository.UserRepository
+	Users map[uint]*repository.User
+}
+
+func (m *MockUserRepository) FindByID(ctx context.Context, id uint) (*repository.User, error) {
+	return m.Users[id], nil
+}
+
+// MockBlockRepository holds the blocks as pairs of the blocker and the blocked user
+type MockBlockRepository struct {
+	repository.BlockRepository
+	Blocks map[[2]uint]time.Time
+}
+
+func (m *MockBlockRepository) Block(ctx context.Context, userID, blockedUserID uint) (bool, error) {
+	if _, ok := m.Blocks[[2]uint{userID, blockedUserID}]; ok {
+		return false, nil
+	}
+	m.Blocks[[2]uint{userID, blockedUserID}] = time.Now()
+	return true, nil
+}
+
+func (m *MockBlockRepository) Unblock(ctx context.Context, userID, blockedUserID uint) (bool, error) {
+	if _, ok := m.Blocks[[2]uint{userID, blockedUserID}]; !ok {
+		return false, nil
+	}
+	delete(m.Blocks, [2]uint{userID, blockedUserID})
+	return true, nil
+}
+
+func (m *MockBlockRepository) IsBlocked(ctx context.Context, userID, otherUserID uint) (bool, error) {
+	_, blocked := m.Blocks[[2]uint{userID, otherUserID}]
+	_, blockedBy := m.Blocks[[2]uint{otherUserID, userID}]
+	return blocked || blockedBy, nil
+}
+
+func (m *MockBlockRepository) ListBlocks(ctx context.Context, userID uint) ([]repository.Block, error) {
+	var blocks []repository.Block
+	for pair, blockedAt := range m.Blocks {
+		if pair[0] == userID {
+			block := repository.Block{UserID: pair[0], BlockedUserID: pair[1], BlockedUser: &repository.User{Name: "blocked"}}
+			block.CreatedAt = blockedAt
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks, nil
+}
+
+// MockMatchRepository records the pairs unmatched by a block with their reason
+type MockMatchRepository struct {
+	repository.MatchRepository
+	Unmatched map[[2]uint]string
+}
+
+func (m *MockMatchRepository) UnmatchUser(ctx context.Context, userID, otherUserID uint, reason string) (bool, error) {
+	m.Unmatched[[2]uint{userID, otherUserID}] = reason
+	return true, nil
+}
+
+// IsUnmatched leaves out the pairs unmatched by a block like the repository does
+func (m *MockMatchRepository) IsUnmatched(ctx context.Context, userID, targetUserID uint) (bool, error) {
+	for _, pair := range [][2]uint{{userID, targetUserID}, {targetUserID, userID}} {
+		if reason, ok := m.Unmatched[pair]; ok && reason != string(constant.UnmatchReasonBlocked) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockMatchRepository) CreateOrUpdateMatch(ctx context.Context, userID, targetUserID uint) (uint, bool, error) {
+	return 2, true, nil
+}
+
+// MockSwipeRepository records the locked pairs and holds the right swipes of the users
+type MockSwipeRepository struct {
+	repository.SwipeRepository
+	Locked [][2]uint
+	Likes  map[[2]uint]bool
+}
+
+func (m *MockSwipeRepository) UpsertSwipe(ctx context.Context, swipe *repository.Swipe) (bool, error) {
+	m.Likes[[2]uint{swipe.UserID, swipe.TargetUserID}] = swipe.SwipedRight
+	return true, nil
+}
+
+func (m *MockSwipeRepository) CheckForMatch(ctx context.Context, userID, targetUserID uint) (bool, error) {
+	return m.Likes[[2]uint{targetUserID, userID}], nil
+}
+
+func (m *MockSwipeRepository) LockUserPair(ctx context.Context, userID, targetUserID uint) error {
+	m.Locked = append(m.Locked, [2]uint{userID, targetUserID})
+	return nil
+}
+
+// MockUnitOfWork runs the function with its repositories without a transaction
+type MockUnitOfWork struct {
+	Repos *repository.Repository
+}
+
+func (m *MockUnitOfWork) WithinTransaction(ctx context.Context, fn func(repos *repository.Repository) error) error {
+	return fn(m.Repos)
+}
+
+func newTestLogic() (*BlockLogic, *MockBlockRepository, *MockMatchRepository, *MockSwipeRepository) {
+	logger, _ := zap.NewDevelopment()
+	verifiedAt := time.Now()
+	users := &MockUserRepository{Users: map[uint]*repository.User{1: {Name: "blocker", VerifiedAt: &verifiedAt}, 2: {Name: "blocked", VerifiedAt: &verifiedAt}}}
+	blocks := &MockBlockRepository{Blocks: map[[2]uint]time.Time{}}
+	matches := &MockMatchRepository{Unmatched: map[[2]uint]string{}}
+	swipes := &MockSwipeRepository{Likes: map[[2]uint]bool{}}
+	uow := &MockUnitOfWork{Repos: &repository.Repository{SwipeRepo: swipes, MatchRepo: matches, BlockRepo: blocks}}
+	return NewBlockLogic(users, blocks, uow, logger), blocks, matches, swipes
+}
+
+func TestBlockLogic_Block(t *testing.T) {
+	bl, blocks, matches, swipes := newTestLogic()
+	ctx := context.Background()
+
+	// the block undoes the match of the pair while the swipes of the pair wait
+	assert.NoError(t, bl.Block(ctx, 1, 2))
+	assert.Contains(t, blocks.Blocks, [2]uint{1, 2})
+	assert.Equal(t, map[[2]uint]string{{1, 2}: string(constant.UnmatchReasonBlocked)}, matches.Unmatched)
+	assert.Equal(t, [][2]uint{{1, 2}}, swipes.Locked)
+
+	// blocking the user again is not an error
+	assert.NoError(t, bl.Block(ctx, 1, 2))
+
+	assert.ErrorIs(t, bl.Block(ctx, 1, 1), constant.ErrSelfBlock)
+	assert.ErrorIs(t, bl.Block(ctx, 1, 3), constant.ErrUserNotFound)
+}
+
+func TestBlockLogic_Unblock(t *testing.T) {
+	bl, blocks, _, _ := newTestLogic()
+	ctx := context.Background()
+
+	assert.NoError(t, bl.Block(ctx, 1, 2))
+	// only the blocker can remove the block
+	assert.ErrorIs(t, bl.Unblock(ctx, 2, 1), constant.ErrBlockNotFound)
+	assert.NoError(t, bl.Unblock(ctx, 1, 2))
+	assert.Empty(t, blocks.Blocks)
+	assert.ErrorIs(t, bl.Unblock(ctx, 1, 2), constant.ErrBlockNotFound)
+}
+
+type MockPreferencesRepository struct {
+	repository.PreferencesRepository
+}
+
+func (m *MockPreferencesRepository) FindPreferences(ctx context.Context, userID uint) (*repository.Preferences, error) {
+	return nil, nil
+}
+
+type MockPublisher struct{}
+
+func (m *MockPublisher) Publish(event hub.Event, userIDs ...uint) {}
+
+func TestBlockLogic_UnblockSwipe(t *testing.T) {
+	bl, _, _, swipes := newTestLogic()
+	ctx := context.Background()
+	logger, _ := zap.NewDevelopment()
+	sl := swipe.NewSwipeLogic(bl.userRepo, &MockPreferencesRepository{}, bl.uow, constant.SwipeConflictUpsert, &MockPublisher{}, logger)
+
+	// the pair liked each other before the block undid their match
+	swipes.Likes[[2]uint{1, 2}] = true
+	swipes.Likes[[2]uint{2, 1}] = true
+	assert.NoError(t, bl.Block(ctx, 1, 2))
+	_, _, err := sl.ProcessSwipe(ctx, 2, 1, true)
+	assert.ErrorIs(t, err, constant.ErrTargetBlocked)
+
+	// once the block is lifted the match undone by it no longer keeps the pair apart
+	assert.NoError(t, bl.Unblock(ctx, 1, 2))
+	matched, matchID, err := sl.ProcessSwipe(ctx, 2, 1, true)
+	assert.NoError(t, err)
+	assert.True(t, matched)
+	assert.Equal(t, uint(2), matchID)
+}
+
+func TestBlockLogic_ListBlocks(t *testing.T) {
+	bl, blocks, _, _ := newTestLogic()
+	ctx := context.Background()
+
+	blockedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	blocks.Blocks[[2]uint{1, 2}] = blockedAt
+	blocks.Blocks[[2]uint{2, 1}] = blockedAt
+
+	result, err := bl.ListBlocks(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Block{{UserID: 2, Name: "blocked", BlockedAt: blockedAt}}, result)
+
+	result, err = bl.ListBlocks(ctx, 3)
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+}
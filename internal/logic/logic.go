@@ -1,44 +1,116 @@
 package logic
 
 import (
+	"cmp"
 	"context"
+	"os"
 
 	"go.uber.org/zap"
 
+	"github.com/a-berahman/dating-app/constant"
 	"github.com/a-berahman/dating-app/internal/logic/auth"
+	"github.com/a-berahman/dating-app/internal/logic/block"
 	"github.com/a-berahman/dating-app/internal/logic/match"
+	"github.com/a-berahman/dating-app/internal/logic/message"
+	"github.com/a-berahman/dating-app/internal/logic/password"
+	"github.com/a-berahman/dating-app/internal/logic/profile"
 	"github.com/a-berahman/dating-app/internal/logic/swipe"
 	"github.com/a-berahman/dating-app/internal/logic/user"
 	"github.com/a-berahman/dating-app/internal/model"
 	"github.com/a-berahman/dating-app/internal/repository"
+	"github.com/a-berahman/dating-app/pkg/hub"
+	"github.com/a-berahman/dating-app/pkg/keyring"
+	"github.com/a-berahman/dating-app/pkg/lockout"
+	"github.com/a-berahman/dating-app/pkg/mailer"
 )
 
 type UserInterface interface {
 	RegisterUser(ctx context.Context, opts ...user.UserOption) (uint, error)
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, email string) error
 }
 type MatchInterface interface {
-	FindMatches(ctx context.Context, userID uint, opts ...match.MatchOption) ([]model.UserDTO, error)
+	FindMatches(ctx context.Context, userID uint, opts ...match.MatchOption) (*model.Discovery, error)
+	ListMatches(ctx context.Context, userID uint, limit int, cursor string) (*model.MatchList, error)
+	Unmatch(ctx context.Context, userID, matchID uint, reason constant.UnmatchReason) error
 }
 type AuthInterface interface {
-	GenerateToken(ctx context.Context, email, password string) (string, error)
+	GenerateToken(ctx context.Context, email, password, clientIP string) (*model.TokenPair, error)
+	VerifyMFA(ctx context.Context, mfaToken, code, clientIP string) (*model.TokenPair, error)
+	EnrollTOTP(ctx context.Context, userID uint) (*model.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userID uint, code string) ([]string, error)
+	RefreshToken(ctx context.Context, refreshToken string) (*model.TokenPair, error)
+	Logout(ctx context.Context, claims *model.Claims, refreshToken string) error
+	LogoutAll(ctx context.Context, userID uint) error
+	PublicKeys() keyring.JWKSet
+}
+type PasswordInterface interface {
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+}
+type RevocationInterface interface {
+	IsRevoked(ctx context.Context, claims *model.Claims) (bool, error)
+}
+type ProfileInterface interface {
+	GetProfile(ctx context.Context, userID uint) (*model.UserDTO, error)
+	GetPublicProfile(ctx context.Context, viewerID, userID uint) (*model.UserDTO, error)
+	UpdateProfile(ctx context.Context, userID uint, opts ...profile.ProfileOption) (*model.UserDTO, error)
+	GetPreferences(ctx context.Context, userID uint) (*model.Preferences, error)
+	UpdatePreferences(ctx context.Context, userID uint, preferences model.Preferences) (*model.Preferences, error)
+}
+type MessageInterface interface {
+	SendMessage(ctx context.Context, userID, matchID uint, body string) (*model.Message, error)
+	ListMessages(ctx context.Context, userID, matchID uint, limit int, cursor string) (*model.MessageList, error)
+	Typing(ctx context.Context, userID, matchID uint) error
+	MarkRead(ctx context.Context, userID, matchID, messageID uint) (uint, error)
+	MarkDelivered(ctx context.Context, userID, matchID, messageID uint) error
 }
 type SwipeInterface interface {
 	ProcessSwipe(ctx context.Context, userID, targetUserID uint, swipedRight bool) (bool, uint, error)
 }
+type BlockInterface interface {
+	Block(ctx context.Context, userID, blockedUserID uint) error
+	Unblock(ctx context.Context, userID, blockedUserID uint) error
+	ListBlocks(ctx context.Context, userID uint) ([]model.Block, error)
+}
 
 type Logic struct {
-	UserLogic  UserInterface
-	MatchLogic MatchInterface
-	AuthLogic  AuthInterface
-	SwipeLogic SwipeInterface
+	UserLogic     UserInterface
+	MatchLogic    MatchInterface
+	AuthLogic     AuthInterface
+	SwipeLogic    SwipeInterface
+	PasswordLogic PasswordInterface
+	ProfileLogic  ProfileInterface
+	MessageLogic  MessageInterface
+	BlockLogic    BlockInterface
+	// Revocations is checked by the authentication middleware on every request
+	Revocations RevocationInterface
+	// Hub delivers the events of the logic to the connected devices of the users
+	Hub *hub.Hub
 }
 
 // New returns a new Logic
-func New(repo *repository.Repository, logger *zap.Logger) *Logic {
+func New(repo *repository.Repository, keys *keyring.Keyring, m mailer.Mailer, logger *zap.Logger) *Logic {
+	baseURL := cmp.Or(os.Getenv(constant.APP_CONFIG_BASE_URL_KEY), constant.APP_DEFAULT_BASE_URL)
+	revocations := auth.NewRevocationStore(repo.UserRepo, repo.TokenRepo, logger)
+	throttle := auth.NewLoginThrottle(lockout.NewMemoryStore(constant.LoginAttemptsResetAfter), repo.LockoutRepo, logger)
+	swipeConflictMode := constant.SwipeConflictMode(cmp.Or(os.Getenv(constant.SWIPE_CONFIG_CONFLICT_MODE_KEY), string(constant.SwipeConflictUpsert)))
+	if swipeConflictMode != constant.SwipeConflictUpsert && swipeConflictMode != constant.SwipeConflictReject {
+		logger.Warn("Unknown swipe conflict mode, the latest swipe replaces the previous one", zap.String("mode", string(swipeConflictMode)))
+		swipeConflictMode = constant.SwipeConflictUpsert
+	}
+	events := hub.New(constant.EventBufferSize, constant.EventLogSize, constant.EventLogRetention)
+	authLogic := auth.NewAuthLogic(repo.UserRepo, repo.TokenRepo, repo.MFARepo, revocations, throttle, keys, logger)
 	return &Logic{
-		UserLogic:  user.NewUserLogic(repo.UserRepo, logger),
-		MatchLogic: match.NewMatchLogic(repo.MatchRepo, logger),
-		AuthLogic:  auth.NewAuthLogic(repo.UserRepo, logger),
-		SwipeLogic: swipe.NewSwipeLogic(repo.SwipeRepo, repo.MatchRepo, logger),
+		UserLogic:     user.NewUserLogic(repo.UserRepo, repo.VerifyRepo, m, baseURL, logger),
+		MatchLogic:    match.NewMatchLogic(repo.UserRepo, repo.MatchRepo, repo.PrefsRepo, logger),
+		AuthLogic:     authLogic,
+		SwipeLogic:    swipe.NewSwipeLogic(repo.UserRepo, repo.PrefsRepo, repo.UnitOfWork, swipeConflictMode, events, logger),
+		PasswordLogic: password.NewPasswordLogic(repo.UserRepo, repo.ResetRepo, repo.UnitOfWork, authLogic, m, baseURL, logger),
+		ProfileLogic:  profile.NewProfileLogic(repo.UserRepo, repo.ProfileRepo, repo.PrefsRepo, repo.BlockRepo, logger),
+		MessageLogic:  message.NewMessageLogic(repo.MatchRepo, repo.MessageRepo, events, logger),
+		BlockLogic:    block.NewBlockLogic(repo.UserRepo, repo.BlockRepo, repo.UnitOfWork, logger),
+		Revocations:   revocations,
+		Hub:           events,
 	}
 }
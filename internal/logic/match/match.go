@@ -2,25 +2,32 @@ package match
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"time"
 
 	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/logic/profile"
 	"github.com/a-berahman/dating-app/internal/model"
 	"github.com/a-berahman/dating-app/internal/repository"
 
-	"github.com/a-berahman/dating-app/pkg/geo"
 	"github.com/a-berahman/dating-app/pkg/utils"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
 type MatchLogic struct {
+	userRepo  repository.UserRepository
 	matchRepo repository.MatchRepository
+	prefsRepo repository.PreferencesRepository
 	logger    *zap.Logger
 }
 
-func NewMatchLogic(matchRepo repository.MatchRepository, logger *zap.Logger) *MatchLogic {
+func NewMatchLogic(userRepo repository.UserRepository, matchRepo repository.MatchRepository, prefsRepo repository.PreferencesRepository, logger *zap.Logger) *MatchLogic {
 	return &MatchLogic{
+		userRepo:  userRepo,
 		matchRepo: matchRepo,
+		prefsRepo: prefsRepo,
 		logger:    logger,
 	}
 }
@@ -28,21 +35,46 @@ func NewMatchLogic(matchRepo repository.MatchRepository, logger *zap.Logger) *Ma
 // MatchOptions holds the options for finding matches
 type MatchOptions struct {
 	lat, lng, distance float64
-	gender             constant.UserGender
+	hasLocation        bool
+	genders            []constant.UserGender
 	minAge, maxAge     int
+	sort               constant.DiscoverySort
+	limit              int
+	cursor             string
 }
 
 type MatchOption func(*MatchOptions) // functional options for match finding
 
-// FindMatches finds potential matches for a user based on the given options
-func (ml *MatchLogic) FindMatches(ctx context.Context, userID uint, opts ...MatchOption) ([]model.UserDTO, error) {
-	options := newMatchOptions(opts...)
+// FindMatches finds potential matches for a user based on the given options,
+// the options that are not given fall back to the stored preferences and the last known location of the user
+func (ml *MatchLogic) FindMatches(ctx context.Context, userID uint, opts ...MatchOption) (*model.Discovery, error) {
+	stored, err := ml.prefsRepo.FindPreferences(ctx, userID)
+	if err != nil {
+		ml.logger.Error("Failed to find preferences", zap.Uint("userID", userID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to find the preferences")
+	}
+	options := newMatchOptions(profile.PreferencesToDTO(stored), opts...)
+	after, err := decodeCursor(options.cursor, options.sort)
+	if err != nil {
+		return nil, err
+	}
+	if err := ml.resolveLocation(ctx, userID, &options); err != nil {
+		return nil, err
+	}
+
 	currentYear := time.Now().Year()
 	filters := repository.MatchFilters{
 		MaxDistance: options.distance,
-		Gender:      string(options.gender),
+		Genders:     make([]string, 0, len(options.genders)),
 		MinDOB:      time.Date(currentYear-options.maxAge, 1, 1, 0, 0, 0, 0, time.UTC),
 		MaxDOB:      time.Date(currentYear-options.minAge+1, 1, 1, 0, 0, 0, 0, time.UTC),
+		Sort:        options.sort,
+		// one more candidate than the page tells if there is a next page
+		Limit: options.limit + 1,
+		After: after,
+	}
+	for _, gender := range options.genders {
+		filters.Genders = append(filters.Genders, string(gender))
 	}
 	users, err := ml.matchRepo.FindPotentialMatches(ctx, userID, &filters, options.lat, options.lng)
 	if err != nil {
@@ -50,11 +82,163 @@ func (ml *MatchLogic) FindMatches(ctx context.Context, userID uint, opts ...Matc
 		return nil, err
 	}
 
-	return ml.processUsers(users)
+	var nextCursor string
+	if len(users) > options.limit {
+		users = users[:options.limit]
+		last := users[len(users)-1]
+		nextCursor = encodeCursor(options.sort, &repository.MatchCursor{SortKey: last.SortKey, ID: last.ID})
+	}
+
+	matches, err := ml.processUsers(users)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Discovery{Matches: matches, NextCursor: nextCursor}, nil
+}
+
+// ListMatches returns a page of the matches of the user with the other user of every pair, the most recently active first.
+// A zero limit is the default page size and the cursor continues after the page that returned it
+func (ml *MatchLogic) ListMatches(ctx context.Context, userID uint, limit int, cursor string) (*model.MatchList, error) {
+	if limit <= 0 {
+		limit = constant.DefaultMatchesLimit
+	}
+	limit = min(limit, constant.MaxMatchesLimit)
+	after, err := decodeMatchListCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	// one more match than the page tells if there is a next page
+	matches, err := ml.matchRepo.ListMatches(ctx, userID, limit+1, after)
+	if err != nil {
+		ml.logger.Error("Failed to list matches", zap.Uint("userID", userID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to list the matches")
+	}
+
+	var nextCursor string
+	if len(matches) > limit {
+		matches = matches[:limit]
+		last := matches[len(matches)-1]
+		nextCursor = encodeMatchListCursor(&repository.MatchListCursor{LastActivityAt: last.LastActivityAt, ID: last.ID})
+	}
 
+	result := make([]model.Match, 0, len(matches))
+	for _, match := range matches {
+		if match.Counterpart == nil {
+			continue
+		}
+		result = append(result, model.Match{
+			ID:             match.ID,
+			User:           toUserDTO(match.Counterpart),
+			MatchedAt:      match.CreatedAt,
+			LastActivityAt: match.LastActivityAt,
+			UnreadCount:    match.UnreadCount,
+		})
+	}
+	return &model.MatchList{Matches: result, NextCursor: nextCursor}, nil
 }
-func newMatchOptions(opts ...MatchOption) MatchOptions {
-	mo := MatchOptions{}
+
+// pageCursor is the content of a cursor, the sort is kept so a cursor cannot continue a page of another order
+type pageCursor struct {
+	Sort constant.DiscoverySort `json:"s"`
+	Key  float64                `json:"k"`
+	ID   uint                   `json:"i"`
+}
+
+// encodeCursor encodes the position of a candidate into an opaque cursor
+func encodeCursor(sort constant.DiscoverySort, cursor *repository.MatchCursor) string {
+	data, _ := json.Marshal(pageCursor{Sort: sort, Key: cursor.SortKey, ID: cursor.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor decodes a cursor of encodeCursor for the given sort, an empty cursor is the first page
+func decodeCursor(cursor string, sort constant.DiscoverySort) (*repository.MatchCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, constant.ErrInvalidCursor
+	}
+	var decoded pageCursor
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.ID == 0 || decoded.Sort != sort {
+		return nil, constant.ErrInvalidCursor
+	}
+	return &repository.MatchCursor{SortKey: decoded.Key, ID: decoded.ID}, nil
+}
+
+// Unmatch undoes a match of the user with the reason they gave, the users of the match cannot match again
+// and do not appear in the discovery of each other anymore
+func (ml *MatchLogic) Unmatch(ctx context.Context, userID, matchID uint, reason constant.UnmatchReason) error {
+	unmatched, err := ml.matchRepo.Unmatch(ctx, matchID, userID, string(reason))
+	if err != nil {
+		ml.logger.Error("Failed to unmatch", zap.Uint("userID", userID), zap.Uint("matchID", matchID), zap.Error(err))
+		return errors.Wrap(err, "failed to unmatch")
+	}
+	if !unmatched {
+		return constant.ErrMatchNotFound
+	}
+	return nil
+}
+
+// matchListCursor is the content of a cursor of the match list
+type matchListCursor struct {
+	LastActivityAt time.Time `json:"t"`
+	ID             uint      `json:"i"`
+}
+
+// encodeMatchListCursor encodes the position of a match into an opaque cursor
+func encodeMatchListCursor(cursor *repository.MatchListCursor) string {
+	data, _ := json.Marshal(matchListCursor{LastActivityAt: cursor.LastActivityAt, ID: cursor.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeMatchListCursor decodes a cursor of encodeMatchListCursor, an empty cursor is the first page
+func decodeMatchListCursor(cursor string) (*repository.MatchListCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, constant.ErrInvalidCursor
+	}
+	var decoded matchListCursor
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.ID == 0 {
+		return nil, constant.ErrInvalidCursor
+	}
+	return &repository.MatchListCursor{LastActivityAt: decoded.LastActivityAt, ID: decoded.ID}, nil
+}
+
+// resolveLocation saves the given location as the last known one or reads the last known one when no location is given
+func (ml *MatchLogic) resolveLocation(ctx context.Context, userID uint, options *MatchOptions) error {
+	if options.hasLocation {
+		if err := ml.userRepo.UpdateLocation(ctx, userID, options.lat, options.lng); err != nil {
+			ml.logger.Error("Failed to update location", zap.Uint("userID", userID), zap.Error(err))
+		}
+		return nil
+	}
+
+	user, err := ml.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		ml.logger.Error("Failed to find user", zap.Uint("userID", userID), zap.Error(err))
+		return errors.Wrap(err, "failed to find the user")
+	}
+	if user == nil {
+		return constant.ErrUserNotFound
+	}
+	options.lat, options.lng = user.Location.Lat, user.Location.Lng
+	return nil
+}
+
+func newMatchOptions(preferences model.Preferences, opts ...MatchOption) MatchOptions {
+	mo := MatchOptions{
+		distance: preferences.MaxDistance,
+		genders:  preferences.Genders,
+		minAge:   preferences.MinAge,
+		maxAge:   preferences.MaxAge,
+		sort:     constant.DiscoverySortDistance,
+		limit:    constant.DefaultDiscoveryLimit,
+	}
 	for _, opt := range opts {
 		opt(&mo)
 	}
@@ -75,13 +259,12 @@ func (ml *MatchLogic) processUsers(users []repository.User) ([]model.UserDTO, er
 func (ml *MatchLogic) convertToUserDTO(user *repository.User, ch chan int, index int, results []model.UserDTO) {
 	defer func() { ch <- 1 }()
 
-	point, err := geo.GeoDecodeString(user.Location)
-	if err != nil {
-		ml.logger.Error("Failed to decode location", zap.String("location", user.Location), zap.Error(err))
-		return
-	}
+	results[index] = toUserDTO(user)
+}
 
-	results[index] = model.UserDTO{
+// toUserDTO converts a user of the repository with their profile
+func toUserDTO(user *repository.User) model.UserDTO {
+	return model.UserDTO{
 		ID:          user.ID,
 		Email:       user.Email,
 		Name:        user.Name,
@@ -89,9 +272,12 @@ func (ml *MatchLogic) convertToUserDTO(user *repository.User, ch chan int, index
 		DateOfBirth: user.DateOfBirth,
 		Age:         utils.CalculateAge(user.DateOfBirth),
 		Location: model.Point{
-			Lat: point.Y(),
-			Lng: point.X(),
+			Lat: user.Location.Lat,
+			Lng: user.Location.Lng,
 		},
+		Verified: user.VerifiedAt != nil,
+		Profile:  profile.ToDTO(user.Profile),
+		Distance: user.Distance,
 	}
 }
 
@@ -99,6 +285,7 @@ func WithLocation(lat, lng float64) MatchOption {
 	return func(mo *MatchOptions) {
 		mo.lat = lat
 		mo.lng = lng
+		mo.hasLocation = true
 	}
 }
 
@@ -110,13 +297,43 @@ func WithDistance(distance float64) MatchOption {
 
 func WithGender(gender constant.UserGender) MatchOption {
 	return func(mo *MatchOptions) {
-		mo.gender = gender
+		mo.genders = []constant.UserGender{gender}
 	}
 }
 
+// WithAgeRange sets the age range, a zero bound keeps the bound of the preferences
 func WithAgeRange(minAge, maxAge int) MatchOption {
 	return func(mo *MatchOptions) {
-		mo.minAge = minAge
-		mo.maxAge = maxAge
+		if minAge > 0 {
+			mo.minAge = minAge
+		}
+		if maxAge > 0 {
+			mo.maxAge = maxAge
+		}
+	}
+}
+
+// WithLimit sets the page size, it is capped to the maximum page size and zero keeps the default
+func WithLimit(limit int) MatchOption {
+	return func(mo *MatchOptions) {
+		if limit > 0 {
+			mo.limit = min(limit, constant.MaxDiscoveryLimit)
+		}
+	}
+}
+
+// WithCursor continues the discovery after the page that returned the cursor
+func WithCursor(cursor string) MatchOption {
+	return func(mo *MatchOptions) {
+		mo.cursor = cursor
+	}
+}
+
+// WithSort sets the order of the discovery, an empty sort keeps the default order by distance
+func WithSort(sort constant.DiscoverySort) MatchOption {
+	return func(mo *MatchOptions) {
+		if sort != "" {
+			mo.sort = sort
+		}
 	}
 }
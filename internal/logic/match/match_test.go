@@ -8,26 +8,93 @@ import (
 	"github.com/a-berahman/dating-app/constant"
 	"github.com/a-berahman/dating-app/internal/model"
 	"github.com/a-berahman/dating-app/internal/repository"
+	"github.com/a-berahman/dating-app/pkg/geo"
+	"github.com/a-berahman/dating-app/pkg/utils"
 
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 )
 
 type MockMatchRepository struct {
-	User []repository.User
-	Err  error
+	User    []repository.User
+	Err     error
+	Filters *repository.MatchFilters
+	Lat     float64
+	Lng     float64
+	Matches []repository.Match
+	Limit   int
+	After   *repository.MatchListCursor
+	// Unmatched is returned by Unmatch and Reason is the reason it was given
+	Unmatched bool
+	Reason    string
 }
 
 func (m *MockMatchRepository) FindPotentialMatches(ctx context.Context, userID uint, filters *repository.MatchFilters, lat, lng float64) ([]repository.User, error) {
+	m.Filters, m.Lat, m.Lng = filters, lat, lng
 	return m.User, m.Err
 }
 
-func (m *MockMatchRepository) CreateOrUpdateMatch(ctx context.Context, userID, targetUserID uint) (uint, error) {
-	return 0, nil
+type MockUserRepository struct {
+	repository.UserRepository
+	User     *repository.User
+	Location *model.Point
+}
+
+func (m *MockUserRepository) FindByID(ctx context.Context, id uint) (*repository.User, error) {
+	return m.User, nil
+}
+
+func (m *MockUserRepository) UpdateLocation(ctx context.Context, userID uint, lat, lng float64) error {
+	m.Location = &model.Point{Lat: lat, Lng: lng}
+	return nil
+}
+
+type MockPreferencesRepository struct {
+	repository.PreferencesRepository
+	Preferences *repository.Preferences
+}
+
+func (m *MockPreferencesRepository) FindPreferences(ctx context.Context, userID uint) (*repository.Preferences, error) {
+	return m.Preferences, nil
+}
+
+func (m *MockMatchRepository) CreateOrUpdateMatch(ctx context.Context, userID, targetUserID uint) (uint, bool, error) {
+	return 0, false, nil
+}
+
+func (m *MockMatchRepository) Unmatch(ctx context.Context, matchID, userID uint, reason string) (bool, error) {
+	m.Reason = reason
+	return m.Unmatched, m.Err
+}
+
+func (m *MockMatchRepository) FindMatch(ctx context.Context, matchID uint) (*repository.Match, error) {
+	return nil, nil
+}
+
+func (m *MockMatchRepository) IsUnmatched(ctx context.Context, userID, targetUserID uint) (bool, error) {
+	return false, nil
+}
+
+func (m *MockMatchRepository) UnmatchUser(ctx context.Context, userID, otherUserID uint, reason string) (bool, error) {
+	return false, nil
+}
+
+func (m *MockMatchRepository) MarkRead(ctx context.Context, matchID, userID, messageID uint) (*repository.Match, error) {
+	return nil, nil
+}
+
+func (m *MockMatchRepository) MarkDelivered(ctx context.Context, matchID, userID, messageID uint) (*repository.Match, error) {
+	return nil, nil
+}
+
+func (m *MockMatchRepository) ListMatches(ctx context.Context, userID uint, limit int, after *repository.MatchListCursor) ([]repository.Match, error) {
+	m.Limit, m.After = limit, after
+	return m.Matches, m.Err
 }
 
 func TestMatchLogic_FindMatches(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
+	verifiedAt := time.Now()
 
 	tests := []struct {
 		name        string
@@ -57,7 +124,7 @@ func TestMatchLogic_FindMatches(t *testing.T) {
 						Email:       "test@example.com",
 						Name:        "test name",
 						Gender:      "FEMALE",
-						Location:    "0101000020E610000072D68656DD5E40C08FC2F5285CD44740",
+						Location:    geo.Point{Lat: 47.6590625, Lng: -32.74112969955321},
 						DateOfBirth: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
 					},
 				},
@@ -71,18 +138,63 @@ func TestMatchLogic_FindMatches(t *testing.T) {
 						Lat: 47.6590625,
 						Lng: -32.74112969955321,
 					},
-					Age:         34,
+					Age:         utils.CalculateAge(time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)),
 					DateOfBirth: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
 				},
 			},
 			expectError: false,
 		},
+		{
+			name:     "match with profile",
+			lat:      34.0522,
+			lng:      -118.2437,
+			distance: 5000,
+			gender:   constant.UserGenderMale,
+			minAge:   18,
+			maxAge:   35,
+			mockSetup: &MockMatchRepository{
+				User: []repository.User{
+					{
+						Name:        "test name",
+						Gender:      "FEMALE",
+						Location:    geo.Point{Lat: 47.6590625, Lng: -32.74112969955321},
+						DateOfBirth: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
+						VerifiedAt:  &verifiedAt,
+						Profile: &repository.Profile{
+							Bio:       "hello",
+							Interests: []string{"hiking"},
+							Prompts:   []repository.ProfilePrompt{{Question: "favourite food", Answer: "pizza"}},
+							Photos:    []repository.ProfilePhoto{{URL: "https://example.com/1.jpg"}},
+						},
+					},
+				},
+			},
+			expected: []model.UserDTO{
+				{
+					Name:   "test name",
+					Gender: constant.UserGenderFemale,
+					Location: model.Point{
+						Lat: 47.6590625,
+						Lng: -32.74112969955321,
+					},
+					Age:         utils.CalculateAge(time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)),
+					DateOfBirth: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
+					Verified:    true,
+					Profile: &model.Profile{
+						Bio:       "hello",
+						Interests: []string{"hiking"},
+						Prompts:   []model.Prompt{{Question: "favourite food", Answer: "pizza"}},
+						Photos:    []model.Photo{{URL: "https://example.com/1.jpg"}},
+					},
+				},
+			},
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 
-			ml := NewMatchLogic(tc.mockSetup, logger)
+			ml := NewMatchLogic(&MockUserRepository{}, tc.mockSetup, &MockPreferencesRepository{}, logger)
 			// tc.lat, tc.lng, tc.distance, tc.gender, tc.minAge, tc.maxAge
 			results, err := ml.FindMatches(context.Background(), tc.userID, WithLocation(tc.lat, tc.lng),
 				WithDistance(tc.distance), WithGender(tc.gender), WithAgeRange(tc.minAge, tc.maxAge))
@@ -91,9 +203,156 @@ func TestMatchLogic_FindMatches(t *testing.T) {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, tc.expected, results)
+				assert.Equal(t, tc.expected, results.Matches)
 			}
 
 		})
 	}
 }
+
+func TestMatchLogic_FindMatchesWithPreferences(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := context.Background()
+	users := &MockUserRepository{User: &repository.User{Location: geo.Point{Lat: 47.6590625, Lng: -32.74112969955321}}}
+	prefs := &MockPreferencesRepository{Preferences: &repository.Preferences{
+		Genders:     []string{"FEMALE", "MALE"},
+		MinAge:      25,
+		MaxAge:      40,
+		MaxDistance: 20000,
+		ShowMe:      true,
+	}}
+	matches := &MockMatchRepository{}
+	ml := NewMatchLogic(users, matches, prefs, logger)
+
+	// without options the stored preferences and the last known location are used
+	_, err := ml.FindMatches(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 47.6590625, matches.Lat)
+	assert.Equal(t, -32.74112969955321, matches.Lng)
+	assert.Equal(t, constant.DiscoverySortDistance, matches.Filters.Sort)
+	assert.Equal(t, []string{"FEMALE", "MALE"}, matches.Filters.Genders)
+	assert.Equal(t, 20000.0, matches.Filters.MaxDistance)
+	currentYear := time.Now().Year()
+	assert.Equal(t, currentYear-40, matches.Filters.MinDOB.Year())
+	assert.Equal(t, currentYear-24, matches.Filters.MaxDOB.Year())
+	assert.Nil(t, users.Location)
+
+	// the given options override the preferences and the location is saved as the last known one
+	_, err = ml.FindMatches(ctx, 1, WithLocation(52.52, 13.405), WithGender(constant.UserGenderFemale), WithAgeRange(0, 30))
+	assert.NoError(t, err)
+	assert.Equal(t, 52.52, matches.Lat)
+	assert.Equal(t, &model.Point{Lat: 52.52, Lng: 13.405}, users.Location)
+	assert.Equal(t, []string{"FEMALE"}, matches.Filters.Genders)
+	assert.Equal(t, currentYear-30, matches.Filters.MinDOB.Year())
+	assert.Equal(t, currentYear-24, matches.Filters.MaxDOB.Year())
+}
+
+func TestMatchLogic_FindMatchesPagination(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := context.Background()
+	location := geo.Point{Lat: 47.6590625, Lng: -32.74112969955321}
+	candidates := make([]repository.User, 3)
+	for i := range candidates {
+		distance := float64(100 * (i + 1))
+		candidates[i] = repository.User{Location: location, Distance: &distance, SortKey: -float64(i)}
+		candidates[i].ID = uint(i + 1)
+	}
+	matches := &MockMatchRepository{User: candidates}
+	ml := NewMatchLogic(&MockUserRepository{}, matches, &MockPreferencesRepository{}, logger)
+
+	// the repository returns one candidate more than the page so there is a next page
+	discovery, err := ml.FindMatches(ctx, 10, WithLocation(52.52, 13.405), WithLimit(2), WithSort(constant.DiscoverySortNewest))
+	assert.NoError(t, err)
+	assert.Equal(t, constant.DiscoverySortNewest, matches.Filters.Sort)
+	if assert.NotNil(t, discovery.Matches[1].Distance) {
+		assert.Equal(t, 200.0, *discovery.Matches[1].Distance)
+	}
+	assert.Equal(t, 3, matches.Filters.Limit)
+	assert.Nil(t, matches.Filters.After)
+	assert.Len(t, discovery.Matches, 2)
+	assert.NotEmpty(t, discovery.NextCursor)
+
+	// a cursor only continues the order it was issued for
+	_, err = ml.FindMatches(ctx, 10, WithLocation(52.52, 13.405), WithLimit(2), WithCursor(discovery.NextCursor))
+	assert.ErrorIs(t, err, constant.ErrInvalidCursor)
+
+	matches.User = candidates[2:]
+	discovery, err = ml.FindMatches(ctx, 10, WithLocation(52.52, 13.405), WithLimit(2), WithSort(constant.DiscoverySortNewest), WithCursor(discovery.NextCursor))
+	assert.NoError(t, err)
+	assert.Equal(t, &repository.MatchCursor{SortKey: -1, ID: 2}, matches.Filters.After)
+	assert.Len(t, discovery.Matches, 1)
+	assert.Empty(t, discovery.NextCursor)
+
+	// the page size is capped
+	_, err = ml.FindMatches(ctx, 10, WithLocation(52.52, 13.405), WithLimit(1000))
+	assert.NoError(t, err)
+	assert.Equal(t, constant.MaxDiscoveryLimit+1, matches.Filters.Limit)
+
+	_, err = ml.FindMatches(ctx, 10, WithCursor("not a cursor"))
+	assert.ErrorIs(t, err, constant.ErrInvalidCursor)
+}
+
+func TestMatchLogic_ListMatches(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := context.Background()
+	activeAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	matches := make([]repository.Match, 3)
+	for i := range matches {
+		matches[i] = repository.Match{
+			LastActivityAt: activeAt.Add(-time.Duration(i) * time.Hour),
+			CounterpartID:  uint(10 + i),
+			UnreadCount:    i,
+			Counterpart:    &repository.User{Name: "test name", Profile: &repository.Profile{Bio: "hello"}},
+		}
+		matches[i].ID = uint(i + 1)
+		matches[i].Counterpart.ID = uint(10 + i)
+	}
+	repo := &MockMatchRepository{Matches: matches}
+	ml := NewMatchLogic(&MockUserRepository{}, repo, &MockPreferencesRepository{}, logger)
+
+	// the repository returns one match more than the page so there is a next page
+	list, err := ml.ListMatches(ctx, 1, 2, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, repo.Limit)
+	assert.Nil(t, repo.After)
+	if assert.Len(t, list.Matches, 2) {
+		assert.Equal(t, uint(10), list.Matches[0].User.ID)
+		assert.Equal(t, "hello", list.Matches[0].User.Profile.Bio)
+		assert.Equal(t, activeAt, list.Matches[0].LastActivityAt)
+		assert.Equal(t, 1, list.Matches[1].UnreadCount)
+	}
+	assert.NotEmpty(t, list.NextCursor)
+
+	repo.Matches = matches[2:]
+	list, err = ml.ListMatches(ctx, 1, 2, list.NextCursor)
+	assert.NoError(t, err)
+	assert.Equal(t, &repository.MatchListCursor{LastActivityAt: activeAt.Add(-time.Hour), ID: 2}, repo.After)
+	assert.Len(t, list.Matches, 1)
+	assert.Empty(t, list.NextCursor)
+
+	// the page size falls back to the default and is capped
+	_, err = ml.ListMatches(ctx, 1, 0, "")
+	assert.NoError(t, err)
+	assert.Equal(t, constant.DefaultMatchesLimit+1, repo.Limit)
+	_, err = ml.ListMatches(ctx, 1, 1000, "")
+	assert.NoError(t, err)
+	assert.Equal(t, constant.MaxMatchesLimit+1, repo.Limit)
+
+	_, err = ml.ListMatches(ctx, 1, 2, "not a cursor")
+	assert.ErrorIs(t, err, constant.ErrInvalidCursor)
+}
+
+func TestMatchLogic_Unmatch(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	repo := &MockMatchRepository{Unmatched: true}
+	ml := NewMatchLogic(&MockUserRepository{}, repo, &MockPreferencesRepository{}, logger)
+
+	err := ml.Unmatch(context.Background(), 1, 7, constant.UnmatchReasonSpam)
+	assert.NoError(t, err)
+	assert.Equal(t, "spam", repo.Reason)
+
+	// a match of other users or an already unmatched match is not found
+	repo.Unmatched = false
+	err = ml.Unmatch(context.Background(), 1, 7, "")
+	assert.ErrorIs(t, err, constant.ErrMatchNotFound)
+}
@@ -0,0 +1,244 @@
+package message
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/model"
+	"github.com/a-berahman/dating-app/internal/repository"
+	"github.com/a-berahman/dating-app/pkg/hub"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// MessageLogic handles business logic for the messages between matched users
+type MessageLogic struct {
+	matchRepo   repository.MatchRepository
+	messageRepo repository.MessageRepository
+	publisher   hub.Publisher
+	logger      *zap.Logger
+}
+
+// NewMessageLogic creates a new instance of MessageLogic, the new messages and the typing of the users are published to both users of the match
+func NewMessageLogic(matchRepo repository.MatchRepository, messageRepo repository.MessageRepository, publisher hub.Publisher, logger *zap.Logger) *MessageLogic {
+	return &MessageLogic{
+		matchRepo:   matchRepo,
+		messageRepo: messageRepo,
+		publisher:   publisher,
+		logger:      logger,
+	}
+}
+
+// SendMessage sends a message of the user to the other user of the match, the message becomes the latest activity of the match
+func (ml *MessageLogic) SendMessage(ctx context.Context, userID, matchID uint, body string) (*model.Message, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, constant.ErrEmptyMessage
+	}
+	match, err := ml.authorize(ctx, userID, matchID)
+	if err != nil {
+		return nil, err
+	}
+
+	message := repository.Message{MatchID: matchID, SenderID: userID, Body: body}
+	if err := ml.messageRepo.CreateMessage(ctx, &message); err != nil {
+		ml.logger.Error("Failed to create message", zap.Uint("userID", userID), zap.Uint("matchID", matchID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to send the message")
+	}
+	result := toMessageDTO(&message, 0, 0)
+	ml.publisher.Publish(hub.Event{Type: constant.EventMessageCreated, Data: model.MessageCreatedEvent{
+		ID:        result.ID,
+		MatchID:   result.MatchID,
+		SenderID:  result.SenderID,
+		Body:      result.Body,
+		CreatedAt: result.CreatedAt,
+	}}, match.UserID, match.TargetUserID)
+	return &result, nil
+}
+
+// MarkRead marks the messages of the match up to the given message as read by the user, or all of them when it is zero,
+// and returns the last message the user has read. Both users are told when the position moves, it never moves back
+func (ml *MessageLogic) MarkRead(ctx context.Context, userID, matchID, messageID uint) (uint, error) {
+	match, err := ml.authorize(ctx, userID, matchID)
+	if err != nil {
+		return 0, err
+	}
+	previous := lastReadID(match, userID)
+
+	match, err = ml.matchRepo.MarkRead(ctx, matchID, userID, messageID)
+	if err != nil {
+		ml.logger.Error("Failed to mark messages read", zap.Uint("userID", userID), zap.Uint("matchID", matchID), zap.Error(err))
+		return 0, errors.Wrap(err, "failed to mark the messages read")
+	}
+	if match == nil {
+		// the match has been unmatched in the meantime
+		return 0, constant.ErrMatchUnmatched
+	}
+
+	lastRead := lastReadID(match, userID)
+	if lastRead > previous {
+		ml.publisher.Publish(hub.Event{Type: constant.EventMessageRead, Data: model.MessageReadEvent{MatchID: matchID, UserID: userID, MessageID: lastRead}},
+			match.UserID, match.TargetUserID)
+	}
+	return lastRead, nil
+}
+
+// MarkDelivered marks the messages of the match up to the given message as delivered to the user, the other user is told
+// when the position moves. The messages are delivered when they reach a connected device of the user or are listed by the user
+func (ml *MessageLogic) MarkDelivered(ctx context.Context, userID, matchID, messageID uint) error {
+	_, err := ml.markDelivered(ctx, userID, matchID, messageID)
+	return err
+}
+
+// markDelivered moves the last delivered message of the user and returns the match, or nil when the position did not move
+func (ml *MessageLogic) markDelivered(ctx context.Context, userID, matchID, messageID uint) (*repository.Match, error) {
+	match, err := ml.matchRepo.MarkDelivered(ctx, matchID, userID, messageID)
+	if err != nil {
+		ml.logger.Error("Failed to mark messages delivered", zap.Uint("userID", userID), zap.Uint("matchID", matchID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to mark the messages delivered")
+	}
+	if match != nil {
+		ml.publisher.Publish(hub.Event{Type: constant.EventMessageDelivered, Data: model.MessageDeliveredEvent{MatchID: matchID, UserID: userID, MessageID: lastDeliveredID(match, userID)}},
+			counterpart(match, userID))
+	}
+	return match, nil
+}
+
+// Typing tells the other user of the match that the user is typing, nothing is stored
+func (ml *MessageLogic) Typing(ctx context.Context, userID, matchID uint) error {
+	match, err := ml.authorize(ctx, userID, matchID)
+	if err != nil {
+		return err
+	}
+	ml.publisher.Publish(hub.Event{Type: constant.EventTyping, Data: model.TypingEvent{MatchID: matchID, UserID: userID}, Ephemeral: true}, counterpart(match, userID))
+	return nil
+}
+
+// ListMessages returns a page of the messages of the match, the newest first. A zero limit is the default page size
+// and the cursor continues with the messages older than the page that returned it. The listed messages are delivered to the user
+func (ml *MessageLogic) ListMessages(ctx context.Context, userID, matchID uint, limit int, cursor string) (*model.MessageList, error) {
+	if limit <= 0 {
+		limit = constant.DefaultMessagesLimit
+	}
+	limit = min(limit, constant.MaxMessagesLimit)
+	beforeID, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	match, err := ml.authorize(ctx, userID, matchID)
+	if err != nil {
+		return nil, err
+	}
+
+	// one more message than the page tells if there is a next page
+	messages, err := ml.messageRepo.ListMessages(ctx, matchID, limit+1, beforeID)
+	if err != nil {
+		ml.logger.Error("Failed to list messages", zap.Uint("matchID", matchID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to list the messages")
+	}
+
+	var nextCursor string
+	if len(messages) > limit {
+		messages = messages[:limit]
+		nextCursor = encodeCursor(messages[len(messages)-1].ID)
+	}
+	if len(messages) > 0 {
+		// the page is listed anyway when the delivery cannot be saved, the messages are delivered again by the next page
+		if delivered, err := ml.markDelivered(ctx, userID, matchID, messages[0].ID); err == nil && delivered != nil {
+			match = delivered
+		}
+	}
+	result := make([]model.Message, 0, len(messages))
+	for i := range messages {
+		// a message is delivered and read once its recipient, the user who did not send it, has received and read up to it
+		recipient := counterpart(match, messages[i].SenderID)
+		result = append(result, toMessageDTO(&messages[i], lastDeliveredID(match, recipient), lastReadID(match, recipient)))
+	}
+	return &model.MessageList{Messages: result, NextCursor: nextCursor}, nil
+}
+
+// authorize returns the match, or ErrMatchNotFound unless the user is one of the users of the match
+// and ErrMatchUnmatched once the match has been unmatched
+func (ml *MessageLogic) authorize(ctx context.Context, userID, matchID uint) (*repository.Match, error) {
+	match, err := ml.matchRepo.FindMatch(ctx, matchID)
+	if err != nil {
+		ml.logger.Error("Failed to find match", zap.Uint("matchID", matchID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to find the match")
+	}
+	if match == nil || (match.UserID != userID && match.TargetUserID != userID) {
+		return nil, constant.ErrMatchNotFound
+	}
+	if match.DeletedAt.Valid {
+		return nil, constant.ErrMatchUnmatched
+	}
+	return match, nil
+}
+
+// lastReadID returns the last message of the match the user has read
+func lastReadID(match *repository.Match, userID uint) uint {
+	if match.UserID == userID {
+		return match.UserLastReadID
+	}
+	return match.TargetLastReadID
+}
+
+// lastDeliveredID returns the last message of the match that reached a device of the user
+func lastDeliveredID(match *repository.Match, userID uint) uint {
+	if match.UserID == userID {
+		return match.UserLastDeliveredID
+	}
+	return match.TargetLastDeliveredID
+}
+
+// counterpart returns the other user of the match
+func counterpart(match *repository.Match, userID uint) uint {
+	if match.UserID == userID {
+		return match.TargetUserID
+	}
+	return match.UserID
+}
+
+// pageCursor is the content of a cursor, the id of the oldest message of the page
+type pageCursor struct {
+	ID uint `json:"i"`
+}
+
+// encodeCursor encodes the id of a message into an opaque cursor
+func encodeCursor(id uint) string {
+	data, _ := json.Marshal(pageCursor{ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor decodes a cursor of encodeCursor, an empty cursor is the first page and decodes to zero
+func decodeCursor(cursor string) (uint, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, constant.ErrInvalidCursor
+	}
+	var decoded pageCursor
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.ID == 0 {
+		return 0, constant.ErrInvalidCursor
+	}
+	return decoded.ID, nil
+}
+
+// toMessageDTO converts a message, the recipient has received or read it when it is not after their last delivered or
+// read message. A read message has been delivered
+func toMessageDTO(message *repository.Message, recipientLastDeliveredID, recipientLastReadID uint) model.Message {
+	read := message.ID <= recipientLastReadID
+	return model.Message{
+		ID:        message.ID,
+		MatchID:   message.MatchID,
+		SenderID:  message.SenderID,
+		Body:      message.Body,
+		CreatedAt: message.CreatedAt,
+		Delivered: read || message.ID <= recipientLastDeliveredID,
+		Read:      read,
+	}
+}
@@ -0,0 +1,341 @@
+package message
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/model"
+	"github.com/a-berahman/dating-app/internal/repository"
+	"github.com/a-berahman/dating-app/pkg/hub"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// MockMatchRepository only finds matches by id and marks them delivered and read, the message logic does not use the other methods
+type MockMatchRepository struct {
+	repository.MatchRepository
+	Matches map[uint]*repository.Match
+	Latest  uint // Latest is the latest message of every match
+}
+
+func (m *MockMatchRepository) FindMatch(ctx context.Context, matchID uint) (*repository.Match, error) {
+	if match, ok := m.Matches[matchID]; ok {
+		found := *match
+		return &found, nil
+	}
+	return nil, nil
+}
+
+func (m *MockMatchRepository) MarkRead(ctx context.Context, matchID, userID, messageID uint) (*repository.Match, error) {
+	match, ok := m.Matches[matchID]
+	if !ok || match.DeletedAt.Valid || (match.UserID != userID && match.TargetUserID != userID) {
+		return nil, nil
+	}
+	messageID = min(cmp.Or(messageID, m.Latest), m.Latest)
+	if match.UserID == userID {
+		match.UserLastReadID = max(match.UserLastReadID, messageID)
+	} else {
+		match.TargetLastReadID = max(match.TargetLastReadID, messageID)
+	}
+	updated := *match
+	return &updated, nil
+}
+
+func (m *MockMatchRepository) MarkDelivered(ctx context.Context, matchID, userID, messageID uint) (*repository.Match, error) {
+	match, ok := m.Matches[matchID]
+	if !ok || match.DeletedAt.Valid || (match.UserID != userID && match.TargetUserID != userID) {
+		return nil, nil
+	}
+	messageID = min(messageID, m.Latest)
+	if match.UserID == userID && messageID > match.UserLastDeliveredID {
+		match.UserLastDeliveredID = messageID
+	} else if match.TargetUserID == userID && messageID > match.TargetLastDeliveredID {
+		match.TargetLastDeliveredID = messageID
+	} else {
+		return nil, nil
+	}
+	updated := *match
+	return &updated, nil
+}
+
+type MockMessageRepository struct {
+	Messages []repository.Message
+	Created  *repository.Message
+	Limit    int
+	BeforeID uint
+	Err      error
+}
+
+func (m *MockMessageRepository) CreateMessage(ctx context.Context, message *repository.Message) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	message.ID = 42
+	message.CreatedAt = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	m.Created = message
+	return nil
+}
+
+func (m *MockMessageRepository) ListMessages(ctx context.Context, matchID uint, limit int, beforeID uint) ([]repository.Message, error) {
+	m.Limit, m.BeforeID = limit, beforeID
+	return m.Messages, m.Err
+}
+
+// matches returns match 7 between the users 1 and 2 with messages up to 30 and match 8 between the users 1 and 3 that user 3 has unmatched
+func matches() *MockMatchRepository {
+	unmatchedBy := uint(3)
+	active := &repository.Match{UserID: 2, TargetUserID: 1}
+	active.ID = 7
+	unmatched := &repository.Match{UserID: 1, TargetUserID: 3, UnmatchedBy: &unmatchedBy}
+	unmatched.ID = 8
+	unmatched.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	return &MockMatchRepository{Matches: map[uint]*repository.Match{7: active, 8: unmatched}, Latest: 30}
+}
+
+// published returns the events the client has received so far
+func published(client *hub.Client) []hub.Event {
+	var events []hub.Event
+	for {
+		select {
+		case event := <-client.Events():
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestMessageLogic_SendMessage(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	tests := []struct {
+		name        string
+		userID      uint
+		matchID     uint
+		body        string
+		repoErr     error
+		expectedErr error
+	}{
+		{
+			name:    "user of the match",
+			userID:  1,
+			matchID: 7,
+			body:    "  hello  ",
+		},
+		{
+			name:    "other user of the match",
+			userID:  2,
+			matchID: 7,
+			body:    "hi",
+		},
+		{
+			name:        "user outside the match",
+			userID:      3,
+			matchID:     7,
+			body:        "hi",
+			expectedErr: constant.ErrMatchNotFound,
+		},
+		{
+			name:        "unknown match",
+			userID:      1,
+			matchID:     9,
+			body:        "hi",
+			expectedErr: constant.ErrMatchNotFound,
+		},
+		{
+			name:        "unmatched match",
+			userID:      1,
+			matchID:     8,
+			body:        "hi",
+			expectedErr: constant.ErrMatchUnmatched,
+		},
+		{
+			name:        "blank message",
+			userID:      1,
+			matchID:     7,
+			body:        " \n ",
+			expectedErr: constant.ErrEmptyMessage,
+		},
+		{
+			name:        "database error",
+			userID:      1,
+			matchID:     7,
+			body:        "hi",
+			repoErr:     errors.New("database error"),
+			expectedErr: errors.New("failed to send the message: database error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := &MockMessageRepository{Err: tt.repoErr}
+			events := hub.New(constant.EventBufferSize, constant.EventLogSize, constant.EventLogRetention)
+			sender, outsider := events.Subscribe(tt.userID), events.Subscribe(3)
+			ml := NewMessageLogic(matches(), messages, events, logger)
+
+			message, err := ml.SendMessage(context.Background(), tt.userID, tt.matchID, tt.body)
+			if tt.expectedErr != nil {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+				assert.Nil(t, messages.Created)
+				assert.Empty(t, published(sender))
+				return
+			}
+			// the other devices of the sender get the message too
+			assert.Equal(t, []hub.Event{{ID: events.Epoch() + "-1", Type: constant.EventMessageCreated, Data: model.MessageCreatedEvent{
+				ID: message.ID, MatchID: message.MatchID, SenderID: message.SenderID, Body: message.Body, CreatedAt: message.CreatedAt,
+			}}}, published(sender))
+			assert.Empty(t, published(outsider))
+			assert.NoError(t, err)
+			assert.Equal(t, uint(42), message.ID)
+			assert.Equal(t, tt.userID, message.SenderID)
+			assert.Equal(t, tt.matchID, message.MatchID)
+			assert.Equal(t, messages.Created.Body, message.Body)
+		})
+	}
+	// the spaces around the text are not stored
+	messages := &MockMessageRepository{}
+	_, err := NewMessageLogic(matches(), messages, hub.New(constant.EventBufferSize, constant.EventLogSize, constant.EventLogRetention), logger).SendMessage(context.Background(), 1, 7, "  hello  ")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", messages.Created.Body)
+}
+
+func TestMessageLogic_ListMessages(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := context.Background()
+	stored := make([]repository.Message, 3)
+	for i := range stored {
+		stored[i] = repository.Message{MatchID: 7, SenderID: uint(1 + i%2), Body: "hello"}
+		stored[i].ID = uint(30 - i)
+	}
+	messages := &MockMessageRepository{Messages: stored}
+	repo := matches()
+	repo.Matches[7].UserLastReadID = 29
+	events := hub.New(constant.EventBufferSize, constant.EventLogSize, constant.EventLogRetention)
+	sender := events.Subscribe(1)
+	ml := NewMessageLogic(repo, messages, events, logger)
+
+	// the repository returns one message more than the page so there is a next page
+	list, err := ml.ListMessages(ctx, 2, 7, 2, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, messages.Limit)
+	assert.Zero(t, messages.BeforeID)
+	assert.Len(t, list.Messages, 2)
+	assert.NotEmpty(t, list.NextCursor)
+	// the user 2 has read up to the message 29 so the message 30 of the user 1 is unread, the user 1 has read nothing
+	assert.False(t, list.Messages[0].Read)
+	assert.False(t, list.Messages[1].Read)
+	// listing the page delivers the message 30 to the user 2, the message 29 has not reached the user 1
+	assert.True(t, list.Messages[0].Delivered)
+	assert.False(t, list.Messages[1].Delivered)
+	assert.Equal(t, []hub.Event{{ID: events.Epoch() + "-1", Type: constant.EventMessageDelivered, Data: model.MessageDeliveredEvent{MatchID: 7, UserID: 2, MessageID: 30}}},
+		published(sender))
+
+	messages.Messages = stored[2:]
+	list, err = ml.ListMessages(ctx, 2, 7, 2, list.NextCursor)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(29), messages.BeforeID)
+	assert.Len(t, list.Messages, 1)
+	assert.True(t, list.Messages[0].Read)
+	assert.True(t, list.Messages[0].Delivered)
+	assert.Empty(t, list.NextCursor)
+	// the older page does not move the delivery
+	assert.Empty(t, published(sender))
+
+	// the page size falls back to the default and is capped
+	_, err = ml.ListMessages(ctx, 2, 7, 0, "")
+	assert.NoError(t, err)
+	assert.Equal(t, constant.DefaultMessagesLimit+1, messages.Limit)
+	_, err = ml.ListMessages(ctx, 2, 7, 1000, "")
+	assert.NoError(t, err)
+	assert.Equal(t, constant.MaxMessagesLimit+1, messages.Limit)
+
+	_, err = ml.ListMessages(ctx, 2, 7, 2, "not a cursor")
+	assert.ErrorIs(t, err, constant.ErrInvalidCursor)
+	_, err = ml.ListMessages(ctx, 3, 7, 2, "")
+	assert.ErrorIs(t, err, constant.ErrMatchNotFound)
+	_, err = ml.ListMessages(ctx, 1, 8, 2, "")
+	assert.ErrorIs(t, err, constant.ErrMatchUnmatched)
+}
+
+func TestMessageLogic_Typing(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := context.Background()
+	events := hub.New(constant.EventBufferSize, constant.EventLogSize, constant.EventLogRetention)
+	typist, other := events.Subscribe(1), events.Subscribe(2)
+	ml := NewMessageLogic(matches(), &MockMessageRepository{}, events, logger)
+
+	// only the other user of the match is told
+	assert.NoError(t, ml.Typing(ctx, 1, 7))
+	assert.Empty(t, published(typist))
+	assert.Equal(t, []hub.Event{{Type: constant.EventTyping, Data: model.TypingEvent{MatchID: 7, UserID: 1}, Ephemeral: true}}, published(other))
+
+	assert.ErrorIs(t, ml.Typing(ctx, 3, 7), constant.ErrMatchNotFound)
+	assert.ErrorIs(t, ml.Typing(ctx, 1, 8), constant.ErrMatchUnmatched)
+	assert.Empty(t, published(other))
+}
+
+func TestMessageLogic_MarkDelivered(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := context.Background()
+	events := hub.New(constant.EventBufferSize, constant.EventLogSize, constant.EventLogRetention)
+	recipient, sender := events.Subscribe(1), events.Subscribe(2)
+	repo := matches()
+	ml := NewMessageLogic(repo, &MockMessageRepository{}, events, logger)
+
+	// only the sender is told the messages reached the user
+	assert.NoError(t, ml.MarkDelivered(ctx, 1, 7, 12))
+	assert.Equal(t, []hub.Event{{ID: events.Epoch() + "-1", Type: constant.EventMessageDelivered, Data: model.MessageDeliveredEvent{MatchID: 7, UserID: 1, MessageID: 12}}},
+		published(sender))
+	assert.Empty(t, published(recipient))
+	assert.Equal(t, uint(12), repo.Matches[7].TargetLastDeliveredID)
+
+	// the position does not move back and nothing is sent when it stays
+	assert.NoError(t, ml.MarkDelivered(ctx, 1, 7, 5))
+	assert.NoError(t, ml.MarkDelivered(ctx, 1, 7, 12))
+	assert.Empty(t, published(sender))
+	assert.Equal(t, uint(12), repo.Matches[7].TargetLastDeliveredID)
+
+	// the messages of other users and of unmatched matches are not delivered
+	assert.NoError(t, ml.MarkDelivered(ctx, 3, 7, 20))
+	assert.NoError(t, ml.MarkDelivered(ctx, 1, 8, 20))
+	assert.Empty(t, published(sender))
+}
+
+func TestMessageLogic_MarkRead(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := context.Background()
+	events := hub.New(constant.EventBufferSize, constant.EventLogSize, constant.EventLogRetention)
+	reader, other := events.Subscribe(1), events.Subscribe(2)
+	repo := matches()
+	ml := NewMessageLogic(repo, &MockMessageRepository{}, events, logger)
+
+	// both users are told how far the user has read
+	lastRead, err := ml.MarkRead(ctx, 1, 7, 12)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(12), lastRead)
+	receipt := hub.Event{ID: events.Epoch() + "-1", Type: constant.EventMessageRead, Data: model.MessageReadEvent{MatchID: 7, UserID: 1, MessageID: 12}}
+	assert.Equal(t, []hub.Event{receipt}, published(reader))
+	assert.Equal(t, []hub.Event{receipt}, published(other))
+
+	// the position does not move back and no receipt is sent when it stays
+	lastRead, err = ml.MarkRead(ctx, 1, 7, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(12), lastRead)
+	assert.Empty(t, published(other))
+
+	// without a message every message is read
+	lastRead, err = ml.MarkRead(ctx, 1, 7, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(30), lastRead)
+	assert.Len(t, published(other), 1)
+	assert.Equal(t, uint(30), repo.Matches[7].TargetLastReadID)
+
+	_, err = ml.MarkRead(ctx, 3, 7, 0)
+	assert.ErrorIs(t, err, constant.ErrMatchNotFound)
+	_, err = ml.MarkRead(ctx, 1, 8, 0)
+	assert.ErrorIs(t, err, constant.ErrMatchUnmatched)
+}
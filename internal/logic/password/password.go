@@ -0,0 +1,129 @@
+package password
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/repository"
+	hash "github.com/a-berahman/dating-app/pkg/hash"
+	"github.com/a-berahman/dating-app/pkg/mailer"
+	"github.com/a-berahman/dating-app/pkg/utils"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// SessionRevoker revokes every session of a user
+type SessionRevoker interface {
+	LogoutAll(ctx context.Context, userID uint) error
+}
+
+// PasswordLogic handles business logic for the password reset
+type PasswordLogic struct {
+	userRepo  repository.UserRepository
+	resetRepo repository.PasswordResetRepository
+	uow       repository.UnitOfWork
+	sessions  SessionRevoker
+	mailer    mailer.Mailer
+	baseURL   string
+	logger    *zap.Logger
+}
+
+// NewPasswordLogic creates a new instance of PasswordLogic, the base URL is used to build the link of the reset email.
+// A reset token is used and the password changed in a transaction of the unit of work
+func NewPasswordLogic(userRepo repository.UserRepository, resetRepo repository.PasswordResetRepository, uow repository.UnitOfWork, sessions SessionRevoker, m mailer.Mailer, baseURL string, logger *zap.Logger) *PasswordLogic {
+	return &PasswordLogic{
+		userRepo:  userRepo,
+		resetRepo: resetRepo,
+		uow:       uow,
+		sessions:  sessions,
+		mailer:    m,
+		baseURL:   baseURL,
+		logger:    logger,
+	}
+}
+
+// ForgotPassword emails a password reset link to the user, unknown emails are ignored so callers cannot tell which emails are registered.
+// For the same reason a failure of the mailer is only logged, the user can ask for another link
+func (pl *PasswordLogic) ForgotPassword(ctx context.Context, email string) error {
+	user, err := pl.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		pl.logger.Error("Failed to find user by email", zap.Error(err))
+		return errors.Wrap(err, "failed to find the user")
+	}
+	if user == nil {
+		pl.logger.Debug("Password reset requested for unknown email")
+		return nil
+	}
+
+	token, err := utils.GenerateRandomToken(constant.PasswordResetTokenSize)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate the reset token")
+	}
+	if err := pl.resetRepo.CreatePasswordResetToken(ctx, &repository.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hash.SHA256(token),
+		ExpiresAt: time.Now().Add(constant.PasswordResetTTL),
+	}); err != nil {
+		pl.logger.Error("Failed to store reset token", zap.Error(err))
+		return errors.Wrap(err, "failed to store the reset token")
+	}
+
+	link := fmt.Sprintf("%s/password/reset?token=%s", pl.baseURL, url.QueryEscape(token))
+	if err := pl.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password, it expires in %s.\n\n%s\n\nIf you did not ask for it you can ignore this email.", user.Name, constant.PasswordResetTTL, link),
+	}); err != nil {
+		pl.logger.Error("Failed to send reset email", zap.Uint("userID", user.ID), zap.Error(err))
+		return nil
+	}
+
+	pl.logger.Info("Password reset requested", zap.Uint("userID", user.ID))
+	return nil
+}
+
+// ResetPassword sets a new password with a reset token and revokes every existing session of the user
+func (pl *PasswordLogic) ResetPassword(ctx context.Context, token, password string) error {
+	stored, err := pl.resetRepo.FindPasswordResetToken(ctx, hash.SHA256(token))
+	if err != nil {
+		pl.logger.Error("Failed to find reset token", zap.Error(err))
+		return errors.Wrap(err, "failed to find the reset token")
+	}
+	if stored == nil || stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return constant.ErrInvalidResetToken
+	}
+
+	// the token stays usable when the password cannot be changed, a concurrent use of the token waits for the transaction
+	err = pl.uow.WithinTransaction(ctx, func(repos *repository.Repository) error {
+		marked, err := repos.ResetRepo.MarkPasswordResetTokenUsed(ctx, stored.ID)
+		if err != nil {
+			return errors.Wrap(err, "failed to use the reset token")
+		}
+		if !marked {
+			return constant.ErrInvalidResetToken
+		}
+		if err := repos.UserRepo.UpdatePassword(ctx, stored.UserID, password); err != nil {
+			return errors.Wrap(err, "failed to update the password")
+		}
+		if err := repos.ResetRepo.InvalidatePasswordResetTokens(ctx, stored.UserID); err != nil {
+			return errors.Wrap(err, "failed to invalidate the reset tokens")
+		}
+		return nil
+	})
+	if errors.Is(err, constant.ErrInvalidResetToken) {
+		return err
+	}
+	if err != nil {
+		pl.logger.Error("Failed to reset password", zap.Uint("userID", stored.UserID), zap.Error(err))
+		return err
+	}
+	if err := pl.sessions.LogoutAll(ctx, stored.UserID); err != nil {
+		return errors.Wrap(err, "failed to revoke the sessions")
+	}
+
+	pl.logger.Info("Password reset", zap.Uint("userID", stored.UserID))
+	return nil
+}
@@ -0,0 +1,241 @@
+package password
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/repository"
+	hash "github.com/a-berahman/dating-app/pkg/hash"
+	"github.com/a-berahman/dating-app/pkg/mailer"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type MockUserRepository struct {
+	repository.UserRepository
+	User            *repository.User
+	Err             error
+	UpdateErr       error
+	UpdatedPassword string
+}
+
+func (m *MockUserRepository) FindByEmail(ctx context.Context, email string) (*repository.User, error) {
+	return m.User, m.Err
+}
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, userID uint, password string) error {
+	if m.UpdateErr != nil {
+		return m.UpdateErr
+	}
+	m.UpdatedPassword = password
+	return m.Err
+}
+
+type MockResetRepository struct {
+	Stored      *repository.PasswordResetToken
+	Marked      bool
+	Err         error
+	Created     []*repository.PasswordResetToken
+	Invalidated []uint
+}
+
+func (m *MockResetRepository) CreatePasswordResetToken(ctx context.Context, token *repository.PasswordResetToken) error {
+	m.Created = append(m.Created, token)
+	return m.Err
+}
+func (m *MockResetRepository) FindPasswordResetToken(ctx context.Context, tokenHash string) (*repository.PasswordResetToken, error) {
+	return m.Stored, m.Err
+}
+func (m *MockResetRepository) MarkPasswordResetTokenUsed(ctx context.Context, id uint) (bool, error) {
+	return m.Marked, m.Err
+}
+func (m *MockResetRepository) InvalidatePasswordResetTokens(ctx context.Context, userID uint) error {
+	m.Invalidated = append(m.Invalidated, userID)
+	return m.Err
+}
+
+// MockUnitOfWork runs the function with its repositories without a transaction and reports whether it would have committed
+type MockUnitOfWork struct {
+	Repos     *repository.Repository
+	Committed bool
+}
+
+func (m *MockUnitOfWork) WithinTransaction(ctx context.Context, fn func(repos *repository.Repository) error) error {
+	if err := fn(m.Repos); err != nil {
+		return err
+	}
+	m.Committed = true
+	return nil
+}
+
+type MockSessionRevoker struct {
+	Revoked []uint
+}
+
+func (m *MockSessionRevoker) LogoutAll(ctx context.Context, userID uint) error {
+	m.Revoked = append(m.Revoked, userID)
+	return nil
+}
+
+type MockMailer struct {
+	Sent []mailer.Message
+	Err  error
+}
+
+func (m *MockMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.Sent = append(m.Sent, msg)
+	return m.Err
+}
+
+func TestForgotPassword(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	tests := []struct {
+		name        string
+		userRepo    *MockUserRepository
+		mailer      *MockMailer
+		expectMail  bool
+		expectError bool
+	}{
+		{
+			name:       "registered email receives a reset link",
+			userRepo:   &MockUserRepository{User: &repository.User{Model: gorm.Model{ID: 1}, Email: "jane@example.com", Name: "Jane"}},
+			mailer:     &MockMailer{},
+			expectMail: true,
+		},
+		{
+			name:     "unknown email is ignored",
+			userRepo: &MockUserRepository{},
+			mailer:   &MockMailer{},
+		},
+		{
+			// an error would only be returned for the registered emails
+			name:       "mailer failure is not reported",
+			userRepo:   &MockUserRepository{User: &repository.User{Model: gorm.Model{ID: 1}, Email: "jane@example.com"}},
+			mailer:     &MockMailer{Err: errors.New("smtp error")},
+			expectMail: true,
+		},
+		{
+			name:        "user lookup failure",
+			userRepo:    &MockUserRepository{Err: errors.New("db error")},
+			mailer:      &MockMailer{},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetRepo := &MockResetRepository{}
+			uow := &MockUnitOfWork{Repos: &repository.Repository{UserRepo: tt.userRepo, ResetRepo: resetRepo}}
+			pl := NewPasswordLogic(tt.userRepo, resetRepo, uow, &MockSessionRevoker{}, tt.mailer, "https://app.example.com", logger)
+
+			err := pl.ForgotPassword(context.Background(), "jane@example.com")
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			if !tt.expectMail {
+				assert.Empty(t, tt.mailer.Sent)
+				assert.Empty(t, resetRepo.Created)
+				return
+			}
+			if assert.Len(t, tt.mailer.Sent, 1) && assert.Len(t, resetRepo.Created, 1) {
+				body := tt.mailer.Sent[0].Body
+				token := body[strings.Index(body, "token=")+len("token="):]
+				token = token[:strings.Index(token, "\n")]
+				assert.Equal(t, hash.SHA256(token), resetRepo.Created[0].TokenHash, "Only the hash of the token should be stored")
+				assert.WithinDuration(t, time.Now().Add(constant.PasswordResetTTL), resetRepo.Created[0].ExpiresAt, time.Minute)
+			}
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	usedAt := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name          string
+		resetRepo     *MockResetRepository
+		updateErr     error
+		expectedErr   error
+		expectRevoked bool
+	}{
+		{
+			name: "successful reset revokes the sessions",
+			resetRepo: &MockResetRepository{
+				Stored: &repository.PasswordResetToken{Model: gorm.Model{ID: 1}, UserID: 7, ExpiresAt: time.Now().Add(time.Hour)},
+				Marked: true,
+			},
+			expectRevoked: true,
+		},
+		{
+			name:        "unknown token",
+			resetRepo:   &MockResetRepository{},
+			expectedErr: constant.ErrInvalidResetToken,
+		},
+		{
+			name: "expired token",
+			resetRepo: &MockResetRepository{
+				Stored: &repository.PasswordResetToken{Model: gorm.Model{ID: 1}, UserID: 7, ExpiresAt: time.Now().Add(-time.Minute)},
+			},
+			expectedErr: constant.ErrInvalidResetToken,
+		},
+		{
+			name: "used token",
+			resetRepo: &MockResetRepository{
+				Stored: &repository.PasswordResetToken{Model: gorm.Model{ID: 1}, UserID: 7, ExpiresAt: time.Now().Add(time.Hour), UsedAt: &usedAt},
+			},
+			expectedErr: constant.ErrInvalidResetToken,
+		},
+		{
+			name: "token used by a concurrent request",
+			resetRepo: &MockResetRepository{
+				Stored: &repository.PasswordResetToken{Model: gorm.Model{ID: 1}, UserID: 7, ExpiresAt: time.Now().Add(time.Hour)},
+				Marked: false,
+			},
+			expectedErr: constant.ErrInvalidResetToken,
+		},
+		{
+			// the token is marked in the transaction of the update so it stays usable
+			name: "password update failure",
+			resetRepo: &MockResetRepository{
+				Stored: &repository.PasswordResetToken{Model: gorm.Model{ID: 1}, UserID: 7, ExpiresAt: time.Now().Add(time.Hour)},
+				Marked: true,
+			},
+			updateErr:   errors.New("db error"),
+			expectedErr: errors.New("failed to update the password: db error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := &MockUserRepository{UpdateErr: tt.updateErr}
+			sessions := &MockSessionRevoker{}
+			uow := &MockUnitOfWork{Repos: &repository.Repository{UserRepo: userRepo, ResetRepo: tt.resetRepo}}
+			pl := NewPasswordLogic(userRepo, tt.resetRepo, uow, sessions, &MockMailer{}, "https://app.example.com", logger)
+
+			err := pl.ResetPassword(context.Background(), "token", "N3wPassword")
+			if tt.expectedErr != nil {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+				assert.Empty(t, userRepo.UpdatedPassword)
+				assert.False(t, uow.Committed)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "N3wPassword", userRepo.UpdatedPassword)
+				assert.Equal(t, []uint{7}, tt.resetRepo.Invalidated)
+				assert.True(t, uow.Committed)
+			}
+			if tt.expectRevoked {
+				assert.Equal(t, []uint{7}, sessions.Revoked)
+			} else {
+				assert.Empty(t, sessions.Revoked)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package profile
+
+import (
+	"context"
+	"strings"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/model"
+	"github.com/a-berahman/dating-app/internal/repository"
+	"github.com/a-berahman/dating-app/pkg/utils"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ProfileLogic handles business logic for the user profiles and their discovery preferences
+type ProfileLogic struct {
+	userRepo    repository.UserRepository
+	profileRepo repository.ProfileRepository
+	prefsRepo   repository.PreferencesRepository
+	blockRepo   repository.BlockRepository
+	logger      *zap.Logger
+}
+
+// NewProfileLogic creates a new instance of ProfileLogic
+func NewProfileLogic(userRepo repository.UserRepository, profileRepo repository.ProfileRepository, prefsRepo repository.PreferencesRepository, blockRepo repository.BlockRepository, logger *zap.Logger) *ProfileLogic {
+	return &ProfileLogic{
+		userRepo:    userRepo,
+		profileRepo: profileRepo,
+		prefsRepo:   prefsRepo,
+		blockRepo:   blockRepo,
+		logger:      logger,
+	}
+}
+
+type ProfileOption func(*repository.Profile) // functional options for a partial profile update
+
+// GetProfile returns the user with their profile, the profile is empty until the user fills it
+func (pl *ProfileLogic) GetProfile(ctx context.Context, userID uint) (*model.UserDTO, error) {
+	user, err := pl.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		pl.logger.Error("Failed to find user", zap.Uint("userID", userID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to find the user")
+	}
+	if user == nil {
+		return nil, constant.ErrUserNotFound
+	}
+
+	profile, err := pl.profileRepo.FindProfile(ctx, userID)
+	if err != nil {
+		pl.logger.Error("Failed to find profile", zap.Uint("userID", userID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to find the profile")
+	}
+	user.Profile = profile
+	return pl.toUserDTO(user), nil
+}
+
+// GetPublicProfile returns the profile of another user, users that did not verify their email are not visible to others
+// and users that blocked each other are not visible to each other
+func (pl *ProfileLogic) GetPublicProfile(ctx context.Context, viewerID, userID uint) (*model.UserDTO, error) {
+	if viewerID != userID {
+		blocked, err := pl.blockRepo.IsBlocked(ctx, viewerID, userID)
+		if err != nil {
+			pl.logger.Error("Failed to check for block", zap.Uint("viewerID", viewerID), zap.Uint("userID", userID), zap.Error(err))
+			return nil, errors.Wrap(err, "failed to check for block")
+		}
+		if blocked {
+			return nil, constant.ErrUserNotFound
+		}
+	}
+	user, err := pl.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.Verified && viewerID != userID {
+		return nil, constant.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// UpdateProfile applies the options to the profile of the user, the fields without an option keep their value
+func (pl *ProfileLogic) UpdateProfile(ctx context.Context, userID uint, opts ...ProfileOption) (*model.UserDTO, error) {
+	user, err := pl.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		pl.logger.Error("Failed to find user", zap.Uint("userID", userID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to find the user")
+	}
+	if user == nil {
+		return nil, constant.ErrUserNotFound
+	}
+
+	profile, err := pl.profileRepo.FindProfile(ctx, userID)
+	if err != nil {
+		pl.logger.Error("Failed to find profile", zap.Uint("userID", userID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to find the profile")
+	}
+	if profile == nil {
+		profile = &repository.Profile{UserID: userID}
+	}
+	for _, opt := range opts {
+		opt(profile)
+	}
+
+	if err := pl.profileRepo.SaveProfile(ctx, profile); err != nil {
+		pl.logger.Error("Failed to save profile", zap.Uint("userID", userID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to save the profile")
+	}
+	pl.logger.Info("Profile updated", zap.Uint("userID", userID))
+
+	user.Profile = profile
+	return pl.toUserDTO(user), nil
+}
+
+func (pl *ProfileLogic) toUserDTO(user *repository.User) *model.UserDTO {
+	return &model.UserDTO{
+		ID:          user.ID,
+		Email:       user.Email,
+		Name:        user.Name,
+		Gender:      constant.UserGender(user.Gender),
+		DateOfBirth: user.DateOfBirth,
+		Age:         utils.CalculateAge(user.DateOfBirth),
+		Verified:    user.VerifiedAt != nil,
+		Location:    model.Point{Lat: user.Location.Lat, Lng: user.Location.Lng},
+		Profile:     ToDTO(user.Profile),
+	}
+}
+
+// ToDTO converts a stored profile to its data transfer model, it returns nil for users without a profile
+func ToDTO(profile *repository.Profile) *model.Profile {
+	if profile == nil {
+		return nil
+	}
+	dto := &model.Profile{
+		Bio:       profile.Bio,
+		JobTitle:  profile.JobTitle,
+		School:    profile.School,
+		Height:    profile.HeightCm,
+		Interests: profile.Interests,
+		Prompts:   make([]model.Prompt, 0, len(profile.Prompts)),
+		Photos:    make([]model.Photo, 0, len(profile.Photos)),
+	}
+	for _, prompt := range profile.Prompts {
+		dto.Prompts = append(dto.Prompts, model.Prompt{Question: prompt.Question, Answer: prompt.Answer})
+	}
+	for _, photo := range profile.Photos {
+		dto.Photos = append(dto.Photos, model.Photo{URL: photo.URL, Width: photo.Width, Height: photo.Height})
+	}
+	return dto
+}
+
+func WithBio(bio string) ProfileOption {
+	return func(p *repository.Profile) {
+		p.Bio = strings.TrimSpace(bio)
+	}
+}
+
+func WithJobTitle(jobTitle string) ProfileOption {
+	return func(p *repository.Profile) {
+		p.JobTitle = strings.TrimSpace(jobTitle)
+	}
+}
+
+func WithSchool(school string) ProfileOption {
+	return func(p *repository.Profile) {
+		p.School = strings.TrimSpace(school)
+	}
+}
+
+// WithHeight sets the height in centimeters, zero removes it from the profile
+func WithHeight(heightCm int) ProfileOption {
+	return func(p *repository.Profile) {
+		if heightCm == 0 {
+			p.HeightCm = nil
+			return
+		}
+		p.HeightCm = &heightCm
+	}
+}
+
+// WithInterests replaces the interest tags, the tags are lower cased and duplicates are dropped
+func WithInterests(interests []string) ProfileOption {
+	return func(p *repository.Profile) {
+		p.Interests = make([]string, 0, len(interests))
+		seen := make(map[string]bool, len(interests))
+		for _, interest := range interests {
+			interest = strings.ToLower(strings.TrimSpace(interest))
+			if interest == "" || seen[interest] {
+				continue
+			}
+			seen[interest] = true
+			p.Interests = append(p.Interests, interest)
+		}
+	}
+}
+
+func WithPrompts(prompts []model.Prompt) ProfileOption {
+	return func(p *repository.Profile) {
+		p.Prompts = make([]repository.ProfilePrompt, 0, len(prompts))
+		for _, prompt := range prompts {
+			p.Prompts = append(p.Prompts, repository.ProfilePrompt{Question: strings.TrimSpace(prompt.Question), Answer: strings.TrimSpace(prompt.Answer)})
+		}
+	}
+}
+
+func WithPhotos(photos []model.Photo) ProfileOption {
+	return func(p *repository.Profile) {
+		p.Photos = make([]repository.ProfilePhoto, 0, len(photos))
+		for _, photo := range photos {
+			p.Photos = append(p.Photos, repository.ProfilePhoto{URL: photo.URL, Width: photo.Width, Height: photo.Height})
+		}
+	}
+}
+
+// GetPreferences returns the discovery preferences of the user, the defaults are returned until the user saves their own
+func (pl *ProfileLogic) GetPreferences(ctx context.Context, userID uint) (*model.Preferences, error) {
+	preferences, err := pl.prefsRepo.FindPreferences(ctx, userID)
+	if err != nil {
+		pl.logger.Error("Failed to find preferences", zap.Uint("userID", userID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to find the preferences")
+	}
+	dto := PreferencesToDTO(preferences)
+	return &dto, nil
+}
+
+// UpdatePreferences replaces the discovery preferences of the user
+func (pl *ProfileLogic) UpdatePreferences(ctx context.Context, userID uint, preferences model.Preferences) (*model.Preferences, error) {
+	genders := make([]string, 0, len(preferences.Genders))
+	for _, gender := range preferences.Genders {
+		genders = append(genders, string(gender))
+	}
+	stored := &repository.Preferences{
+		UserID:      userID,
+		Genders:     genders,
+		MinAge:      preferences.MinAge,
+		MaxAge:      preferences.MaxAge,
+		MaxDistance: preferences.MaxDistance,
+		ShowMe:      preferences.ShowMe,
+	}
+	if err := pl.prefsRepo.SavePreferences(ctx, stored); err != nil {
+		pl.logger.Error("Failed to save preferences", zap.Uint("userID", userID), zap.Error(err))
+		return nil, errors.Wrap(err, "failed to save the preferences")
+	}
+	pl.logger.Info("Preferences updated", zap.Uint("userID", userID))
+
+	dto := PreferencesToDTO(stored)
+	return &dto, nil
+}
+
+// PreferencesToDTO converts stored preferences to their data transfer model, users without preferences get the defaults
+func PreferencesToDTO(preferences *repository.Preferences) model.Preferences {
+	if preferences == nil {
+		return model.Preferences{
+			Genders:     []constant.UserGender{},
+			MinAge:      constant.MinimumUserAge,
+			MaxAge:      constant.DefaultPreferredMaxAge,
+			MaxDistance: constant.DefaultDiscoveryDistance,
+			ShowMe:      true,
+		}
+	}
+	dto := model.Preferences{
+		Genders:     make([]constant.UserGender, 0, len(preferences.Genders)),
+		MinAge:      preferences.MinAge,
+		MaxAge:      preferences.MaxAge,
+		MaxDistance: preferences.MaxDistance,
+		ShowMe:      preferences.ShowMe,
+	}
+	for _, gender := range preferences.Genders {
+		dto.Genders = append(dto.Genders, constant.UserGender(gender))
+	}
+	return dto
+}
@@ -0,0 +1,165 @@
+package profile
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/model"
+	"github.com/a-berahman/dating-app/internal/repository"
+	"github.com/a-berahman/dating-app/pkg/geo"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type MockUserRepository struct {
+	repository.UserRepository
+	Users map[uint]*repository.User
+}
+
+func (m *MockUserRepository) FindByID(ctx context.Context, id uint) (*repository.User, error) {
+	user, ok := m.Users[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *user
+	return &copied, nil
+}
+
+type MockProfileRepository struct {
+	Profiles map[uint]*repository.Profile
+}
+
+func (m *MockProfileRepository) FindProfile(ctx context.Context, userID uint) (*repository.Profile, error) {
+	return m.Profiles[userID], nil
+}
+
+func (m *MockProfileRepository) SaveProfile(ctx context.Context, profile *repository.Profile) error {
+	m.Profiles[profile.UserID] = profile
+	return nil
+}
+
+type MockPreferencesRepository struct {
+	Preferences map[uint]*repository.Preferences
+}
+
+func (m *MockPreferencesRepository) FindPreferences(ctx context.Context, userID uint) (*repository.Preferences, error) {
+	return m.Preferences[userID], nil
+}
+
+func (m *MockPreferencesRepository) SavePreferences(ctx context.Context, preferences *repository.Preferences) error {
+	m.Preferences[preferences.UserID] = preferences
+	return nil
+}
+
+// MockBlockRepository holds the blocks as pairs of the blocker and the blocked user
+type MockBlockRepository struct {
+	repository.BlockRepository
+	Blocks map[[2]uint]bool
+}
+
+func (m *MockBlockRepository) IsBlocked(ctx context.Context, userID, otherUserID uint) (bool, error) {
+	return m.Blocks[[2]uint{userID, otherUserID}] || m.Blocks[[2]uint{otherUserID, userID}], nil
+}
+
+func newTestLogic() (*ProfileLogic, *MockProfileRepository) {
+	logger, _ := zap.NewDevelopment()
+	verifiedAt := time.Now()
+	users := &MockUserRepository{Users: map[uint]*repository.User{
+		1: {Name: "verified", Location: geo.Point{Lat: 47.6590625, Lng: -32.74112969955321}, VerifiedAt: &verifiedAt},
+		2: {Name: "unverified", Location: geo.Point{Lat: 47.6590625, Lng: -32.74112969955321}},
+		4: {Name: "blocker", Location: geo.Point{Lat: 47.6590625, Lng: -32.74112969955321}, VerifiedAt: &verifiedAt},
+	}}
+	users.Users[1].ID = 1
+	users.Users[2].ID = 2
+	users.Users[4].ID = 4
+	profiles := &MockProfileRepository{Profiles: map[uint]*repository.Profile{}}
+	return NewProfileLogic(users, profiles, &MockPreferencesRepository{Preferences: map[uint]*repository.Preferences{}},
+		&MockBlockRepository{Blocks: map[[2]uint]bool{{4, 1}: true}}, logger), profiles
+}
+
+func TestProfileLogic_UpdateProfile(t *testing.T) {
+	pl, profiles := newTestLogic()
+	ctx := context.Background()
+
+	user, err := pl.UpdateProfile(ctx, 1, WithBio("  hello  "), WithHeight(180), WithInterests([]string{"Hiking", "hiking ", "", "Chess"}),
+		WithPrompts([]model.Prompt{{Question: "favourite food", Answer: "pizza"}}))
+	assert.NoError(t, err)
+	height := 180
+	assert.Equal(t, &model.Profile{
+		Bio:       "hello",
+		Height:    &height,
+		Interests: []string{"hiking", "chess"},
+		Prompts:   []model.Prompt{{Question: "favourite food", Answer: "pizza"}},
+		Photos:    []model.Photo{},
+	}, user.Profile)
+
+	// a partial update keeps the fields it does not set
+	user, err = pl.UpdateProfile(ctx, 1, WithJobTitle("engineer"), WithHeight(0))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", user.Profile.Bio)
+	assert.Equal(t, "engineer", user.Profile.JobTitle)
+	assert.Nil(t, user.Profile.Height)
+	assert.Equal(t, []string{"hiking", "chess"}, profiles.Profiles[1].Interests)
+
+	_, err = pl.UpdateProfile(ctx, 3, WithBio("hello"))
+	assert.ErrorIs(t, err, constant.ErrUserNotFound)
+}
+
+func TestProfileLogic_GetPublicProfile(t *testing.T) {
+	pl, _ := newTestLogic()
+	ctx := context.Background()
+
+	user, err := pl.GetPublicProfile(ctx, 2, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "verified", user.Name)
+	assert.True(t, user.Verified)
+	assert.Nil(t, user.Profile)
+
+	_, err = pl.GetPublicProfile(ctx, 1, 2)
+	assert.ErrorIs(t, err, constant.ErrUserNotFound)
+
+	// users can always see their own profile
+	user, err = pl.GetPublicProfile(ctx, 2, 2)
+	assert.NoError(t, err)
+	assert.False(t, user.Verified)
+
+	_, err = pl.GetPublicProfile(ctx, 1, 3)
+	assert.ErrorIs(t, err, constant.ErrUserNotFound)
+
+	// a block hides the users from each other whoever blocked whom
+	_, err = pl.GetPublicProfile(ctx, 1, 4)
+	assert.ErrorIs(t, err, constant.ErrUserNotFound)
+	_, err = pl.GetPublicProfile(ctx, 4, 1)
+	assert.ErrorIs(t, err, constant.ErrUserNotFound)
+}
+
+func TestProfileLogic_Preferences(t *testing.T) {
+	pl, _ := newTestLogic()
+	ctx := context.Background()
+
+	preferences, err := pl.GetPreferences(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.Preferences{
+		Genders:     []constant.UserGender{},
+		MinAge:      constant.MinimumUserAge,
+		MaxAge:      constant.DefaultPreferredMaxAge,
+		MaxDistance: constant.DefaultDiscoveryDistance,
+		ShowMe:      true,
+	}, preferences)
+
+	updated := model.Preferences{
+		Genders:     []constant.UserGender{constant.UserGenderFemale},
+		MinAge:      25,
+		MaxAge:      35,
+		MaxDistance: 10000,
+		ShowMe:      false,
+	}
+	_, err = pl.UpdatePreferences(ctx, 1, updated)
+	assert.NoError(t, err)
+
+	preferences, err = pl.GetPreferences(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, &updated, preferences)
+}
@@ -2,60 +2,190 @@ package swipe
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/model"
 	"github.com/a-berahman/dating-app/internal/repository"
+	"github.com/a-berahman/dating-app/pkg/hub"
 
 	"go.uber.org/zap"
 )
 
 type SwipeLogic struct {
-	swipeRepo repository.SwipeRepository
-	matchRepo repository.MatchRepository
-	logger    *zap.Logger
+	userRepo     repository.UserRepository
+	prefsRepo    repository.PreferencesRepository
+	uow          repository.UnitOfWork
+	conflictMode constant.SwipeConflictMode
+	publisher    hub.Publisher
+	logger       *zap.Logger
 }
 
-func NewSwipeLogic(swipeRepo repository.SwipeRepository, matchRepo repository.MatchRepository, logger *zap.Logger) *SwipeLogic {
+// NewSwipeLogic creates a new instance of SwipeLogic, the swipes are saved and matched in a transaction of the unit of work.
+// The conflict mode decides whether a second swipe on the same user replaces the first one or is refused, the matches are published to both users and the likes to the liked user
+func NewSwipeLogic(userRepo repository.UserRepository, prefsRepo repository.PreferencesRepository, uow repository.UnitOfWork, conflictMode constant.SwipeConflictMode, publisher hub.Publisher, logger *zap.Logger) *SwipeLogic {
 	return &SwipeLogic{
-		swipeRepo: swipeRepo,
-		matchRepo: matchRepo,
-		logger:    logger,
+		userRepo:     userRepo,
+		prefsRepo:    prefsRepo,
+		uow:          uow,
+		conflictMode: conflictMode,
+		publisher:    publisher,
+		logger:       logger,
 	}
 }
 
-// ProcessSwipe processes a swipe action and checks for matches
+// ProcessSwipe processes a swipe action and checks for matches, both users must have verified their email
+// and the target must accept swipes from the user, which they do not once the pair has been unmatched or either user has blocked the other.
+// A user has a single swipe on a target, a new swipe replaces the decision of the previous one unless
+// the conflict mode rejects it with ErrSwipeConflict. The events of a new like or match are published once the swipe is committed
 func (sl *SwipeLogic) ProcessSwipe(ctx context.Context, userID, targetUserID uint, swipedRight bool) (bool, uint, error) {
+	if userID == targetUserID {
+		return false, 0, constant.ErrSelfSwipe
+	}
+	if err := sl.checkVerified(ctx, userID, constant.ErrEmailNotVerified); err != nil {
+		return false, 0, err
+	}
+	if err := sl.checkTarget(ctx, targetUserID); err != nil {
+		return false, 0, err
+	}
+
 	swipe := repository.Swipe{
 		UserID:       userID,
 		TargetUserID: targetUserID,
 		SwipedRight:  swipedRight,
 	}
-	if err := sl.swipeRepo.AddSwipe(ctx, &swipe); err != nil {
-		sl.logger.Error("Failed to add swipe", zap.Error(err))
-		return false, 0, fmt.Errorf("failed to add swipe: %w", err)
+	var matched bool
+	var matchID uint
+	var events []notification
+	err := sl.uow.WithinTransaction(ctx, func(repos *repository.Repository) error {
+		// two users swiping on each other at the same time are processed one after the other,
+		// so the second one sees the first swipe and creates the match
+		if err := repos.SwipeRepo.LockUserPair(ctx, userID, targetUserID); err != nil {
+			sl.logger.Error("Failed to lock users", zap.Uint("userID", userID), zap.Uint("targetUserID", targetUserID), zap.Error(err))
+			return fmt.Errorf("failed to lock users: %w", err)
+		}
+		// a pair that has been unmatched by either user cannot match again
+		unmatched, err := repos.MatchRepo.IsUnmatched(ctx, userID, targetUserID)
+		if err != nil {
+			sl.logger.Error("Failed to check for unmatch", zap.Uint("userID", userID), zap.Uint("targetUserID", targetUserID), zap.Error(err))
+			return fmt.Errorf("failed to check for unmatch: %w", err)
+		}
+		if unmatched {
+			return constant.ErrTargetBlocked
+		}
+		// a blocked pair gets the same error as an unmatched one so the blocked user cannot tell
+		blocked, err := repos.BlockRepo.IsBlocked(ctx, userID, targetUserID)
+		if err != nil {
+			sl.logger.Error("Failed to check for block", zap.Uint("userID", userID), zap.Uint("targetUserID", targetUserID), zap.Error(err))
+			return fmt.Errorf("failed to check for block: %w", err)
+		}
+		if blocked {
+			return constant.ErrTargetBlocked
+		}
+
+		changed, err := sl.saveSwipe(ctx, repos.SwipeRepo, &swipe)
+		if err != nil {
+			if errors.Is(err, constant.ErrSwipeConflict) {
+				return err
+			}
+			sl.logger.Error("Failed to add swipe", zap.Error(err))
+			return fmt.Errorf("failed to add swipe: %w", err)
+		}
+
+		if !swipedRight {
+			return nil
+		}
+		matched, matchID, events, err = sl.processPotentialMatch(ctx, repos, userID, targetUserID, changed)
+		return err
+	})
+	if err != nil {
+		return false, 0, err
+	}
+	for _, n := range events {
+		sl.publisher.Publish(n.event, n.userIDs...)
+	}
+	return matched, matchID, nil
+}
 
+// notification is an event waiting for the commit of the swipe before it is published to the users
+type notification struct {
+	event   hub.Event
+	userIDs []uint
+}
+
+// saveSwipe stores the swipe according to the conflict mode, it reports false when the user repeated the decision of their previous swipe
+func (sl *SwipeLogic) saveSwipe(ctx context.Context, swipeRepo repository.SwipeRepository, swipe *repository.Swipe) (bool, error) {
+	if sl.conflictMode == constant.SwipeConflictReject {
+		return true, swipeRepo.AddSwipe(ctx, swipe)
 	}
+	return swipeRepo.UpsertSwipe(ctx, swipe)
+}
 
-	if swipedRight {
-		return sl.processPotentialMatch(ctx, userID, targetUserID)
+// checkVerified returns notVerifiedErr when the user does not exist or has not verified their email
+func (sl *SwipeLogic) checkVerified(ctx context.Context, userID uint, notVerifiedErr error) error {
+	user, err := sl.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		sl.logger.Error("Failed to find user", zap.Uint("userID", userID), zap.Error(err))
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+	if user == nil || user.VerifiedAt == nil {
+		return notVerifiedErr
+	}
+	return nil
+}
 
+// checkTarget returns ErrTargetNotFound when the target does not exist or has been deleted, ErrTargetNotVerified when
+// they have not verified their email and ErrTargetBlocked when they have hidden themselves from the discovery
+func (sl *SwipeLogic) checkTarget(ctx context.Context, targetUserID uint) error {
+	target, err := sl.userRepo.FindByID(ctx, targetUserID)
+	if err != nil {
+		sl.logger.Error("Failed to find user", zap.Uint("userID", targetUserID), zap.Error(err))
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+	if target == nil {
+		return constant.ErrTargetNotFound
+	}
+	if target.VerifiedAt == nil {
+		return constant.ErrTargetNotVerified
 	}
 
-	return false, 0, nil
+	preferences, err := sl.prefsRepo.FindPreferences(ctx, targetUserID)
+	if err != nil {
+		sl.logger.Error("Failed to find preferences", zap.Uint("userID", targetUserID), zap.Error(err))
+		return fmt.Errorf("failed to find preferences: %w", err)
+	}
+	if preferences != nil && !preferences.ShowMe {
+		return constant.ErrTargetBlocked
+	}
+	return nil
 }
-func (sl *SwipeLogic) processPotentialMatch(ctx context.Context, userID, targetUserID uint) (bool, uint, error) {
-	matched, err := sl.swipeRepo.CheckForMatch(ctx, userID, targetUserID)
+
+// processPotentialMatch matches the users when the target has swiped right on the user too and returns the events of a new match
+// for both users, otherwise the target of a new like is told that somebody likes them without learning who until they match.
+// A repeated right swipe returns the existing match without events so the users are not told twice
+func (sl *SwipeLogic) processPotentialMatch(ctx context.Context, repos *repository.Repository, userID, targetUserID uint, newLike bool) (bool, uint, []notification, error) {
+	matched, err := repos.SwipeRepo.CheckForMatch(ctx, userID, targetUserID)
 	if err != nil {
 		sl.logger.Error("Error checking for match", zap.Uint("userID", userID), zap.Uint("targetUserID", targetUserID), zap.Error(err))
-		return false, 0, fmt.Errorf("error checking for match: %w", err)
+		return false, 0, nil, fmt.Errorf("error checking for match: %w", err)
 	}
 	if matched {
-		matchID, err := sl.matchRepo.CreateOrUpdateMatch(ctx, userID, targetUserID)
+		matchID, created, err := repos.MatchRepo.CreateOrUpdateMatch(ctx, userID, targetUserID)
 		if err != nil {
 			sl.logger.Error("Error creating or updating match", zap.Error(err))
-			return false, 0, fmt.Errorf("error creating or updating match: %w", err)
+			return false, 0, nil, fmt.Errorf("error creating or updating match: %w", err)
 		}
-		return true, matchID, nil
+		if !created {
+			return true, matchID, nil, nil
+		}
+		return true, matchID, []notification{
+			{event: hub.Event{Type: constant.EventMatchCreated, Data: model.MatchCreatedEvent{MatchID: matchID, UserID: targetUserID}}, userIDs: []uint{userID}},
+			{event: hub.Event{Type: constant.EventMatchCreated, Data: model.MatchCreatedEvent{MatchID: matchID, UserID: userID}}, userIDs: []uint{targetUserID}},
+		}, nil
+	}
+	if !newLike {
+		return false, 0, nil, nil
 	}
-	return false, 0, nil
+	return false, 0, []notification{{event: hub.Event{Type: constant.EventLikeReceived}, userIDs: []uint{targetUserID}}}, nil
 }
@@ -1,11 +1,17 @@
 package swipe
 
 import (
+	"cmp"
 	"context"
 	"errors"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/model"
 	"github.com/a-berahman/dating-app/internal/repository"
+	"github.com/a-berahman/dating-app/pkg/hub"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go.uber.org/zap"
@@ -13,54 +19,165 @@ import (
 
 type MockMatchRepository struct {
 	mock.Mock
+	Unmatched bool // Unmatched is returned by IsUnmatched for every pair
 }
 
 type MockSwipeRepository struct {
 	mock.Mock
 }
 
+type MockBlockRepository struct {
+	repository.BlockRepository
+	Blocked bool // Blocked is returned by IsBlocked for every pair
+}
+
+func (m *MockBlockRepository) IsBlocked(ctx context.Context, userID, otherUserID uint) (bool, error) {
+	return m.Blocked, nil
+}
+
+// MockUserRepository only resolves users by id, the swipe logic does not use the other methods
+type MockUserRepository struct {
+	repository.UserRepository
+	Users map[uint]*repository.User
+}
+
+func (m *MockUserRepository) FindByID(ctx context.Context, id uint) (*repository.User, error) {
+	return m.Users[id], nil
+}
+
+func verifiedUsers(ids ...uint) *MockUserRepository {
+	verifiedAt := time.Now()
+	users := make(map[uint]*repository.User, len(ids))
+	for _, id := range ids {
+		users[id] = &repository.User{VerifiedAt: &verifiedAt}
+	}
+	return &MockUserRepository{Users: users}
+}
+
+// MockPreferencesRepository only finds the preferences, users without an entry have no stored preferences
+type MockPreferencesRepository struct {
+	repository.PreferencesRepository
+	Preferences map[uint]*repository.Preferences
+}
+
+func (m *MockPreferencesRepository) FindPreferences(ctx context.Context, userID uint) (*repository.Preferences, error) {
+	return m.Preferences[userID], nil
+}
+
 func (m *MockSwipeRepository) AddSwipe(ctx context.Context, swipe *repository.Swipe) error {
 	args := m.Called(ctx, swipe)
 	return args.Error(0)
 }
 
+func (m *MockSwipeRepository) UpsertSwipe(ctx context.Context, swipe *repository.Swipe) (bool, error) {
+	args := m.Called(ctx, swipe)
+	return args.Bool(0), args.Error(1)
+}
+
+// LockUserPair does nothing, the mock repositories do not run in a transaction
+func (m *MockSwipeRepository) LockUserPair(ctx context.Context, userID, targetUserID uint) error {
+	return nil
+}
+
 func (m *MockSwipeRepository) CheckForMatch(ctx context.Context, userID, targetUserID uint) (bool, error) {
 	args := m.Called(ctx, userID, targetUserID)
 	return args.Bool(0), args.Error(1)
 }
 
-func (m *MockMatchRepository) CreateOrUpdateMatch(ctx context.Context, userID, targetUserID uint) (uint, error) {
+func (m *MockMatchRepository) CreateOrUpdateMatch(ctx context.Context, userID, targetUserID uint) (uint, bool, error) {
 	args := m.Called(ctx, userID, targetUserID)
-	return args.Get(0).(uint), args.Error(1)
+	return args.Get(0).(uint), args.Bool(1), args.Error(2)
 }
 
 func (m *MockMatchRepository) FindPotentialMatches(ctx context.Context, userID uint, filters *repository.MatchFilters, lat, lng float64) ([]repository.User, error) {
 	return nil, nil
 }
 
+func (m *MockMatchRepository) Unmatch(ctx context.Context, matchID, userID uint, reason string) (bool, error) {
+	return false, nil
+}
+
+func (m *MockMatchRepository) FindMatch(ctx context.Context, matchID uint) (*repository.Match, error) {
+	return nil, nil
+}
+
+func (m *MockMatchRepository) IsUnmatched(ctx context.Context, userID, targetUserID uint) (bool, error) {
+	return m.Unmatched, nil
+}
+
+func (m *MockMatchRepository) UnmatchUser(ctx context.Context, userID, otherUserID uint, reason string) (bool, error) {
+	return false, nil
+}
+
+func (m *MockMatchRepository) MarkRead(ctx context.Context, matchID, userID, messageID uint) (*repository.Match, error) {
+	return nil, nil
+}
+
+func (m *MockMatchRepository) MarkDelivered(ctx context.Context, matchID, userID, messageID uint) (*repository.Match, error) {
+	return nil, nil
+}
+
+func (m *MockMatchRepository) ListMatches(ctx context.Context, userID uint, limit int, after *repository.MatchListCursor) ([]repository.Match, error) {
+	return nil, nil
+}
+
+// published returns the events the client has received so far
+func published(client *hub.Client) []hub.Event {
+	var events []hub.Event
+	for {
+		select {
+		case event := <-client.Events():
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// MockUnitOfWork runs the function with its repositories without a transaction, CommitErr fails the commit after the function succeeds
+type MockUnitOfWork struct {
+	Repos     *repository.Repository
+	CommitErr error
+}
+
+func (m *MockUnitOfWork) WithinTransaction(ctx context.Context, fn func(repos *repository.Repository) error) error {
+	if err := fn(m.Repos); err != nil {
+		return err
+	}
+	return m.CommitErr
+}
+
 func TestSwipeLogic_ProcessSwipe(t *testing.T) {
 	tests := []struct {
 		name            string
 		userID          uint
 		targetUserID    uint
 		swipedRight     bool
+		conflictMode    constant.SwipeConflictMode
+		userRepo        *MockUserRepository
+		preferences     map[uint]*repository.Preferences
+		unmatched       bool
+		blocked         bool
+		commitErr       error
 		setupSwipeMock  func(m *MockSwipeRepository)
 		setupMatchMock  func(m *MockMatchRepository)
 		expectedMatch   bool
 		expectedMatchID uint
 		expectedErr     error
+		repeated        bool // repeated tells that the swipe repeats the previous one so nothing is published
 	}{
 		{
 			name:         "successful swipe with match",
 			userID:       1,
 			targetUserID: 2,
 			swipedRight:  true,
+			userRepo:     verifiedUsers(1, 2),
 			setupSwipeMock: func(m *MockSwipeRepository) {
-				m.On("AddSwipe", mock.Anything, mock.AnythingOfType("*repository.Swipe")).Return(nil)
+				m.On("UpsertSwipe", mock.Anything, mock.AnythingOfType("*repository.Swipe")).Return(true, nil)
 				m.On("CheckForMatch", mock.Anything, uint(1), uint(2)).Return(true, nil)
 			},
 			setupMatchMock: func(m *MockMatchRepository) {
-				m.On("CreateOrUpdateMatch", mock.Anything, uint(1), uint(2)).Return(uint(100), nil)
+				m.On("CreateOrUpdateMatch", mock.Anything, uint(1), uint(2)).Return(uint(100), true, nil)
 			},
 			expectedMatch:   true,
 			expectedMatchID: 100,
@@ -71,45 +188,223 @@ func TestSwipeLogic_ProcessSwipe(t *testing.T) {
 			userID:       1,
 			targetUserID: 2,
 			swipedRight:  true,
+			userRepo:     verifiedUsers(1, 2),
 			setupSwipeMock: func(m *MockSwipeRepository) {
-				m.On("AddSwipe", mock.Anything, mock.AnythingOfType("*repository.Swipe")).Return(nil)
+				m.On("UpsertSwipe", mock.Anything, mock.AnythingOfType("*repository.Swipe")).Return(true, nil)
 				m.On("CheckForMatch", mock.Anything, uint(1), uint(2)).Return(false, nil)
 			},
 			setupMatchMock: func(m *MockMatchRepository) {
-				m.On("CreateOrUpdateMatch", mock.Anything, uint(1), uint(2)).Return(uint(100), nil)
+				m.On("CreateOrUpdateMatch", mock.Anything, uint(1), uint(2)).Return(uint(100), true, nil)
 			},
 			expectedMatch:   false,
 			expectedMatchID: 0,
 			expectedErr:     nil,
 		},
+		{
+			name:         "repeated swipe on a match",
+			userID:       1,
+			targetUserID: 2,
+			swipedRight:  true,
+			userRepo:     verifiedUsers(1, 2),
+			setupSwipeMock: func(m *MockSwipeRepository) {
+				m.On("UpsertSwipe", mock.Anything, mock.AnythingOfType("*repository.Swipe")).Return(false, nil)
+				m.On("CheckForMatch", mock.Anything, uint(1), uint(2)).Return(true, nil)
+			},
+			setupMatchMock: func(m *MockMatchRepository) {
+				m.On("CreateOrUpdateMatch", mock.Anything, uint(1), uint(2)).Return(uint(100), false, nil)
+			},
+			expectedMatch:   true,
+			expectedMatchID: 100,
+			repeated:        true,
+		},
+		{
+			name:         "repeated like",
+			userID:       1,
+			targetUserID: 2,
+			swipedRight:  true,
+			userRepo:     verifiedUsers(1, 2),
+			setupSwipeMock: func(m *MockSwipeRepository) {
+				m.On("UpsertSwipe", mock.Anything, mock.AnythingOfType("*repository.Swipe")).Return(false, nil)
+				m.On("CheckForMatch", mock.Anything, uint(1), uint(2)).Return(false, nil)
+			},
+			setupMatchMock: func(m *MockMatchRepository) {},
+			repeated:       true,
+		},
+		{
+			name:         "failed commit",
+			userID:       1,
+			targetUserID: 2,
+			swipedRight:  true,
+			userRepo:     verifiedUsers(1, 2),
+			commitErr:    errors.New("commit failed"),
+			setupSwipeMock: func(m *MockSwipeRepository) {
+				m.On("UpsertSwipe", mock.Anything, mock.AnythingOfType("*repository.Swipe")).Return(true, nil)
+				m.On("CheckForMatch", mock.Anything, uint(1), uint(2)).Return(true, nil)
+			},
+			setupMatchMock: func(m *MockMatchRepository) {
+				m.On("CreateOrUpdateMatch", mock.Anything, uint(1), uint(2)).Return(uint(100), true, nil)
+			},
+			expectedErr: errors.New("commit failed"),
+		},
 		{
 			name:         "failed to add sipe",
 			userID:       1,
 			targetUserID: 2,
 			swipedRight:  true,
+			userRepo:     verifiedUsers(1, 2),
 			setupSwipeMock: func(m *MockSwipeRepository) {
-				m.On("AddSwipe", mock.Anything, mock.AnythingOfType("*repository.Swipe")).Return(errors.New("database error"))
+				m.On("UpsertSwipe", mock.Anything, mock.AnythingOfType("*repository.Swipe")).Return(false, errors.New("database error"))
 			},
 			setupMatchMock: func(m *MockMatchRepository) {
-				m.On("CreateOrUpdateMatch", mock.Anything, uint(1), uint(2)).Return(uint(100), nil)
+				m.On("CreateOrUpdateMatch", mock.Anything, uint(1), uint(2)).Return(uint(100), true, nil)
 			},
 			expectedMatch:   false,
 			expectedMatchID: 0,
 			expectedErr:     errors.New("failed to add swipe: database error"),
 		},
+		{
+			name:         "second swipe rejected",
+			userID:       1,
+			targetUserID: 2,
+			swipedRight:  true,
+			conflictMode: constant.SwipeConflictReject,
+			userRepo:     verifiedUsers(1, 2),
+			setupSwipeMock: func(m *MockSwipeRepository) {
+				m.On("AddSwipe", mock.Anything, mock.AnythingOfType("*repository.Swipe")).Return(constant.ErrSwipeConflict)
+			},
+			setupMatchMock: func(m *MockMatchRepository) {},
+			expectedErr:    constant.ErrSwipeConflict,
+		},
+		{
+			name:         "first swipe in reject mode",
+			userID:       1,
+			targetUserID: 2,
+			swipedRight:  false,
+			conflictMode: constant.SwipeConflictReject,
+			userRepo:     verifiedUsers(1, 2),
+			setupSwipeMock: func(m *MockSwipeRepository) {
+				m.On("AddSwipe", mock.Anything, mock.AnythingOfType("*repository.Swipe")).Return(nil)
+			},
+			setupMatchMock: func(m *MockMatchRepository) {},
+		},
+		{
+			name:           "unverified swiper",
+			userID:         1,
+			targetUserID:   2,
+			swipedRight:    true,
+			userRepo:       &MockUserRepository{Users: map[uint]*repository.User{1: {}, 2: verifiedUsers(2).Users[2]}},
+			setupSwipeMock: func(m *MockSwipeRepository) {},
+			setupMatchMock: func(m *MockMatchRepository) {},
+			expectedErr:    constant.ErrEmailNotVerified,
+		},
+		{
+			name:           "unverified target",
+			userID:         1,
+			targetUserID:   2,
+			swipedRight:    true,
+			userRepo:       &MockUserRepository{Users: map[uint]*repository.User{1: verifiedUsers(1).Users[1], 2: {}}},
+			setupSwipeMock: func(m *MockSwipeRepository) {},
+			setupMatchMock: func(m *MockMatchRepository) {},
+			expectedErr:    constant.ErrTargetNotVerified,
+		},
+		{
+			name:           "nonexistent target",
+			userID:         1,
+			targetUserID:   3,
+			swipedRight:    true,
+			userRepo:       verifiedUsers(1),
+			setupSwipeMock: func(m *MockSwipeRepository) {},
+			setupMatchMock: func(m *MockMatchRepository) {},
+			expectedErr:    constant.ErrTargetNotFound,
+		},
+		{
+			name:           "unmatched pair",
+			userID:         1,
+			targetUserID:   2,
+			swipedRight:    true,
+			unmatched:      true,
+			userRepo:       verifiedUsers(1, 2),
+			setupSwipeMock: func(m *MockSwipeRepository) {},
+			setupMatchMock: func(m *MockMatchRepository) {},
+			expectedErr:    constant.ErrTargetBlocked,
+		},
+		{
+			name:           "blocked pair",
+			userID:         1,
+			targetUserID:   2,
+			swipedRight:    true,
+			blocked:        true,
+			userRepo:       verifiedUsers(1, 2),
+			setupSwipeMock: func(m *MockSwipeRepository) {},
+			setupMatchMock: func(m *MockMatchRepository) {},
+			expectedErr:    constant.ErrTargetBlocked,
+		},
+		{
+			name:           "self swipe",
+			userID:         1,
+			targetUserID:   1,
+			swipedRight:    true,
+			userRepo:       verifiedUsers(1),
+			setupSwipeMock: func(m *MockSwipeRepository) {},
+			setupMatchMock: func(m *MockMatchRepository) {},
+			expectedErr:    constant.ErrSelfSwipe,
+		},
+		{
+			name:           "target hidden from discovery",
+			userID:         1,
+			targetUserID:   2,
+			swipedRight:    true,
+			userRepo:       verifiedUsers(1, 2),
+			preferences:    map[uint]*repository.Preferences{2: {UserID: 2, ShowMe: false}},
+			setupSwipeMock: func(m *MockSwipeRepository) {},
+			setupMatchMock: func(m *MockMatchRepository) {},
+			expectedErr:    constant.ErrTargetBlocked,
+		},
+		{
+			name:         "target visible in discovery",
+			userID:       1,
+			targetUserID: 2,
+			swipedRight:  false,
+			userRepo:     verifiedUsers(1, 2),
+			preferences:  map[uint]*repository.Preferences{2: {UserID: 2, ShowMe: true}},
+			setupSwipeMock: func(m *MockSwipeRepository) {
+				m.On("UpsertSwipe", mock.Anything, mock.AnythingOfType("*repository.Swipe")).Return(true, nil)
+			},
+			setupMatchMock: func(m *MockMatchRepository) {},
+		},
 	}
 
 	logger, _ := zap.NewDevelopment()
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockSwipeRepo := new(MockSwipeRepository)
-			mockMatchRepo := new(MockMatchRepository)
+			mockMatchRepo := &MockMatchRepository{Unmatched: tt.unmatched}
 			tt.setupMatchMock(mockMatchRepo)
 			tt.setupSwipeMock(mockSwipeRepo)
-			logic := NewSwipeLogic(mockSwipeRepo, mockMatchRepo, logger)
+			uow := &MockUnitOfWork{Repos: &repository.Repository{SwipeRepo: mockSwipeRepo, MatchRepo: mockMatchRepo, BlockRepo: &MockBlockRepository{Blocked: tt.blocked}}, CommitErr: tt.commitErr}
+			events := hub.New(constant.EventBufferSize, constant.EventLogSize, constant.EventLogRetention)
+			swiper, target := events.Subscribe(tt.userID), events.Subscribe(tt.targetUserID)
+			logic := NewSwipeLogic(tt.userRepo, &MockPreferencesRepository{Preferences: tt.preferences}, uow, cmp.Or(tt.conflictMode, constant.SwipeConflictUpsert), events, logger)
 
 			matched, matchID, err := logic.ProcessSwipe(context.Background(), tt.userID, tt.targetUserID, tt.swipedRight)
 
+			// both users are told about a new match with the other user of the match, a new like without a match is anonymous.
+			// Nothing is published for a repeated swipe or a swipe that was not committed
+			switch {
+			case tt.repeated || err != nil:
+				assert.Empty(t, published(swiper))
+				assert.Empty(t, published(target))
+			case matched:
+				assert.Equal(t, []hub.Event{{ID: events.Epoch() + "-1", Type: constant.EventMatchCreated, Data: model.MatchCreatedEvent{MatchID: matchID, UserID: tt.targetUserID}}}, published(swiper))
+				assert.Equal(t, []hub.Event{{ID: events.Epoch() + "-1", Type: constant.EventMatchCreated, Data: model.MatchCreatedEvent{MatchID: matchID, UserID: tt.userID}}}, published(target))
+			case tt.swipedRight && err == nil:
+				assert.Empty(t, published(swiper))
+				assert.Equal(t, []hub.Event{{ID: events.Epoch() + "-1", Type: constant.EventLikeReceived}}, published(target))
+			default:
+				assert.Empty(t, published(swiper))
+				assert.Empty(t, published(target))
+			}
+
 			assert.Equal(t, tt.expectedMatch, matched)
 			if matched {
 				assert.Equal(t, tt.expectedMatchID, matchID)
@@ -120,7 +415,161 @@ func TestSwipeLogic_ProcessSwipe(t *testing.T) {
 			} else {
 				assert.NoError(t, err)
 			}
+			mockSwipeRepo.AssertExpectations(t)
 
 		})
 	}
 }
+
+// memoryDatabase stores swipes and matches like PostgreSQL with the read committed isolation, a transaction only sees
+// the committed rows and its own, and the pair locks are held until the transaction ends
+type memoryDatabase struct {
+	mu         sync.Mutex
+	swipes     map[[2]uint]bool
+	matches    map[[2]uint]uint
+	duplicates int
+	locks      sync.Map
+}
+
+func newMemoryDatabase() *memoryDatabase {
+	return &memoryDatabase{swipes: make(map[[2]uint]bool), matches: make(map[[2]uint]uint)}
+}
+
+func (db *memoryDatabase) WithinTransaction(ctx context.Context, fn func(repos *repository.Repository) error) error {
+	tx := &memoryTransaction{db: db, swipes: make(map[[2]uint]bool), matches: make(map[[2]uint]uint)}
+	defer tx.unlock()
+	if err := fn(&repository.Repository{SwipeRepo: tx, MatchRepo: tx, BlockRepo: tx}); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for key, right := range tx.swipes {
+		db.swipes[key] = right
+	}
+	for pair, id := range tx.matches {
+		if _, ok := db.matches[pair]; ok {
+			db.duplicates++
+			continue
+		}
+		db.matches[pair] = id
+	}
+	return nil
+}
+
+type memoryTransaction struct {
+	repository.SwipeRepository
+	repository.MatchRepository
+	repository.BlockRepository
+	db      *memoryDatabase
+	swipes  map[[2]uint]bool
+	matches map[[2]uint]uint
+	held    []*sync.Mutex
+}
+
+func userPair(userID, targetUserID uint) [2]uint {
+	if userID > targetUserID {
+		return [2]uint{targetUserID, userID}
+	}
+	return [2]uint{userID, targetUserID}
+}
+
+func (tx *memoryTransaction) LockUserPair(ctx context.Context, userID, targetUserID uint) error {
+	lock, _ := tx.db.locks.LoadOrStore(userPair(userID, targetUserID), &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	tx.held = append(tx.held, lock.(*sync.Mutex))
+	return nil
+}
+
+func (tx *memoryTransaction) unlock() {
+	for _, lock := range tx.held {
+		lock.Unlock()
+	}
+}
+
+func (tx *memoryTransaction) UpsertSwipe(ctx context.Context, swipe *repository.Swipe) (bool, error) {
+	tx.swipes[[2]uint{swipe.UserID, swipe.TargetUserID}] = swipe.SwipedRight
+	roundTrip()
+	return true, nil
+}
+
+func (tx *memoryTransaction) CheckForMatch(ctx context.Context, userID, targetUserID uint) (bool, error) {
+	tx.db.mu.Lock()
+	right := tx.db.swipes[[2]uint{targetUserID, userID}]
+	tx.db.mu.Unlock()
+	roundTrip()
+	return right, nil
+}
+
+// roundTrip lets the other transactions run in between the statements like the round trips to a database do
+func roundTrip() {
+	time.Sleep(time.Millisecond)
+}
+
+// IsUnmatched reports false, the pairs of the memory database are never unmatched
+func (tx *memoryTransaction) IsUnmatched(ctx context.Context, userID, targetUserID uint) (bool, error) {
+	return false, nil
+}
+
+// IsBlocked reports false, the users of the memory database never block each other
+func (tx *memoryTransaction) IsBlocked(ctx context.Context, userID, otherUserID uint) (bool, error) {
+	return false, nil
+}
+
+func (tx *memoryTransaction) CreateOrUpdateMatch(ctx context.Context, userID, targetUserID uint) (uint, bool, error) {
+	pair := userPair(userID, targetUserID)
+	tx.db.mu.Lock()
+	id, ok := tx.db.matches[pair]
+	tx.db.mu.Unlock()
+	if !ok {
+		id = pair[0]*1000 + pair[1]
+		tx.matches[pair] = id
+	}
+	return id, !ok, nil
+}
+
+func TestSwipeLogic_ProcessSwipeConcurrently(t *testing.T) {
+	logger := zap.NewNop()
+	const pairs = 20
+	ids := make([]uint, 0, 2*pairs)
+	for i := uint(1); i <= 2*pairs; i++ {
+		ids = append(ids, i)
+	}
+	db := newMemoryDatabase()
+	logic := NewSwipeLogic(verifiedUsers(ids...), &MockPreferencesRepository{}, db, constant.SwipeConflictUpsert, hub.New(constant.EventBufferSize, constant.EventLogSize, constant.EventLogRetention), logger)
+
+	// both users of every pair swipe right on each other at the same time
+	type result struct {
+		matched bool
+		matchID uint
+		err     error
+	}
+	results := make([]result, 2*pairs)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 2*pairs; i++ {
+		userID := uint(i + 1)
+		targetUserID := userID + 1
+		if i%2 == 1 {
+			targetUserID = userID - 1
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			matched, matchID, err := logic.ProcessSwipe(context.Background(), userID, targetUserID, true)
+			results[i] = result{matched, matchID, err}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	// exactly one swipe of every pair sees the other one and creates the single match of the pair
+	for i := 0; i < 2*pairs; i += 2 {
+		assert.NoError(t, results[i].err)
+		assert.NoError(t, results[i+1].err)
+		assert.True(t, results[i].matched != results[i+1].matched, "pair %d must match exactly once", i/2)
+	}
+	assert.Len(t, db.matches, pairs)
+	assert.Zero(t, db.duplicates)
+}
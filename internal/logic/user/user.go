@@ -2,17 +2,26 @@ package user
 
 import (
 	"context"
+	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/a-berahman/dating-app/constant"
 	"github.com/a-berahman/dating-app/internal/repository"
+	hash "github.com/a-berahman/dating-app/pkg/hash"
+	"github.com/a-berahman/dating-app/pkg/mailer"
+	"github.com/a-berahman/dating-app/pkg/utils"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
 // UserLogic handles business logic for user operations
 type UserLogic struct {
-	userRepo repository.UserRepository
-	logger   *zap.Logger
+	userRepo   repository.UserRepository
+	verifyRepo repository.VerificationRepository
+	mailer     mailer.Mailer
+	baseURL    string
+	logger     *zap.Logger
 }
 
 // UserOptions holds the options for user registration
@@ -23,15 +32,19 @@ type UserOptions struct {
 	gender   constant.UserGender
 	dob      time.Time
 	lat, lng float64
+	verified bool
 }
 
 type UserOption func(*UserOptions) // functional options for user registration
 
-// NewUserLogic creates a new instance of UserLogic
-func NewUserLogic(repo repository.UserRepository, logger *zap.Logger) *UserLogic {
+// NewUserLogic creates a new instance of UserLogic, the base URL is used to build the link of the verification email
+func NewUserLogic(repo repository.UserRepository, verifyRepo repository.VerificationRepository, m mailer.Mailer, baseURL string, logger *zap.Logger) *UserLogic {
 	return &UserLogic{
-		userRepo: repo,
-		logger:   logger,
+		userRepo:   repo,
+		verifyRepo: verifyRepo,
+		mailer:     m,
+		baseURL:    baseURL,
+		logger:     logger,
 	}
 }
 
@@ -54,10 +67,87 @@ func (ul *UserLogic) RegisterUser(ctx context.Context, opts ...UserOption) (uint
 		return 0, err
 	}
 
+	if options.verified {
+		if err := ul.userRepo.MarkVerified(ctx, userId); err != nil {
+			ul.logger.Error("failed to mark user as verified", zap.Uint("userId", userId), zap.Error(err))
+			return 0, err
+		}
+	} else if err := ul.sendVerification(ctx, userId, options.email, options.name); err != nil {
+		// the account exists at this point, the user can ask for a new email instead of registering again
+		ul.logger.Error("failed to send verification email", zap.Uint("userId", userId), zap.Error(err))
+	}
+
 	ul.logger.Info("user registered successfully", zap.Uint("userId", userId))
 	return userId, nil
 }
 
+// VerifyEmail confirms the email of the user the verification token was sent to
+func (ul *UserLogic) VerifyEmail(ctx context.Context, token string) error {
+	stored, err := ul.verifyRepo.FindVerificationToken(ctx, hash.SHA256(token))
+	if err != nil {
+		ul.logger.Error("failed to find verification token", zap.Error(err))
+		return errors.Wrap(err, "failed to find the verification token")
+	}
+	if stored == nil || stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return constant.ErrInvalidVerificationToken
+	}
+
+	marked, err := ul.verifyRepo.MarkVerificationTokenUsed(ctx, stored.ID)
+	if err != nil {
+		ul.logger.Error("failed to mark verification token as used", zap.Error(err))
+		return errors.Wrap(err, "failed to use the verification token")
+	}
+	if !marked {
+		return constant.ErrInvalidVerificationToken
+	}
+
+	if err := ul.userRepo.MarkVerified(ctx, stored.UserID); err != nil {
+		ul.logger.Error("failed to mark user as verified", zap.Uint("userId", stored.UserID), zap.Error(err))
+		return errors.Wrap(err, "failed to verify the user")
+	}
+
+	ul.logger.Info("email verified", zap.Uint("userId", stored.UserID))
+	return nil
+}
+
+// ResendVerification sends a new verification email, unknown and already verified emails are ignored
+// so callers cannot tell which emails are registered
+func (ul *UserLogic) ResendVerification(ctx context.Context, email string) error {
+	user, err := ul.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		ul.logger.Error("failed to find user by email", zap.Error(err))
+		return errors.Wrap(err, "failed to find the user")
+	}
+	if user == nil || user.VerifiedAt != nil {
+		return nil
+	}
+	return ul.sendVerification(ctx, user.ID, user.Email, user.Name)
+}
+
+func (ul *UserLogic) sendVerification(ctx context.Context, userID uint, email, name string) error {
+	token, err := utils.GenerateRandomToken(constant.EmailVerificationTokenSize)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate the verification token")
+	}
+	if err := ul.verifyRepo.CreateVerificationToken(ctx, &repository.EmailVerificationToken{
+		UserID:    userID,
+		TokenHash: hash.SHA256(token),
+		ExpiresAt: time.Now().Add(constant.EmailVerificationTTL),
+	}); err != nil {
+		return errors.Wrap(err, "failed to store the verification token")
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", ul.baseURL, url.QueryEscape(token))
+	if err := ul.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your email",
+		Body:    fmt.Sprintf("Hi %s,\n\nUse the link below to verify your email, it expires in %s.\n\n%s\n", name, constant.EmailVerificationTTL, link),
+	}); err != nil {
+		return errors.Wrap(err, "failed to send the verification email")
+	}
+	return nil
+}
+
 func newUserOptions(opts ...UserOption) UserOptions {
 	uo := UserOptions{}
 	for _, opt := range opts {
@@ -102,3 +192,10 @@ func WithLocation(lat, lng float64) UserOption {
 		uo.lng = lng
 	}
 }
+
+// WithVerified registers the user with an already verified email, it is meant for generated users
+func WithVerified() UserOption {
+	return func(uo *UserOptions) {
+		uo.verified = true
+	}
+}
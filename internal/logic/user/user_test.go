@@ -3,14 +3,20 @@ package user
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/a-berahman/dating-app/constant"
 	"github.com/a-berahman/dating-app/internal/repository"
+	hash "github.com/a-berahman/dating-app/pkg/hash"
+	"github.com/a-berahman/dating-app/pkg/mailer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 type MockUserRepository struct {
@@ -33,6 +39,24 @@ func (m *MockUserRepository) FindByEmail(ctx context.Context, email string) (*re
 func (m *MockUserRepository) FindByID(ctx context.Context, id uint) (*repository.User, error) {
 	return nil, nil
 }
+func (m *MockUserRepository) SetTokensValidAfter(ctx context.Context, userID uint, validAfter time.Time) error {
+	return nil
+}
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, userID uint, password string) error {
+	return nil
+}
+func (m *MockUserRepository) MarkVerified(ctx context.Context, userID uint) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateLocation(ctx context.Context, userID uint, lat, lng float64) error {
+	args := m.Called(ctx, userID, lat, lng)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateLastActive(ctx context.Context, userID uint, activeAt time.Time) error {
+	args := m.Called(ctx, userID, activeAt)
+	return args.Error(0)
+}
 func (m *MockUserRepository) Authenticate(ctx context.Context, email, password string) (*repository.User, error) {
 	return nil, nil
 }
@@ -47,11 +71,46 @@ func (m *MockUserRepository) CheckForMatch(ctx context.Context, userID, targetUs
 	return false, nil
 }
 
+type MockVerificationRepository struct {
+	Stored  *repository.EmailVerificationToken
+	Marked  bool
+	Err     error
+	Created []*repository.EmailVerificationToken
+}
+
+func (m *MockVerificationRepository) CreateVerificationToken(ctx context.Context, token *repository.EmailVerificationToken) error {
+	m.Created = append(m.Created, token)
+	return m.Err
+}
+func (m *MockVerificationRepository) FindVerificationToken(ctx context.Context, tokenHash string) (*repository.EmailVerificationToken, error) {
+	return m.Stored, m.Err
+}
+func (m *MockVerificationRepository) MarkVerificationTokenUsed(ctx context.Context, id uint) (bool, error) {
+	return m.Marked, m.Err
+}
+
+// MockMailer records the sent messages and passes them on to Next when it is set
+type MockMailer struct {
+	Sent []mailer.Message
+	Err  error
+	Next mailer.Mailer
+}
+
+func (m *MockMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.Sent = append(m.Sent, msg)
+	if m.Next != nil {
+		if err := m.Next.Send(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return m.Err
+}
+
 func TestUserLogic_RegisterUser(t *testing.T) {
 	ctx := context.Background()
 	mockRepo := new(MockUserRepository)
 	logger, _ := zap.NewDevelopment()
-	userLogic := NewUserLogic(mockRepo, logger)
+	userLogic := NewUserLogic(mockRepo, &MockVerificationRepository{}, &MockMailer{}, "https://app.example.com", logger)
 
 	tests := []struct {
 		name          string
@@ -126,3 +185,145 @@ func TestUserLogic_RegisterUser(t *testing.T) {
 		})
 	}
 }
+
+func TestUserLogic_RegisterUserVerification(t *testing.T) {
+	ctx := context.Background()
+	logger, _ := zap.NewDevelopment()
+
+	tests := []struct {
+		name       string
+		opts       []UserOption
+		mailer     *MockMailer
+		expectMail bool
+		expectMark bool
+	}{
+		{
+			name:       "verification email is sent on registration",
+			opts:       []UserOption{WithEmail("jane@example.com"), WithName("Jane")},
+			mailer:     &MockMailer{},
+			expectMail: true,
+		},
+		{
+			name:       "mailer failure does not fail the registration",
+			opts:       []UserOption{WithEmail("jane@example.com"), WithName("Jane")},
+			mailer:     &MockMailer{Err: errors.New("smtp error")},
+			expectMail: true,
+		},
+		{
+			name:       "verified users are marked without an email",
+			opts:       []UserOption{WithEmail("jane@example.com"), WithName("Jane"), WithVerified()},
+			mailer:     &MockMailer{},
+			expectMark: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			mockRepo.On("FindByEmail", ctx, "jane@example.com").Return(nil, nil)
+			mockRepo.On("Create", ctx, "jane@example.com", "", "Jane", constant.UserGender(""), mock.AnythingOfType("time.Time"), 0.0, 0.0).Return(nil)
+			if tc.expectMark {
+				mockRepo.On("MarkVerified", ctx, uint(0)).Return(nil)
+			}
+			verifyRepo := &MockVerificationRepository{}
+			userLogic := NewUserLogic(mockRepo, verifyRepo, tc.mailer, "https://app.example.com", logger)
+
+			_, err := userLogic.RegisterUser(ctx, tc.opts...)
+			assert.NoError(t, err)
+			mockRepo.AssertExpectations(t)
+			if !tc.expectMail {
+				assert.Empty(t, tc.mailer.Sent)
+				assert.Empty(t, verifyRepo.Created)
+				return
+			}
+			if assert.Len(t, tc.mailer.Sent, 1) && assert.Len(t, verifyRepo.Created, 1) {
+				body := tc.mailer.Sent[0].Body
+				assert.Equal(t, "jane@example.com", tc.mailer.Sent[0].To)
+				token := strings.TrimSpace(body[strings.Index(body, "token=")+len("token="):])
+				assert.Equal(t, hash.SHA256(token), verifyRepo.Created[0].TokenHash, "Only the hash of the token should be stored")
+			}
+		})
+	}
+}
+
+func TestUserLogic_VerificationTokenNotLogged(t *testing.T) {
+	ctx := context.Background()
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(core)
+	mockRepo := new(MockUserRepository)
+	mockRepo.On("FindByEmail", ctx, "jane@example.com").Return(&repository.User{Email: "jane@example.com", Name: "Jane"}, nil)
+	sent := &MockMailer{Next: mailer.NewLogMailer(logger)}
+	userLogic := NewUserLogic(mockRepo, &MockVerificationRepository{}, sent, "https://app.example.com", logger)
+
+	assert.NoError(t, userLogic.ResendVerification(ctx, "jane@example.com"))
+	if !assert.Len(t, sent.Sent, 1) {
+		return
+	}
+	body := sent.Sent[0].Body
+	token := strings.TrimSpace(body[strings.Index(body, "token=")+len("token="):])
+	assert.NotEmpty(t, token)
+	assert.NotZero(t, logs.Len())
+	for _, entry := range logs.All() {
+		assert.NotContains(t, entry.Message, token)
+		for key, value := range entry.ContextMap() {
+			assert.NotContains(t, fmt.Sprint(value), token, "the field %s holds the verification token", key)
+		}
+	}
+}
+
+func TestUserLogic_VerifyEmail(t *testing.T) {
+	ctx := context.Background()
+	logger, _ := zap.NewDevelopment()
+	usedAt := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name        string
+		verifyRepo  *MockVerificationRepository
+		expectedErr error
+	}{
+		{
+			name: "successful verification",
+			verifyRepo: &MockVerificationRepository{
+				Stored: &repository.EmailVerificationToken{UserID: 7, ExpiresAt: time.Now().Add(time.Hour)},
+				Marked: true,
+			},
+		},
+		{
+			name:        "unknown token",
+			verifyRepo:  &MockVerificationRepository{},
+			expectedErr: constant.ErrInvalidVerificationToken,
+		},
+		{
+			name: "expired token",
+			verifyRepo: &MockVerificationRepository{
+				Stored: &repository.EmailVerificationToken{UserID: 7, ExpiresAt: time.Now().Add(-time.Minute)},
+			},
+			expectedErr: constant.ErrInvalidVerificationToken,
+		},
+		{
+			name: "used token",
+			verifyRepo: &MockVerificationRepository{
+				Stored: &repository.EmailVerificationToken{UserID: 7, ExpiresAt: time.Now().Add(time.Hour), UsedAt: &usedAt},
+			},
+			expectedErr: constant.ErrInvalidVerificationToken,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			if tc.expectedErr == nil {
+				mockRepo.On("MarkVerified", ctx, uint(7)).Return(nil)
+			}
+			userLogic := NewUserLogic(mockRepo, tc.verifyRepo, &MockMailer{}, "https://app.example.com", logger)
+
+			err := userLogic.VerifyEmail(ctx, "token")
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
@@ -1,9 +1,32 @@
 package model
 
-import "github.com/golang-jwt/jwt"
+import (
+	"time"
 
-// Claims is a struct that will be encoded to a JWT
+	"github.com/golang-jwt/jwt"
+)
+
+// Claims is a struct that will be encoded to a JWT, the Id of the standard claims is the jti that identifies the token for revocation
 type Claims struct {
 	jwt.StandardClaims
 	UserID uint
+	// IssuedAtMilli is the issue time in milliseconds, the iat of the standard claims only has whole seconds
+	IssuedAtMilli int64 `json:"iatms,omitempty"`
+	// MFAPending marks the token of a password login that still needs a second factor, it is not an access token
+	MFAPending bool `json:",omitempty"`
+}
+
+// TokenPair is a short-lived access token with the refresh token that renews it,
+// when the user has two-factor authentication enabled only the MFA token is set until a code is given
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	MFAToken     string
+	ExpiresAt    time.Time
+}
+
+// TOTPEnrollment is the secret of a new TOTP credential with the URI that authenticator apps read from a QR code
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
 }
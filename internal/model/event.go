@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// MatchCreatedEvent is the payload of the match created event, the user is the other user of the match
+type MatchCreatedEvent struct {
+	MatchID uint `json:"matchId"`
+	UserID  uint `json:"userId"`
+}
+
+// MessageCreatedEvent is the payload of the message created event
+type MessageCreatedEvent struct {
+	ID        uint      `json:"id"`
+	MatchID   uint      `json:"matchId"`
+	SenderID  uint      `json:"senderId"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// MessageDeliveredEvent is the payload of the message delivered event, the messages of the match up to the message have reached a device of the user
+type MessageDeliveredEvent struct {
+	MatchID   uint `json:"matchId"`
+	UserID    uint `json:"userId"`
+	MessageID uint `json:"messageId"`
+}
+
+// MessageReadEvent is the payload of the message read event, the user has read the messages of the match up to the message
+type MessageReadEvent struct {
+	MatchID   uint `json:"matchId"`
+	UserID    uint `json:"userId"`
+	MessageID uint `json:"messageId"`
+}
+
+// TypingEvent is the payload of the typing event, the user is the one typing in the match
+type TypingEvent struct {
+	MatchID uint `json:"matchId"`
+	UserID  uint `json:"userId"`
+}
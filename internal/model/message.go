@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// Message is the model for a message between the users of a match, Delivered tells whether it has reached a device of the recipient
+// and Read whether the recipient has read it
+type Message struct {
+	ID        uint
+	MatchID   uint
+	SenderID  uint
+	Body      string
+	CreatedAt time.Time
+	Delivered bool
+	Read      bool
+}
+
+// MessageList is the model for a page of a conversation, the next cursor is empty on the last page
+type MessageList struct {
+	Messages   []Message
+	NextCursor string
+}
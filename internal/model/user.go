@@ -15,9 +15,73 @@ type UserDTO struct {
 	DateOfBirth time.Time
 	Location    Point
 	Age         int
+	Verified    bool
+	Profile     *Profile
+	Distance    *float64 // meters from the user who discovered them, it is only set by the discovery of a user with a location
+}
+
+// Profile is the model for the profile data transfer, a nil height means the user did not share it
+type Profile struct {
+	Bio       string
+	JobTitle  string
+	School    string
+	Height    *int
+	Interests []string
+	Prompts   []Prompt
+	Photos    []Photo
+}
+
+// Prompt is the answer of a user to a profile question
+type Prompt struct {
+	Question string
+	Answer   string
+}
+
+// Photo is the metadata of a profile photo
+type Photo struct {
+	URL    string
+	Width  int
+	Height int
 }
 
 type Point struct {
 	Lat float64
 	Lng float64
 }
+
+// Preferences is the model for the discovery preferences, no genders means every gender
+type Preferences struct {
+	Genders     []constant.UserGender
+	MinAge      int
+	MaxAge      int
+	MaxDistance float64
+	ShowMe      bool
+}
+
+// Discovery is the model for a page of a discovery, the next cursor is empty on the last page
+type Discovery struct {
+	Matches    []UserDTO
+	NextCursor string
+}
+
+// Match is the model for a match of the user, User is the other user of the pair
+type Match struct {
+	ID             uint
+	User           UserDTO
+	MatchedAt      time.Time
+	LastActivityAt time.Time
+	UnreadCount    int
+}
+
+// MatchList is the model for a page of the matches of a user, the next cursor is empty on the last page
+type MatchList struct {
+	Matches    []Match
+	NextCursor string
+}
+
+// Block is the model for a user blocked by the user
+type Block struct {
+	UserID    uint
+	Name      string
+	BlockedAt time.Time
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm/clause"
+)
+
+// Block blocks the user for the blocker, it reports false if the blocker has already blocked the user
+func (r *repo) Block(ctx context.Context, userID, blockedUserID uint) (bool, error) {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "user_id"}, {Name: "blocked_user_id"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "deleted_at IS NULL"}}},
+		DoNothing:   true,
+	}).Create(&Block{UserID: userID, BlockedUserID: blockedUserID})
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "blocking user")
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Unblock removes the block of the user, it reports false if the blocker has not blocked the user
+func (r *repo) Unblock(ctx context.Context, userID, blockedUserID uint) (bool, error) {
+	result := r.db.WithContext(ctx).Where("user_id = ? AND blocked_user_id = ?", userID, blockedUserID).Delete(&Block{})
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "unblocking user")
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ListBlocks returns the blocks of the user with the blocked users, the latest first. The blocks of deleted users are left out
+func (r *repo) ListBlocks(ctx context.Context, userID uint) ([]Block, error) {
+	var blocks []Block
+	err := r.db.WithContext(ctx).Preload("BlockedUser").
+		Joins("JOIN users AS blocked_user ON blocked_user.id = blocks.blocked_user_id AND blocked_user.deleted_at IS NULL").
+		Where("blocks.user_id = ?", userID).
+		Order("blocks.id DESC").
+		Find(&blocks).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "listing blocks")
+	}
+	return blocks, nil
+}
+
+// IsBlocked reports whether either of the users has blocked the other
+func (r *repo) IsBlocked(ctx context.Context, userID, otherUserID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&Block{}).
+		Where("(user_id = ? AND blocked_user_id = ?) OR (user_id = ? AND blocked_user_id = ?)", userID, otherUserID, otherUserID, userID).
+		Count(&count).Error
+	if err != nil {
+		return false, errors.Wrap(err, "checking for block")
+	}
+	return count > 0, nil
+}
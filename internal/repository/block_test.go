@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlock(t *testing.T) {
+	db, mock, err := NewMock()
+	assert.NoError(t, err)
+	repo := repo{db}
+
+	query := regexp.QuoteMeta(`INSERT INTO "blocks" ("created_at","updated_at","deleted_at","user_id","blocked_user_id") VALUES ($1,$2,$3,$4,$5) ` +
+		`ON CONFLICT ("user_id","blocked_user_id") WHERE deleted_at IS NULL DO NOTHING RETURNING "id"`)
+	mock.ExpectBegin()
+	mock.ExpectQuery(query).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, 1, 2).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectCommit()
+	blocked, err := repo.Block(context.Background(), 1, 2)
+	assert.NoError(t, err)
+	assert.True(t, blocked)
+
+	// blocking the user again keeps the first block
+	mock.ExpectBegin()
+	mock.ExpectQuery(query).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, 1, 2).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+	blocked, err = repo.Block(context.Background(), 1, 2)
+	assert.NoError(t, err)
+	assert.False(t, blocked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnblock(t *testing.T) {
+	db, mock, err := NewMock()
+	assert.NoError(t, err)
+	repo := repo{db}
+
+	query := regexp.QuoteMeta(`UPDATE "blocks" SET "deleted_at"=$1 WHERE (user_id = $2 AND blocked_user_id = $3) AND "blocks"."deleted_at" IS NULL`)
+	mock.ExpectBegin()
+	mock.ExpectExec(query).WithArgs(sqlmock.AnyArg(), 1, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	unblocked, err := repo.Unblock(context.Background(), 1, 2)
+	assert.NoError(t, err)
+	assert.True(t, unblocked)
+
+	// only the blocker can remove the block
+	mock.ExpectBegin()
+	mock.ExpectExec(query).WithArgs(sqlmock.AnyArg(), 2, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	unblocked, err = repo.Unblock(context.Background(), 2, 1)
+	assert.NoError(t, err)
+	assert.False(t, unblocked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListBlocks(t *testing.T) {
+	db, mock, err := NewMock()
+	assert.NoError(t, err)
+	repo := repo{db}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "blocks"."id","blocks"."created_at","blocks"."updated_at","blocks"."deleted_at","blocks"."user_id","blocks"."blocked_user_id" FROM "blocks" ` +
+		`JOIN users AS blocked_user ON blocked_user.id = blocks.blocked_user_id AND blocked_user.deleted_at IS NULL ` +
+		`WHERE blocks.user_id = $1 AND "blocks"."deleted_at" IS NULL ORDER BY blocks.id DESC`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "blocked_user_id"}).AddRow(6, 1, 3).AddRow(5, 1, 2))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" IN ($1,$2) AND "users"."deleted_at" IS NULL`)).
+		WithArgs(3, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "Bob").AddRow(3, "Carol"))
+
+	blocks, err := repo.ListBlocks(context.Background(), 1)
+	assert.NoError(t, err)
+	if assert.Len(t, blocks, 2) && assert.NotNil(t, blocks[0].BlockedUser) {
+		assert.Equal(t, "Carol", blocks[0].BlockedUser.Name)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIsBlocked(t *testing.T) {
+	db, mock, err := NewMock()
+	assert.NoError(t, err)
+	repo := repo{db}
+
+	// a block of either user counts
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "blocks" WHERE ((user_id = $1 AND blocked_user_id = $2) OR (user_id = $3 AND blocked_user_id = $4)) `+
+		`AND "blocks"."deleted_at" IS NULL`)).
+		WithArgs(2, 1, 1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	blocked, err := repo.IsBlocked(context.Background(), 2, 1)
+	assert.NoError(t, err)
+	assert.True(t, blocked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,12 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// RecordLockout saves the audit record of a login lockout
+func (r *repo) RecordLockout(ctx context.Context, event *LockoutEvent) error {
+	return errors.Wrap(r.db.WithContext(ctx).Create(event).Error, "recording lockout")
+}
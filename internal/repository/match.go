@@ -2,52 +2,292 @@ package repository
 
 import (
 	"context"
+	"time"
 
+	"github.com/a-berahman/dating-app/constant"
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// CreateOrUpdateMatch creates or updates a match entry between two users
-func (r *repo) CreateOrUpdateMatch(ctx context.Context, userID, targetUserID uint) (uint, error) {
+// CreateOrUpdateMatch creates a match between two users or returns the existing match of the pair in either direction,
+// a match created concurrently for the same pair is returned instead of a duplicate. It reports whether the match was created
+func (r *repo) CreateOrUpdateMatch(ctx context.Context, userID, targetUserID uint) (uint, bool, error) {
+	match, err := r.findMatch(ctx, userID, targetUserID)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "checking for existing match failed")
+	}
+	if match != nil {
+		return match.ID, false, nil
+	}
+
+	match = &Match{UserID: userID, TargetUserID: targetUserID, LastActivityAt: time.Now()}
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{
+			{Name: "LEAST(user_id, target_user_id)", Raw: true},
+			{Name: "GREATEST(user_id, target_user_id)", Raw: true},
+		},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "deleted_at IS NULL"}}},
+		DoNothing:   true,
+	}).Create(match)
+	if result.Error != nil {
+		return 0, false, errors.Wrap(result.Error, "creating match failed")
+	}
+	if result.RowsAffected > 0 {
+		return match.ID, true, nil
+	}
+
+	match, err = r.findMatch(ctx, userID, targetUserID)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "finding concurrently created match failed")
+	}
+	if match == nil {
+		return 0, false, errors.New("concurrently created match not found")
+	}
+	return match.ID, false, nil
+}
+
+// FindMatch finds a match by id including the unmatched ones, it returns nil when the match does not exist
+func (r *repo) FindMatch(ctx context.Context, matchID uint) (*Match, error) {
+	var match Match
+	err := r.db.WithContext(ctx).Unscoped().First(&match, matchID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "finding match")
+	}
+	return &match, nil
+}
 
+// findMatch returns the match of the pair in either direction, it returns nil when the users have not matched
+func (r *repo) findMatch(ctx context.Context, userID, targetUserID uint) (*Match, error) {
 	var match Match
 	err := r.db.WithContext(ctx).Where("user_id = ? AND target_user_id = ?", userID, targetUserID).
 		Or("user_id = ? AND target_user_id = ?", targetUserID, userID).First(&match).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &match, nil
+}
+
+// counterpartExpr is the other user of a match for the user given as its argument, the pair is stored in either direction
+const counterpartExpr = "CASE WHEN matches.user_id = ? THEN matches.target_user_id ELSE matches.user_id END"
+
+// unreadCountExpr counts the messages of the other user after the last read message of the user given as its two arguments
+const unreadCountExpr = "(SELECT COUNT(*) FROM messages WHERE messages.match_id = matches.id AND messages.deleted_at IS NULL AND messages.sender_id <> ? " +
+	"AND messages.id > CASE WHEN matches.user_id = ? THEN matches.user_last_read_id ELSE matches.target_last_read_id END)"
+
+// ListMatches returns the matches of the user with the other user of every pair, their profile and the number of their messages
+// the user has not read, the most recently active first.
+// The matches with a deleted user are left out and a page continues after the cursor of the last match of the previous one
+func (r *repo) ListMatches(ctx context.Context, userID uint, limit int, after *MatchListCursor) ([]Match, error) {
+	var matches []Match
+	query := r.db.WithContext(ctx).Model(&Match{}).
+		Select("matches.*, "+counterpartExpr+" AS counterpart_id, "+unreadCountExpr+" AS unread_count", userID, userID, userID).
+		Preload("Counterpart.Profile").
+		Joins("JOIN users AS counterpart ON counterpart.id = "+counterpartExpr+" AND counterpart.deleted_at IS NULL", userID).
+		Where("matches.user_id = ? OR matches.target_user_id = ?", userID, userID)
+	if after != nil {
+		query = query.Where("(matches.last_activity_at, matches.id) < (?, ?)", after.LastActivityAt, after.ID)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
 
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return 0, errors.Wrap(err, "checking for existing match failed")
+	if err := query.Order("matches.last_activity_at DESC, matches.id DESC").Find(&matches).Error; err != nil {
+		return nil, errors.Wrap(err, "listing matches")
 	}
+	return matches, nil
+}
 
-	if match.ID == 0 {
-		match = Match{UserID: userID, TargetUserID: targetUserID}
-		if err := r.db.WithContext(ctx).Create(&match).Error; err != nil {
-			return 0, errors.Wrap(err, "creating match failed")
-		}
+// Unmatch deletes a match of the user with who unmatched and why, it reports false if the user has no such match
+func (r *repo) Unmatch(ctx context.Context, matchID, userID uint, reason string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&Match{}).
+		Where("id = ? AND (user_id = ? OR target_user_id = ?)", matchID, userID, userID).
+		Updates(map[string]interface{}{"unmatched_by": userID, "unmatch_reason": reason, "deleted_at": time.Now()})
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "unmatching")
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// UnmatchUser deletes the match of the pair in either direction as undone by the user, it reports false if the users have no match
+func (r *repo) UnmatchUser(ctx context.Context, userID, otherUserID uint, reason string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&Match{}).
+		Where("(user_id = ? AND target_user_id = ?) OR (user_id = ? AND target_user_id = ?)", userID, otherUserID, otherUserID, userID).
+		Updates(map[string]interface{}{"unmatched_by": userID, "unmatch_reason": reason, "deleted_at": time.Now()})
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "unmatching user")
 	}
+	return result.RowsAffected > 0, nil
+}
+
+// MarkRead moves the last read message of the user in the match forward to the given message, or to the latest message
+// of the match when it is zero. The position never moves back and never past the messages of the match, it returns the
+// match with the read positions of both users or nil if the user has no such match
+func (r *repo) MarkRead(ctx context.Context, matchID, userID, messageID uint) (*Match, error) {
+	latest := r.db.Model(&Message{}).Select("COALESCE(MAX(id), 0)").Where("match_id = ?", matchID)
+	if messageID != 0 {
+		latest = latest.Where("id <= ?", messageID)
+	}
+
+	var matches []Match
+	result := r.db.WithContext(ctx).Model(&matches).Clauses(clause.Returning{}).
+		Where("id = ? AND (user_id = ? OR target_user_id = ?)", matchID, userID, userID).
+		Updates(map[string]interface{}{
+			"user_last_read_id":   gorm.Expr("CASE WHEN user_id = ? THEN GREATEST(user_last_read_id, (?)) ELSE user_last_read_id END", userID, latest),
+			"target_last_read_id": gorm.Expr("CASE WHEN target_user_id = ? THEN GREATEST(target_last_read_id, (?)) ELSE target_last_read_id END", userID, latest),
+		})
+	if result.Error != nil {
+		return nil, errors.Wrap(result.Error, "marking messages read")
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	return &matches[0], nil
+}
 
-	return match.ID, nil
+// MarkDelivered moves the last delivered message of the user in the match forward to the latest message up to the given one
+// and returns the match, or nil when the position does not move or the match is not one of the user
+func (r *repo) MarkDelivered(ctx context.Context, matchID, userID, messageID uint) (*Match, error) {
+	latest := r.db.Model(&Message{}).Select("COALESCE(MAX(id), 0)").Where("match_id = ? AND id <= ?", matchID, messageID)
+
+	var matches []Match
+	result := r.db.WithContext(ctx).Model(&matches).Clauses(clause.Returning{}).
+		Where("id = ? AND (user_id = ? OR target_user_id = ?)", matchID, userID, userID).
+		Where("CASE WHEN user_id = ? THEN user_last_delivered_id ELSE target_last_delivered_id END < (?)", userID, latest).
+		Updates(map[string]interface{}{
+			"user_last_delivered_id":   gorm.Expr("CASE WHEN user_id = ? THEN (?) ELSE user_last_delivered_id END", userID, latest),
+			"target_last_delivered_id": gorm.Expr("CASE WHEN target_user_id = ? THEN (?) ELSE target_last_delivered_id END", userID, latest),
+		})
+	if result.Error != nil {
+		return nil, errors.Wrap(result.Error, "marking messages delivered")
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	return &matches[0], nil
+}
+
+// unmatchedPairExpr selects the matches of the pair of its two arguments, in either direction, that have been unmatched
+const unmatchedPairExpr = "unmatched_by IS NOT NULL AND unmatch_reason <> ? AND LEAST(user_id, target_user_id) = LEAST(?, ?) AND GREATEST(user_id, target_user_id) = GREATEST(?, ?)"
+
+// IsUnmatched reports whether either of the users has unmatched the other, such a pair cannot match again.
+// A match undone by a block does not count, the block keeps the pair apart on its own and they can match again once it is lifted
+func (r *repo) IsUnmatched(ctx context.Context, userID, targetUserID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Unscoped().Model(&Match{}).
+		Where(unmatchedPairExpr, string(constant.UnmatchReasonBlocked), userID, targetUserID, userID, targetUserID).
+		Count(&count).Error
+	if err != nil {
+		return false, errors.Wrap(err, "checking for unmatch")
+	}
+	return count > 0, nil
 }
 
-// FindPotentialMatches finds other users excluding the given user and their swipes and applying filters if provided
+// FindPotentialMatches finds other users excluding the given user, their swipes, the users they unmatched or were unmatched by
+// other than by a block that has been lifted, the users they blocked or were blocked by and the users hidden from discovery and applying filters if provided.
+// The filters are the preferences of the searcher, a candidate is only returned when their own preferences accept the searcher too,
+// candidates without stored preferences accept everyone of age within the default distance.
+// The candidates are ordered by the sort key of the sort and then id so a page can continue after the cursor of the previous one
 func (r *repo) FindPotentialMatches(ctx context.Context, userID uint, filters *MatchFilters, lat, lng float64) ([]User, error) {
 	var users []User
-	subQuery := r.db.WithContext(ctx).Select("target_user_id").Where("user_id = ?", userID).Table("swipes")
-	query := r.db.Model(&User{}).
+	swiped := r.db.Select("target_user_id").Where("user_id = ?", userID).Table("swipes")
+	unmatched := r.db.Select(counterpartExpr, userID).
+		Where("unmatched_by IS NOT NULL AND unmatch_reason <> ? AND (user_id = ? OR target_user_id = ?)", string(constant.UnmatchReasonBlocked), userID, userID).Table("matches")
+	blocked := r.db.Select("CASE WHEN user_id = ? THEN blocked_user_id ELSE user_id END", userID).
+		Where("(user_id = ? OR blocked_user_id = ?) AND deleted_at IS NULL", userID, userID).Table("blocks")
+	subQuery := r.db.WithContext(ctx).Raw("? UNION ? UNION ?", swiped, unmatched, blocked)
+	sortKey, sortArgs := discoverySortKey(filters.Sort, lat, lng)
+	// without a location of the searcher there is no distance, not one from the point 0, 0
+	distance, selectArgs := "NULL", sortArgs
+	if hasLocation(lat, lng) {
+		distance, selectArgs = distanceExpr, append([]interface{}{lng, lat}, sortArgs...)
+	}
+	query := r.db.WithContext(ctx).Model(&User{}).
+		Select("users.*, "+distance+" AS distance, "+sortKey+" AS sort_key", selectArgs...).
+		Preload("Profile").
+		Joins("JOIN users AS searcher ON searcher.id = ?", userID).
+		Joins("LEFT JOIN preferences AS candidate_prefs ON candidate_prefs.user_id = users.id AND candidate_prefs.deleted_at IS NULL").
 		Where("users.id <> ?", userID).
+		Where("users.verified_at IS NOT NULL").
+		Where("candidate_prefs.show_me IS NOT FALSE").
 		Not("users.id IN (?)", subQuery).
-		Where("date_of_birth >= ?", filters.MinDOB).
-		Where("date_of_birth <= ?", filters.MaxDOB)
-	if filters.Gender != "" {
-		query = query.Where("gender = ?", filters.Gender)
+		Where("users.date_of_birth >= ?", filters.MinDOB).
+		Where("users.date_of_birth <= ?", filters.MaxDOB).
+		// the candidate's gender and age preferences must accept the searcher
+		Where("candidate_prefs.genders IS NULL OR candidate_prefs.genders IN ('null', '[]') OR candidate_prefs.genders::jsonb @> jsonb_build_array(searcher.gender)").
+		Where("date_part('year', age(searcher.date_of_birth)) BETWEEN COALESCE(candidate_prefs.min_age, ?) AND COALESCE(candidate_prefs.max_age, ?)",
+			constant.MinimumUserAge, constant.DefaultPreferredMaxAge)
+	if len(filters.Genders) > 0 {
+		query = query.Where("users.gender IN ?", filters.Genders)
 	}
 
-	if filters != nil && filters.MaxDistance > 0 && lat != 0 && lng != 0 {
-		query = query.Where("ST_DWithin(location::geography, ST_MakePoint(?, ?)::geography, ?)",
-			lng, lat, filters.MaxDistance)
+	if hasLocation(lat, lng) {
+		if filters.MaxDistance > 0 {
+			query = query.Where("ST_DWithin(users.location, "+pointExpr+", ?)",
+				lng, lat, filters.MaxDistance)
+		}
+		query = query.Where("ST_DWithin(users.location, "+pointExpr+", COALESCE(candidate_prefs.max_distance, ?))",
+			lng, lat, constant.DefaultDiscoveryDistance)
 	}
 
-	if err := query.Find(&users).Error; err != nil {
+	if filters.After != nil {
+		query = query.Where("("+sortKey+", users.id) > (?, ?)", append(sortArgs, filters.After.SortKey, filters.After.ID)...)
+	}
+	if filters.Limit > 0 {
+		query = query.Limit(filters.Limit)
+	}
+
+	if err := query.Order("sort_key, users.id").Find(&users).Error; err != nil {
 		return nil, err
 	}
 	return users, nil
 }
+
+// pointExpr is the geography of its longitude and latitude arguments, the location column is compared to it
+// without a cast so the spatial index of the column can be used
+const pointExpr = "ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography"
+
+// distanceExpr is the distance in meters between a candidate and the point of its longitude and latitude arguments
+const distanceExpr = "ST_Distance(users.location, " + pointExpr + ")"
+
+// sharedInterestsExpr counts the interests of a candidate that the searcher has too
+const sharedInterestsExpr = "(SELECT count(*) FROM profiles AS candidate_profile, " +
+	"jsonb_array_elements_text(COALESCE(NULLIF(candidate_profile.interests, 'null'), '[]')::jsonb) AS interest " +
+	"WHERE candidate_profile.user_id = users.id AND candidate_profile.deleted_at IS NULL AND interest IN (" +
+	"SELECT jsonb_array_elements_text(COALESCE(NULLIF(searcher_profile.interests, 'null'), '[]')::jsonb) FROM profiles AS searcher_profile " +
+	"WHERE searcher_profile.user_id = searcher.id AND searcher_profile.deleted_at IS NULL))"
+
+// newestSortKey orders the candidates by their registration, the latest first
+const newestSortKey = "-extract(epoch FROM users.created_at)"
+
+// hasLocation reports whether the searcher has a location, a user who never shared one is at 0, 0
+func hasLocation(lat, lng float64) bool {
+	return lat != 0 || lng != 0
+}
+
+// discoverySortKey returns the expression that orders the candidates ascending with its arguments,
+// the descending orders are negated so every order pages with the same cursor. Without a location of the searcher
+// the distance does not count, the order by distance falls back to the newest candidates first
+func discoverySortKey(sort constant.DiscoverySort, lat, lng float64) (string, []interface{}) {
+	switch {
+	case sort == constant.DiscoverySortNewest:
+		return newestSortKey, nil
+	case sort == constant.DiscoverySortRecentlyActive:
+		return "-extract(epoch FROM COALESCE(users.last_active_at, users.created_at))", nil
+	case sort == constant.DiscoverySortRelevance && !hasLocation(lat, lng):
+		return "(-" + sharedInterestsExpr + ")", nil
+	case sort == constant.DiscoverySortRelevance:
+		// no two points on earth are 1e8 meters apart, so a shared interest always outweighs the distance
+		return "(" + distanceExpr + " - 1e8 * " + sharedInterestsExpr + ")", []interface{}{lng, lat}
+	case !hasLocation(lat, lng):
+		return newestSortKey, nil
+	default:
+		return distanceExpr, []interface{}{lng, lat}
+	}
+}
@@ -0,0 +1,416 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindPotentialMatchesSort(t *testing.T) {
+	filtersQuery := `FROM "users" JOIN users AS searcher ON searcher.id = $3 ` +
+		`LEFT JOIN preferences AS candidate_prefs ON candidate_prefs.user_id = users.id AND candidate_prefs.deleted_at IS NULL ` +
+		`WHERE users.id <> $4 AND users.verified_at IS NOT NULL AND candidate_prefs.show_me IS NOT FALSE`
+
+	testCases := []struct {
+		name    string
+		sort    constant.DiscoverySort
+		sortKey string
+	}{
+		{
+			name:    "Newest",
+			sort:    constant.DiscoverySortNewest,
+			sortKey: `-extract(epoch FROM users.created_at)`,
+		},
+		{
+			name:    "Recently Active",
+			sort:    constant.DiscoverySortRecentlyActive,
+			sortKey: `-extract(epoch FROM COALESCE(users.last_active_at, users.created_at))`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := NewMock()
+			assert.NoError(t, err)
+			repo := repo{db}
+
+			query := `SELECT users.*, ST_Distance(users.location, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography) AS distance, ` +
+				tc.sortKey + ` AS sort_key ` + filtersQuery
+			mock.ExpectQuery("^" + regexp.QuoteMeta(query) + ".* AND " + regexp.QuoteMeta("("+tc.sortKey+", users.id) > ($20, $21)") +
+				".* ORDER BY sort_key, users\\.id$").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+			_, err = repo.FindPotentialMatches(context.Background(), 1, &MatchFilters{Sort: tc.sort, After: &MatchCursor{SortKey: -1700000000, ID: 3}}, 52.52, 13.405)
+			assert.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+
+	t.Run("Relevance", func(t *testing.T) {
+		db, mock, err := NewMock()
+		assert.NoError(t, err)
+		repo := repo{db}
+
+		// the shared interests come before the distance
+		mock.ExpectQuery(regexp.QuoteMeta(`AS distance, (ST_Distance(users.location, ST_SetSRID(ST_MakePoint($3, $4), 4326)::geography) - 1e8 * (SELECT count(*) FROM profiles AS candidate_profile, `)+
+			`.*`+regexp.QuoteMeta(`WHERE searcher_profile.user_id = searcher.id AND searcher_profile.deleted_at IS NULL))) AS sort_key`)).
+			WithArgs(13.405, 52.52, 13.405, 52.52, 1, 1, 1, 1, "blocked", 1, 1, 1, 1, 1, sqlmock.AnyArg(), sqlmock.AnyArg(), constant.MinimumUserAge, constant.DefaultPreferredMaxAge,
+				13.405, 52.52, constant.DefaultDiscoveryDistance).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		_, err = repo.FindPotentialMatches(context.Background(), 1, &MatchFilters{Sort: constant.DiscoverySortRelevance}, 52.52, 13.405)
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Without Location", func(t *testing.T) {
+		for sort, sortKey := range map[constant.DiscoverySort]string{
+			constant.DiscoverySortDistance:  `-extract(epoch FROM users.created_at)`,
+			constant.DiscoverySortRelevance: `(-(SELECT count(*) FROM profiles AS candidate_profile, `,
+		} {
+			db, mock, err := NewMock()
+			assert.NoError(t, err)
+			repo := repo{db}
+
+			mock.ExpectQuery("^" + regexp.QuoteMeta(`SELECT users.*, NULL AS distance, `+sortKey)).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+			_, err = repo.FindPotentialMatches(context.Background(), 1, &MatchFilters{Sort: sort}, 0, 0)
+			assert.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		}
+	})
+}
+
+func TestFindPotentialMatches(t *testing.T) {
+	minDOB := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxDOB := time.Date(2005, 1, 1, 0, 0, 0, 0, time.UTC)
+	// the filters number their arguments after the ones of the distance and the sort key
+	mutualFilters := func(n int) string {
+		return fmt.Sprintf(`FROM "users" JOIN users AS searcher ON searcher.id = $%d `+
+			`LEFT JOIN preferences AS candidate_prefs ON candidate_prefs.user_id = users.id AND candidate_prefs.deleted_at IS NULL `+
+			`WHERE users.id <> $%d AND users.verified_at IS NOT NULL AND candidate_prefs.show_me IS NOT FALSE `+
+			`AND NOT users.id IN (SELECT target_user_id FROM "swipes" WHERE user_id = $%d `+
+			`UNION SELECT CASE WHEN matches.user_id = $%d THEN matches.target_user_id ELSE matches.user_id END FROM "matches" WHERE unmatched_by IS NOT NULL AND unmatch_reason <> $%d AND (user_id = $%d OR target_user_id = $%d) `+
+			`UNION SELECT CASE WHEN user_id = $%d THEN blocked_user_id ELSE user_id END FROM "blocks" WHERE (user_id = $%d OR blocked_user_id = $%d) AND deleted_at IS NULL) `+
+			`AND users.date_of_birth >= $%d AND users.date_of_birth <= $%d `+
+			`AND (candidate_prefs.genders IS NULL OR candidate_prefs.genders IN ('null', '[]') OR candidate_prefs.genders::jsonb @> jsonb_build_array(searcher.gender)) `+
+			`AND (date_part('year', age(searcher.date_of_birth)) BETWEEN COALESCE(candidate_prefs.min_age, $%d) AND COALESCE(candidate_prefs.max_age, $%d))`,
+			n, n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11, n+12, n+13)
+	}
+	mutualQuery := `SELECT users.*, ST_Distance(users.location, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography) AS distance, ` +
+		`ST_Distance(users.location, ST_SetSRID(ST_MakePoint($3, $4), 4326)::geography) AS sort_key ` + mutualFilters(5)
+	mutualArgs := func(lng, lat float64) []driver.Value {
+		return []driver.Value{lng, lat, lng, lat, 1, 1, 1, 1, "blocked", 1, 1, 1, 1, 1, minDOB, maxDOB, constant.MinimumUserAge, constant.DefaultPreferredMaxAge}
+	}
+	distance := 1200.25
+
+	testCases := []struct {
+		name     string
+		filters  *MatchFilters
+		lat      float64
+		lng      float64
+		query    string
+		args     []driver.Value
+		distance *float64
+	}{
+		{
+			name:    "Mutual Preferences With Location",
+			filters: &MatchFilters{Genders: []string{"FEMALE"}, MinDOB: minDOB, MaxDOB: maxDOB, MaxDistance: 10000},
+			lat:     52.52,
+			lng:     13.405,
+			query: mutualQuery + ` AND users.gender IN ($19) ` +
+				`AND ST_DWithin(users.location, ST_SetSRID(ST_MakePoint($20, $21), 4326)::geography, $22) ` +
+				`AND ST_DWithin(users.location, ST_SetSRID(ST_MakePoint($23, $24), 4326)::geography, COALESCE(candidate_prefs.max_distance, $25)) ` +
+				`AND "users"."deleted_at" IS NULL ORDER BY sort_key, users.id`,
+			args:     append(mutualArgs(13.405, 52.52), "FEMALE", 13.405, 52.52, 10000.0, 13.405, 52.52, constant.DefaultDiscoveryDistance),
+			distance: &distance,
+		},
+		{
+			name:    "Mutual Preferences Without Location",
+			filters: &MatchFilters{MinDOB: minDOB, MaxDOB: maxDOB},
+			// no distance from the point 0, 0 and the newest first
+			query: `SELECT users.*, NULL AS distance, -extract(epoch FROM users.created_at) AS sort_key ` + mutualFilters(1) +
+				` AND "users"."deleted_at" IS NULL ORDER BY sort_key, users.id`,
+			args: []driver.Value{1, 1, 1, 1, "blocked", 1, 1, 1, 1, 1, minDOB, maxDOB, constant.MinimumUserAge, constant.DefaultPreferredMaxAge},
+		},
+		{
+			name:    "Page After Cursor",
+			filters: &MatchFilters{MinDOB: minDOB, MaxDOB: maxDOB, Limit: 21, After: &MatchCursor{SortKey: 1500.5, ID: 7}},
+			lat:     52.52,
+			lng:     13.405,
+			query: mutualQuery + ` AND ST_DWithin(users.location, ST_SetSRID(ST_MakePoint($19, $20), 4326)::geography, COALESCE(candidate_prefs.max_distance, $21)) ` +
+				`AND (ST_Distance(users.location, ST_SetSRID(ST_MakePoint($22, $23), 4326)::geography), users.id) > ($24, $25) ` +
+				`AND "users"."deleted_at" IS NULL ORDER BY sort_key, users.id LIMIT $26`,
+			args:     append(mutualArgs(13.405, 52.52), 13.405, 52.52, constant.DefaultDiscoveryDistance, 13.405, 52.52, 1500.5, 7, 21),
+			distance: &distance,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := NewMock()
+			assert.NoError(t, err)
+			repo := repo{db}
+
+			var distanceValue driver.Value
+			if tc.distance != nil {
+				distanceValue = *tc.distance
+			}
+			rows := sqlmock.NewRows([]string{"id", "name", "gender", "distance"}).AddRow(2, "candidate", "FEMALE", distanceValue)
+			mock.ExpectQuery("^" + regexp.QuoteMeta(tc.query) + "$").WithArgs(tc.args...).WillReturnRows(rows)
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "profiles" WHERE "profiles"."user_id" = $1`)).
+				WithArgs(2).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "bio"}).AddRow(1, 2, "hello"))
+
+			users, err := repo.FindPotentialMatches(context.Background(), 1, tc.filters, tc.lat, tc.lng)
+			assert.NoError(t, err)
+			if assert.Len(t, users, 1) && assert.NotNil(t, users[0].Profile) {
+				assert.Equal(t, tc.distance, users[0].Distance)
+				assert.Equal(t, "hello", users[0].Profile.Bio)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCreateOrUpdateMatch(t *testing.T) {
+	findQuery := regexp.QuoteMeta(`SELECT * FROM "matches" WHERE ((user_id = $1 AND target_user_id = $2) OR (user_id = $3 AND target_user_id = $4)) AND "matches"."deleted_at" IS NULL ORDER BY "matches"."id" LIMIT $5`)
+	insertQuery := regexp.QuoteMeta(`INSERT INTO "matches" ("created_at","updated_at","deleted_at","user_id","target_user_id","matched","last_activity_at","unmatched_by","unmatch_reason","user_last_read_id","target_last_read_id","user_last_delivered_id","target_last_delivered_id") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13) ` +
+		`ON CONFLICT (LEAST(user_id, target_user_id),GREATEST(user_id, target_user_id)) WHERE deleted_at IS NULL DO NOTHING RETURNING "id"`)
+
+	testCases := []struct {
+		name      string
+		setupMock func(mock sqlmock.Sqlmock)
+		expectID  uint
+		created   bool
+	}{
+		{
+			name: "Existing Match",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(findQuery).WithArgs(1, 2, 2, 1, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "target_user_id"}).AddRow(9, 2, 1))
+			},
+			expectID: 9,
+		},
+		{
+			name: "New Match",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(findQuery).WithArgs(1, 2, 2, 1, 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectBegin()
+				mock.ExpectQuery(insertQuery).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, 1, 2, false, sqlmock.AnyArg(), nil, "", 0, 0, 0, 0).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+				mock.ExpectCommit()
+			},
+			expectID: 10,
+			created:  true,
+		},
+		{
+			name: "Match Created Concurrently",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(findQuery).WithArgs(1, 2, 2, 1, 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectBegin()
+				mock.ExpectQuery(insertQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectCommit()
+				mock.ExpectQuery(findQuery).WithArgs(1, 2, 2, 1, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "target_user_id"}).AddRow(11, 2, 1))
+			},
+			expectID: 11,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := NewMock()
+			assert.NoError(t, err)
+			repo := repo{db}
+			tc.setupMock(mock)
+
+			id, created, err := repo.CreateOrUpdateMatch(context.Background(), 1, 2)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectID, id)
+			assert.Equal(t, tc.created, created)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestListMatches(t *testing.T) {
+	db, mock, err := NewMock()
+	assert.NoError(t, err)
+	repo := repo{db}
+
+	activeAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	query := `SELECT matches.*, CASE WHEN matches.user_id = $1 THEN matches.target_user_id ELSE matches.user_id END AS counterpart_id, ` +
+		`(SELECT COUNT(*) FROM messages WHERE messages.match_id = matches.id AND messages.deleted_at IS NULL AND messages.sender_id <> $2 ` +
+		`AND messages.id > CASE WHEN matches.user_id = $3 THEN matches.user_last_read_id ELSE matches.target_last_read_id END) AS unread_count FROM "matches" ` +
+		`JOIN users AS counterpart ON counterpart.id = CASE WHEN matches.user_id = $4 THEN matches.target_user_id ELSE matches.user_id END AND counterpart.deleted_at IS NULL ` +
+		`WHERE (matches.user_id = $5 OR matches.target_user_id = $6) AND (matches.last_activity_at, matches.id) < ($7, $8) AND "matches"."deleted_at" IS NULL ` +
+		`ORDER BY matches.last_activity_at DESC, matches.id DESC LIMIT $9`
+	// the user is the target of the first match and the swiper of the second one
+	mock.ExpectQuery("^"+regexp.QuoteMeta(query)+"$").WithArgs(1, 1, 1, 1, 1, 1, activeAt, 9, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "target_user_id", "last_activity_at", "counterpart_id", "unread_count"}).
+			AddRow(8, 2, 1, activeAt, 2, 3).
+			AddRow(7, 1, 3, activeAt.Add(-time.Hour), 3, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" IN ($1,$2) AND "users"."deleted_at" IS NULL`)).WithArgs(2, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "Ada").AddRow(3, "Grace"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "profiles" WHERE "profiles"."user_id" IN ($1,$2)`)).WithArgs(2, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "bio"}).AddRow(1, 3, "hello"))
+
+	matches, err := repo.ListMatches(context.Background(), 1, 2, &MatchListCursor{LastActivityAt: activeAt, ID: 9})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	if assert.Len(t, matches, 2) {
+		assert.Equal(t, uint(2), matches[0].CounterpartID)
+		assert.Equal(t, 3, matches[0].UnreadCount)
+		assert.Equal(t, "Ada", matches[0].Counterpart.Name)
+		assert.Nil(t, matches[0].Counterpart.Profile)
+		assert.Equal(t, "Grace", matches[1].Counterpart.Name)
+		assert.Equal(t, "hello", matches[1].Counterpart.Profile.Bio)
+	}
+}
+
+func TestUnmatch(t *testing.T) {
+	db, mock, err := NewMock()
+	assert.NoError(t, err)
+	repo := repo{db}
+
+	query := regexp.QuoteMeta(`UPDATE "matches" SET "deleted_at"=$1,"unmatch_reason"=$2,"unmatched_by"=$3,"updated_at"=$4 ` +
+		`WHERE (id = $5 AND (user_id = $6 OR target_user_id = $7)) AND "matches"."deleted_at" IS NULL`)
+	mock.ExpectBegin()
+	mock.ExpectExec(query).WithArgs(sqlmock.AnyArg(), "spam", 2, sqlmock.AnyArg(), 7, 2, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	unmatched, err := repo.Unmatch(context.Background(), 7, 2, "spam")
+	assert.NoError(t, err)
+	assert.True(t, unmatched)
+
+	// a match of other users or an already unmatched match is not found
+	mock.ExpectBegin()
+	mock.ExpectExec(query).WithArgs(sqlmock.AnyArg(), "", 3, sqlmock.AnyArg(), 7, 3, 3).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	unmatched, err = repo.Unmatch(context.Background(), 7, 3, "")
+	assert.NoError(t, err)
+	assert.False(t, unmatched)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnmatchUser(t *testing.T) {
+	db, mock, err := NewMock()
+	assert.NoError(t, err)
+	repo := repo{db}
+
+	// the match is found in either direction
+	query := regexp.QuoteMeta(`UPDATE "matches" SET "deleted_at"=$1,"unmatch_reason"=$2,"unmatched_by"=$3,"updated_at"=$4 ` +
+		`WHERE ((user_id = $5 AND target_user_id = $6) OR (user_id = $7 AND target_user_id = $8)) AND "matches"."deleted_at" IS NULL`)
+	mock.ExpectBegin()
+	mock.ExpectExec(query).WithArgs(sqlmock.AnyArg(), "blocked", 2, sqlmock.AnyArg(), 2, 1, 1, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	unmatched, err := repo.UnmatchUser(context.Background(), 2, 1, "blocked")
+	assert.NoError(t, err)
+	assert.True(t, unmatched)
+
+	// users without a match are left as they are
+	mock.ExpectBegin()
+	mock.ExpectExec(query).WithArgs(sqlmock.AnyArg(), "blocked", 2, sqlmock.AnyArg(), 2, 3, 3, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	unmatched, err = repo.UnmatchUser(context.Background(), 2, 3, "blocked")
+	assert.NoError(t, err)
+	assert.False(t, unmatched)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMarkRead(t *testing.T) {
+	db, mock, err := NewMock()
+	assert.NoError(t, err)
+	repo := repo{db}
+
+	// the position moves to the latest message of the match up to the given one
+	latest := `SELECT COALESCE(MAX(id), 0) FROM "messages" WHERE match_id = $2 AND id <= $3 AND "messages"."deleted_at" IS NULL`
+	query := regexp.QuoteMeta(`UPDATE "matches" SET ` +
+		`"target_last_read_id"=CASE WHEN target_user_id = $1 THEN GREATEST(target_last_read_id, (` + latest + `)) ELSE target_last_read_id END,` +
+		`"user_last_read_id"=CASE WHEN user_id = $4 THEN GREATEST(user_last_read_id, (SELECT COALESCE(MAX(id), 0) FROM "messages" WHERE match_id = $5 AND id <= $6 AND "messages"."deleted_at" IS NULL)) ELSE user_last_read_id END,` +
+		`"updated_at"=$7 WHERE (id = $8 AND (user_id = $9 OR target_user_id = $10)) AND "matches"."deleted_at" IS NULL RETURNING *`)
+	mock.ExpectBegin()
+	mock.ExpectQuery(query).WithArgs(2, 7, 30, 2, 7, 30, sqlmock.AnyArg(), 7, 2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "target_user_id", "user_last_read_id", "target_last_read_id"}).AddRow(7, 1, 2, 12, 30))
+	mock.ExpectCommit()
+	match, err := repo.MarkRead(context.Background(), 7, 2, 30)
+	assert.NoError(t, err)
+	if assert.NotNil(t, match) {
+		assert.Equal(t, uint(7), match.ID)
+		assert.Equal(t, uint(30), match.TargetLastReadID)
+	}
+
+	// without a message the latest message of the match is read, a match of other users is not found
+	query = regexp.QuoteMeta(`UPDATE "matches" SET ` +
+		`"target_last_read_id"=CASE WHEN target_user_id = $1 THEN GREATEST(target_last_read_id, (SELECT COALESCE(MAX(id), 0) FROM "messages" WHERE match_id = $2 AND "messages"."deleted_at" IS NULL)) ELSE target_last_read_id END,` +
+		`"user_last_read_id"=CASE WHEN user_id = $3 THEN GREATEST(user_last_read_id, (SELECT COALESCE(MAX(id), 0) FROM "messages" WHERE match_id = $4 AND "messages"."deleted_at" IS NULL)) ELSE user_last_read_id END,` +
+		`"updated_at"=$5 WHERE (id = $6 AND (user_id = $7 OR target_user_id = $8)) AND "matches"."deleted_at" IS NULL RETURNING *`)
+	mock.ExpectBegin()
+	mock.ExpectQuery(query).WithArgs(3, 7, 3, 7, sqlmock.AnyArg(), 7, 3, 3).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+	match, err = repo.MarkRead(context.Background(), 7, 3, 0)
+	assert.NoError(t, err)
+	assert.Nil(t, match)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMarkDelivered(t *testing.T) {
+	db, mock, err := NewMock()
+	assert.NoError(t, err)
+	repo := repo{db}
+
+	// the position only moves forward, to the latest message of the match up to the given one
+	latest := func(n int) string {
+		return fmt.Sprintf(`(SELECT COALESCE(MAX(id), 0) FROM "messages" WHERE (match_id = $%d AND id <= $%d) AND "messages"."deleted_at" IS NULL)`, n, n+1)
+	}
+	query := regexp.QuoteMeta(`UPDATE "matches" SET ` +
+		`"target_last_delivered_id"=CASE WHEN target_user_id = $1 THEN ` + latest(2) + ` ELSE target_last_delivered_id END,` +
+		`"user_last_delivered_id"=CASE WHEN user_id = $4 THEN ` + latest(5) + ` ELSE user_last_delivered_id END,` +
+		`"updated_at"=$7 WHERE (id = $8 AND (user_id = $9 OR target_user_id = $10)) ` +
+		`AND CASE WHEN user_id = $11 THEN user_last_delivered_id ELSE target_last_delivered_id END < ` + latest(12) +
+		` AND "matches"."deleted_at" IS NULL RETURNING *`)
+	mock.ExpectBegin()
+	mock.ExpectQuery(query).WithArgs(2, 7, 30, 2, 7, 30, sqlmock.AnyArg(), 7, 2, 2, 2, 7, 30).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "target_user_id", "user_last_delivered_id", "target_last_delivered_id"}).AddRow(7, 1, 2, 12, 30))
+	mock.ExpectCommit()
+	match, err := repo.MarkDelivered(context.Background(), 7, 2, 30)
+	assert.NoError(t, err)
+	if assert.NotNil(t, match) {
+		assert.Equal(t, uint(7), match.ID)
+		assert.Equal(t, uint(30), match.TargetLastDeliveredID)
+	}
+
+	// a message already delivered does not move the position
+	mock.ExpectBegin()
+	mock.ExpectQuery(query).WithArgs(2, 7, 20, 2, 7, 20, sqlmock.AnyArg(), 7, 2, 2, 2, 7, 20).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+	match, err = repo.MarkDelivered(context.Background(), 7, 2, 20)
+	assert.NoError(t, err)
+	assert.Nil(t, match)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIsUnmatched(t *testing.T) {
+	db, mock, err := NewMock()
+	assert.NoError(t, err)
+	repo := repo{db}
+
+	// a match undone by a block does not keep the pair apart once the block is lifted
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "matches" WHERE unmatched_by IS NOT NULL AND unmatch_reason <> $1 AND `+
+		`LEAST(user_id, target_user_id) = LEAST($2, $3) AND GREATEST(user_id, target_user_id) = GREATEST($4, $5)`)).
+		WithArgs("blocked", 2, 1, 2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	unmatched, err := repo.IsUnmatched(context.Background(), 2, 1)
+	assert.NoError(t, err)
+	assert.True(t, unmatched)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
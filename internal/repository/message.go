@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// CreateMessage stores a message and makes it the latest activity of its match
+func (r *repo) CreateMessage(ctx context.Context, message *Message) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(message).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Match{}).Where("id = ?", message.MatchID).Update("last_activity_at", message.CreatedAt).Error
+	})
+	return errors.Wrap(err, "creating message")
+}
+
+// ListMessages returns the messages of a match, the newest first. A non zero beforeID continues with the messages
+// older than the last message of the previous page
+func (r *repo) ListMessages(ctx context.Context, matchID uint, limit int, beforeID uint) ([]Message, error) {
+	var messages []Message
+	query := r.db.WithContext(ctx).Where("match_id = ?", matchID)
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if err := query.Order("id DESC").Find(&messages).Error; err != nil {
+		return nil, errors.Wrap(err, "listing messages")
+	}
+	return messages, nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateMessage(t *testing.T) {
+	db, mock, err := NewMock()
+	assert.NoError(t, err)
+	repo := repo{db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "messages" ("created_at","updated_at","deleted_at","match_id","sender_id","body") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, 7, 1, "hello").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "matches" SET "last_activity_at"=$1,"updated_at"=$2 WHERE id = $3 AND "matches"."deleted_at" IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	message := &Message{MatchID: 7, SenderID: 1, Body: "hello"}
+	assert.NoError(t, repo.CreateMessage(context.Background(), message))
+	assert.Equal(t, uint(3), message.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListMessages(t *testing.T) {
+	testCases := []struct {
+		name     string
+		beforeID uint
+		query    string
+	}{
+		{
+			name:  "First Page",
+			query: `SELECT * FROM "messages" WHERE match_id = $1 AND "messages"."deleted_at" IS NULL ORDER BY id DESC LIMIT $2`,
+		},
+		{
+			name:     "Older Messages",
+			beforeID: 12,
+			query:    `SELECT * FROM "messages" WHERE match_id = $1 AND id < $2 AND "messages"."deleted_at" IS NULL ORDER BY id DESC LIMIT $3`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := NewMock()
+			assert.NoError(t, err)
+			repo := repo{db}
+
+			expected := mock.ExpectQuery("^" + regexp.QuoteMeta(tc.query) + "$")
+			if tc.beforeID > 0 {
+				expected.WithArgs(7, tc.beforeID, 21)
+			} else {
+				expected.WithArgs(7, 21)
+			}
+			expected.WillReturnRows(sqlmock.NewRows([]string{"id", "match_id", "sender_id", "body"}).AddRow(11, 7, 2, "hi").AddRow(10, 7, 1, "hello"))
+
+			messages, err := repo.ListMessages(context.Background(), 7, 21, tc.beforeID)
+			assert.NoError(t, err)
+			if assert.Len(t, messages, 2) {
+				assert.Equal(t, "hi", messages[0].Body)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestFindMatch(t *testing.T) {
+	db, mock, err := NewMock()
+	assert.NoError(t, err)
+	repo := repo{db}
+
+	// the unmatched matches are found too
+	query := regexp.QuoteMeta(`SELECT * FROM "matches" WHERE "matches"."id" = $1 ORDER BY "matches"."id" LIMIT $2`)
+	mock.ExpectQuery(query).WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "target_user_id", "unmatched_by"}).AddRow(7, 1, 2, 2))
+	match, err := repo.FindMatch(context.Background(), 7)
+	assert.NoError(t, err)
+	if assert.NotNil(t, match) {
+		assert.Equal(t, uint(2), *match.UnmatchedBy)
+	}
+
+	mock.ExpectQuery(query).WithArgs(8, 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	match, err = repo.FindMatch(context.Background(), 8)
+	assert.NoError(t, err)
+	assert.Nil(t, match)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FindTOTPCredential finds the TOTP credential of a user, it returns nil when the user has not started an enrollment
+func (r *repo) FindTOTPCredential(ctx context.Context, userID uint) (*TOTPCredential, error) {
+	var credential TOTPCredential
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&credential).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "finding totp credential")
+	}
+	return &credential, nil
+}
+
+// SaveTOTPCredential stores the TOTP credential of a user, it replaces a previous unconfirmed credential
+func (r *repo) SaveTOTPCredential(ctx context.Context, credential *TOTPCredential) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "confirmed_at", "last_used_step", "updated_at"}),
+	}).Create(credential).Error
+	return errors.Wrap(err, "saving totp credential")
+}
+
+// ConfirmTOTPCredential enables the TOTP credential of a user with the time step of the code that confirmed it
+func (r *repo) ConfirmTOTPCredential(ctx context.Context, userID uint, step int64) error {
+	err := r.db.WithContext(ctx).Model(&TOTPCredential{}).
+		Where("user_id = ?", userID).
+		Updates(map[string]interface{}{"confirmed_at": time.Now(), "last_used_step": step}).Error
+	return errors.Wrap(err, "confirming totp credential")
+}
+
+// UseTOTPStep records the time step of an accepted code, it reports false if a code of the same or a later step was already used
+func (r *repo) UseTOTPStep(ctx context.Context, userID uint, step int64) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&TOTPCredential{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "using totp step")
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReplaceRecoveryCodes deletes the recovery codes of a user and stores the new ones
+func (r *repo) ReplaceRecoveryCodes(ctx context.Context, userID uint, codeHashes []string) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]RecoveryCode, 0, len(codeHashes))
+		for _, codeHash := range codeHashes {
+			codes = append(codes, RecoveryCode{UserID: userID, CodeHash: codeHash})
+		}
+		return tx.Create(&codes).Error
+	})
+	return errors.Wrap(err, "replacing recovery codes")
+}
+
+// UseRecoveryCode marks a recovery code of the user as used, it reports false if the code is unknown or already used
+func (r *repo) UseRecoveryCode(ctx context.Context, userID uint, codeHash string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "using recovery code")
+	}
+	return result.RowsAffected == 1, nil
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations returns the versioned SQL migrations of the schema, they are embedded in the binary
+func Migrations() fs.FS {
+	migrations, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		// the directory is embedded at build time so it always exists
+		panic(err)
+	}
+	return migrations
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/a-berahman/dating-app/pkg/migrate"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm/schema"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := migrate.Load(Migrations())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+	for i, migration := range migrations {
+		assert.Equal(t, int64(i+1), migration.Version, "migration versions must follow each other")
+	}
+}
+
+// baselineSchema is the schema the auto migration of the first release created
+var baselineSchema = map[string][]string{
+	"users":   {"id", "created_at", "updated_at", "deleted_at", "email", "password", "name", "gender", "date_of_birth", "location"},
+	"matches": {"id", "created_at", "updated_at", "deleted_at", "user_id", "target_user_id", "matched"},
+	"swipes":  {"id", "created_at", "updated_at", "deleted_at", "user_id", "target_user_id", "swiped_right"},
+}
+
+func TestMigrationsCreateModelColumns(t *testing.T) {
+	testCases := []struct {
+		name   string
+		schema map[string][]string
+	}{
+		{name: "Empty Database"},
+		{name: "Baseline Database", schema: baselineSchema},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tables := applyMigrations(t, tc.schema)
+			for _, model := range []interface{}{&User{}, &Profile{}, &Preferences{}, &Swipe{}, &Match{}, &Message{}, &Block{},
+				&RefreshToken{}, &RevokedToken{}, &PasswordResetToken{}, &EmailVerificationToken{}, &TOTPCredential{}, &RecoveryCode{}, &LockoutEvent{}} {
+				parsed, err := schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				columns, ok := tables[parsed.Table]
+				if !assert.True(t, ok, "table %s is not created", parsed.Table) {
+					continue
+				}
+				for _, field := range parsed.Fields {
+					if field.DBName == "" || field.IgnoreMigration {
+						continue
+					}
+					assert.True(t, columns[field.DBName], "column %s.%s is not created", parsed.Table, field.DBName)
+				}
+			}
+		})
+	}
+}
+
+var (
+	sqlComment  = regexp.MustCompile(`--[^\n]*`)
+	createTable = regexp.MustCompile(`(?s)^CREATE TABLE IF NOT EXISTS (\w+) \((.*)\)$`)
+	alterTable  = regexp.MustCompile(`(?m)^\s*ALTER TABLE (\w+) `)
+	addColumn   = regexp.MustCompile(`ADD COLUMN (?:IF NOT EXISTS )?(\w+)`)
+	columnName  = regexp.MustCompile(`^\s*(\w+) `)
+)
+
+// applyMigrations replays the tables and columns the up migrations create on the given schema the way PostgreSQL does,
+// a table that already exists is left as it is by CREATE TABLE IF NOT EXISTS and the columns a DO block adds when they are missing count as added
+func applyMigrations(t *testing.T, initial map[string][]string) map[string]map[string]bool {
+	tables := make(map[string]map[string]bool)
+	for table, columns := range initial {
+		tables[table] = make(map[string]bool)
+		for _, column := range columns {
+			tables[table][column] = true
+		}
+	}
+
+	migrations, err := migrate.Load(Migrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, migration := range migrations {
+		for _, statement := range strings.Split(sqlComment.ReplaceAllString(migration.Up, ""), ";") {
+			statement = strings.TrimSpace(statement)
+			if parts := createTable.FindStringSubmatch(statement); parts != nil {
+				if _, ok := tables[parts[1]]; ok {
+					continue
+				}
+				tables[parts[1]] = make(map[string]bool)
+				for _, line := range strings.Split(parts[2], "\n") {
+					if column := columnName.FindStringSubmatch(line); column != nil {
+						tables[parts[1]][column[1]] = true
+					}
+				}
+			} else if parts := alterTable.FindStringSubmatch(statement); parts != nil {
+				for _, column := range addColumn.FindAllStringSubmatch(statement, -1) {
+					tables[parts[1]][column[1]] = true
+				}
+			}
+		}
+	}
+	return tables
+}
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS preferences;
+DROP TABLE IF EXISTS profiles;
+DROP TABLE IF EXISTS lockout_events;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS totp_credentials;
+DROP TABLE IF EXISTS email_verification_tokens;
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS revoked_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS swipes;
+DROP TABLE IF EXISTS matches;
+DROP TABLE IF EXISTS users;
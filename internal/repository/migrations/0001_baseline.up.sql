@@ -0,0 +1,197 @@
+-- The schema as it was created by the auto migration of earlier versions, every statement is idempotent
+-- so databases that were auto migrated are adopted, the columns added since the first release are added
+-- to the tables that already exist.
+CREATE EXTENSION IF NOT EXISTS postgis;
+
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    email text,
+    password text,
+    name text,
+    gender text,
+    date_of_birth timestamptz,
+    location geography(Point,4326),
+    verified_at timestamptz,
+    tokens_valid_after timestamptz,
+    last_active_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+-- the users who registered before the email verification existed count as verified since their registration,
+-- otherwise they could not swipe anymore and would disappear from the discovery
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'verified_at') THEN
+        ALTER TABLE users ADD COLUMN verified_at timestamptz;
+        UPDATE users SET verified_at = created_at;
+    END IF;
+END
+$$;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_valid_after timestamptz;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_active_at timestamptz;
+
+-- earlier versions stored the location as EWKB hex text
+DO $$
+BEGIN
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'location') = 'text' THEN
+        ALTER TABLE users ALTER COLUMN location TYPE geography(Point,4326)
+            USING ST_SetSRID(NULLIF(location, '')::geometry, 4326)::geography;
+    END IF;
+END
+$$;
+CREATE INDEX IF NOT EXISTS idx_users_location ON users USING gist (location);
+
+CREATE TABLE IF NOT EXISTS matches (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id bigint,
+    target_user_id bigint,
+    matched boolean
+);
+CREATE INDEX IF NOT EXISTS idx_matches_deleted_at ON matches (deleted_at);
+
+CREATE TABLE IF NOT EXISTS swipes (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id bigint,
+    target_user_id bigint,
+    swiped_right boolean
+);
+CREATE INDEX IF NOT EXISTS idx_swipes_deleted_at ON swipes (deleted_at);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id bigint,
+    token_hash text,
+    family_id text,
+    expires_at timestamptz,
+    used_at timestamptz,
+    revoked_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_deleted_at ON refresh_tokens (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    jti text,
+    user_id bigint,
+    expires_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_deleted_at ON revoked_tokens (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_revoked_tokens_jti ON revoked_tokens (jti);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id bigint,
+    token_hash text,
+    expires_at timestamptz,
+    used_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_deleted_at ON password_reset_tokens (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_reset_tokens_token_hash ON password_reset_tokens (token_hash);
+
+CREATE TABLE IF NOT EXISTS email_verification_tokens (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id bigint,
+    token_hash text,
+    expires_at timestamptz,
+    used_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_email_verification_tokens_deleted_at ON email_verification_tokens (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_email_verification_tokens_user_id ON email_verification_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_verification_tokens_token_hash ON email_verification_tokens (token_hash);
+
+CREATE TABLE IF NOT EXISTS totp_credentials (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id bigint,
+    secret text,
+    confirmed_at timestamptz,
+    last_used_step bigint
+);
+CREATE INDEX IF NOT EXISTS idx_totp_credentials_deleted_at ON totp_credentials (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_totp_credentials_user_id ON totp_credentials (user_id);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id bigint,
+    code_hash text,
+    used_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_deleted_at ON recovery_codes (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_code_hash ON recovery_codes (code_hash);
+
+CREATE TABLE IF NOT EXISTS lockout_events (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    scope text,
+    subject text,
+    client_ip text,
+    locked_until timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_lockout_events_deleted_at ON lockout_events (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_lockout_events_scope ON lockout_events (scope);
+CREATE INDEX IF NOT EXISTS idx_lockout_events_subject ON lockout_events (subject);
+
+CREATE TABLE IF NOT EXISTS profiles (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id bigint CONSTRAINT fk_users_profile REFERENCES users (id),
+    bio text,
+    job_title text,
+    school text,
+    height_cm bigint,
+    interests text,
+    prompts text,
+    photos text
+);
+CREATE INDEX IF NOT EXISTS idx_profiles_deleted_at ON profiles (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_profiles_user_id ON profiles (user_id);
+
+CREATE TABLE IF NOT EXISTS preferences (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id bigint,
+    genders text,
+    min_age bigint,
+    max_age bigint,
+    max_distance decimal,
+    show_me boolean
+);
+CREATE INDEX IF NOT EXISTS idx_preferences_deleted_at ON preferences (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_preferences_user_id ON preferences (user_id);
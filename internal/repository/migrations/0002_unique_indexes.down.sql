@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_email;
+DROP INDEX IF EXISTS idx_matches_user_pair;
+DROP INDEX IF EXISTS idx_swipes_user_id_target_user_id;
@@ -0,0 +1,19 @@
+-- The auto migration never created these constraints, the duplicates it allowed are removed first.
+-- Soft deleted rows are left out so a deleted row does not block a new one.
+
+-- keep the latest swipe of a user on a target
+DELETE FROM swipes AS older USING swipes AS newer
+WHERE older.user_id = newer.user_id AND older.target_user_id = newer.target_user_id
+    AND older.deleted_at IS NULL AND newer.deleted_at IS NULL AND older.id < newer.id;
+CREATE UNIQUE INDEX idx_swipes_user_id_target_user_id ON swipes (user_id, target_user_id) WHERE deleted_at IS NULL;
+
+-- keep the first match of a pair, in either direction, since its id has been handed out
+DELETE FROM matches AS newer USING matches AS older
+WHERE LEAST(newer.user_id, newer.target_user_id) = LEAST(older.user_id, older.target_user_id)
+    AND GREATEST(newer.user_id, newer.target_user_id) = GREATEST(older.user_id, older.target_user_id)
+    AND newer.deleted_at IS NULL AND older.deleted_at IS NULL AND newer.id > older.id;
+CREATE UNIQUE INDEX idx_matches_user_pair ON matches (LEAST(user_id, target_user_id), GREATEST(user_id, target_user_id)) WHERE deleted_at IS NULL;
+
+-- registration already refuses emails in use, duplicates can only come from concurrent registrations
+-- and have to be resolved by hand before this migration can run
+CREATE UNIQUE INDEX idx_users_email ON users (email) WHERE deleted_at IS NULL;
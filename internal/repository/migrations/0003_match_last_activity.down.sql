@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_matches_target_user_id_last_activity;
+DROP INDEX IF EXISTS idx_matches_user_id_last_activity;
+ALTER TABLE matches DROP COLUMN IF EXISTS last_activity_at;
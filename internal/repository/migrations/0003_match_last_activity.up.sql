@@ -0,0 +1,8 @@
+-- The matches are listed by their latest activity, the existing matches start at the time they were created.
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS last_activity_at timestamptz;
+UPDATE matches SET last_activity_at = created_at WHERE last_activity_at IS NULL;
+ALTER TABLE matches ALTER COLUMN last_activity_at SET DEFAULT now(), ALTER COLUMN last_activity_at SET NOT NULL;
+
+-- a user is stored on either side of the pair so each side has its own index
+CREATE INDEX IF NOT EXISTS idx_matches_user_id_last_activity ON matches (user_id, last_activity_at DESC, id DESC) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_matches_target_user_id_last_activity ON matches (target_user_id, last_activity_at DESC, id DESC) WHERE deleted_at IS NULL;
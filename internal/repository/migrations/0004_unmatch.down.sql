@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_matches_unmatched_user_pair;
+ALTER TABLE matches DROP COLUMN IF EXISTS unmatch_reason;
+ALTER TABLE matches DROP COLUMN IF EXISTS unmatched_by;
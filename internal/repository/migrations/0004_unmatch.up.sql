@@ -0,0 +1,5 @@
+-- An unmatched match is soft deleted with the user who unmatched and their reason, the pair is kept apart afterwards.
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS unmatched_by bigint;
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS unmatch_reason text NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_matches_unmatched_user_pair ON matches (LEAST(user_id, target_user_id), GREATEST(user_id, target_user_id)) WHERE unmatched_by IS NOT NULL;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS messages (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    match_id bigint NOT NULL REFERENCES matches (id),
+    sender_id bigint NOT NULL,
+    body text NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_messages_deleted_at ON messages (deleted_at);
+-- the conversation of a match is read from the newest message backwards
+CREATE INDEX IF NOT EXISTS idx_messages_match_id ON messages (match_id, id DESC) WHERE deleted_at IS NULL;
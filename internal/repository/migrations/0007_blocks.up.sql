@@ -0,0 +1,13 @@
+-- A user blocks another user at most once, an unblocked block is soft deleted so the user can block them again.
+CREATE TABLE IF NOT EXISTS blocks (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id bigint NOT NULL,
+    blocked_user_id bigint NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_blocks_deleted_at ON blocks (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_blocks_user_id_blocked_user_id ON blocks (user_id, blocked_user_id) WHERE deleted_at IS NULL;
+-- the discovery of a user leaves out the users who blocked them
+CREATE INDEX IF NOT EXISTS idx_blocks_blocked_user_id ON blocks (blocked_user_id) WHERE deleted_at IS NULL;
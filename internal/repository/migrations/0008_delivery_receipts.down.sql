@@ -0,0 +1,2 @@
+ALTER TABLE matches DROP COLUMN IF EXISTS target_last_delivered_id;
+ALTER TABLE matches DROP COLUMN IF EXISTS user_last_delivered_id;
@@ -0,0 +1,8 @@
+-- Every user of a match has received the messages up to their last delivered message, the messages sent before the
+-- delivery receipts existed count as delivered like they count as read.
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS user_last_delivered_id bigint NOT NULL DEFAULT 0;
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS target_last_delivered_id bigint NOT NULL DEFAULT 0;
+
+UPDATE matches SET user_last_delivered_id = latest.id, target_last_delivered_id = latest.id
+FROM (SELECT match_id, MAX(id) AS id FROM messages GROUP BY match_id) AS latest
+WHERE latest.match_id = matches.id;
@@ -0,0 +1,5 @@
+-- Emails are stored lower-cased and looked up by lower(email), the index keeps the same email in another case from
+-- being registered twice. Emails registered before differing only by their case have to be resolved by hand
+-- before this migration can run.
+CREATE UNIQUE INDEX idx_users_email_lower ON users (lower(email)) WHERE deleted_at IS NULL;
+DROP INDEX IF EXISTS idx_users_email;
@@ -3,6 +3,8 @@ package repository
 import (
 	"time"
 
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/pkg/geo"
 	"gorm.io/gorm"
 )
 
@@ -14,15 +16,73 @@ type User struct {
 	Name        string
 	Gender      string
 	DateOfBirth time.Time
-	Location    string
+	// Location is the last known location of the user, the GiST index keeps the distance filters of the discovery fast
+	Location geo.Point `gorm:"index:idx_users_location,type:gist"`
+	// VerifiedAt is set once the user confirms their email, unverified users cannot swipe and are hidden from discovery
+	VerifiedAt *time.Time
+	// TokensValidAfter invalidates every access token issued before it, it is set when the user logs out of all sessions
+	TokensValidAfter *time.Time
+	// LastActiveAt is the last time the user logged in or refreshed their session
+	LastActiveAt *time.Time
+	Profile      *Profile `gorm:"foreignKey:UserID"`
+	// Distance is the distance in meters from the searcher and SortKey the position in the discovery order,
+	// they are only set by the discovery query and the distance is nil when the searcher has no location
+	Distance *float64 `gorm:"->;-:migration"`
+	SortKey  float64  `gorm:"->;-:migration"`
+}
+
+// Profile holds the public profile of a user, the lists are stored as JSON
+type Profile struct {
+	gorm.Model
+	UserID    uint `gorm:"uniqueIndex"`
+	Bio       string
+	JobTitle  string
+	School    string
+	HeightCm  *int
+	Interests []string        `gorm:"serializer:json"`
+	Prompts   []ProfilePrompt `gorm:"serializer:json"`
+	Photos    []ProfilePhoto  `gorm:"serializer:json"`
+}
+
+// ProfilePrompt is the answer of a user to a profile question
+type ProfilePrompt struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// ProfilePhoto is the metadata of a profile photo, the photo itself is stored outside of the database
+type ProfilePhoto struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// Preferences holds the discovery preferences of a user, users with show me turned off are left out of the discovery of others
+type Preferences struct {
+	gorm.Model
+	UserID      uint     `gorm:"uniqueIndex"`
+	Genders     []string `gorm:"serializer:json"`
+	MinAge      int
+	MaxAge      int
+	MaxDistance float64
+	ShowMe      bool
 }
 
 // MatchFilters represents the filters that can be applied when searching for matches
 type MatchFilters struct {
-	Gender      string
+	Genders     []string
 	MinDOB      time.Time
 	MaxDOB      time.Time
 	MaxDistance float64
+	Sort        constant.DiscoverySort
+	Limit       int
+	After       *MatchCursor
+}
+
+// MatchCursor is the position of the last candidate of a page, candidates are ordered by the sort key of the sort and then id
+type MatchCursor struct {
+	SortKey float64
+	ID      uint
 }
 
 // Swipe represents the swipe action taken by a user on another user's profile
@@ -39,4 +99,106 @@ type Match struct {
 	UserID       uint
 	TargetUserID uint
 	Matched      bool
+	// LastActivityAt is the time of the latest activity between the users, the matches are listed by it
+	LastActivityAt time.Time
+	// UnmatchedBy is the user who undid the match and UnmatchReason their reason, the match is deleted when it is set
+	UnmatchedBy   *uint
+	UnmatchReason string
+	// UserLastReadID and TargetLastReadID are the last messages the user and the target user have read, the messages after them are unread
+	UserLastReadID   uint
+	TargetLastReadID uint
+	// UserLastDeliveredID and TargetLastDeliveredID are the last messages that reached a device of the user and the target user
+	UserLastDeliveredID   uint
+	TargetLastDeliveredID uint
+	// UnreadCount is the number of the messages of the other user the user who listed the matches has not read, it is only set by ListMatches
+	UnreadCount int `gorm:"->;-:migration"`
+	// CounterpartID is the other user of the pair for the user who listed the matches and Counterpart is their user,
+	// they are only set by ListMatches
+	CounterpartID uint  `gorm:"->;-:migration"`
+	Counterpart   *User `gorm:"foreignKey:CounterpartID"`
+}
+
+// MatchListCursor is the position of the last match of a page, the matches are ordered by their latest activity and then id
+type MatchListCursor struct {
+	LastActivityAt time.Time
+	ID             uint
+}
+
+// Message is a message sent by one of the users of a match to the other
+type Message struct {
+	gorm.Model
+	MatchID  uint `gorm:"index"`
+	SenderID uint
+	Body     string
+}
+
+// Block keeps the blocked user and the user who blocked them apart, BlockedUser is only set by ListBlocks
+type Block struct {
+	gorm.Model
+	UserID        uint
+	BlockedUserID uint
+	BlockedUser   *User `gorm:"foreignKey:BlockedUserID"`
+}
+
+// RefreshToken is an opaque token that renews an access token, only the hash of the token is stored
+type RefreshToken struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex"`
+	FamilyID  string `gorm:"index"` // FamilyID groups all the tokens rotated from the same login
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// RevokedToken is an access token that has been revoked before its expiration
+type RevokedToken struct {
+	gorm.Model
+	JTI       string `gorm:"uniqueIndex"`
+	UserID    uint
+	ExpiresAt time.Time
+}
+
+// PasswordResetToken is a single use token that allows to set a new password, only the hash of the token is stored
+type PasswordResetToken struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// EmailVerificationToken is a single use token that confirms the email of a user, only the hash of the token is stored
+type EmailVerificationToken struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// TOTPCredential is the authenticator app secret of a user, it only protects the login once it has been confirmed with a code
+type TOTPCredential struct {
+	gorm.Model
+	UserID       uint `gorm:"uniqueIndex"`
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep int64 // LastUsedStep is the time step of the last accepted code so a code cannot be replayed
+}
+
+// RecoveryCode is a single use code that replaces a TOTP code when the authenticator is lost, only the hash of the code is stored
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"index"`
+	CodeHash string `gorm:"index"`
+	UsedAt   *time.Time
+}
+
+// LockoutEvent is an audit record of a login lockout
+type LockoutEvent struct {
+	gorm.Model
+	Scope       string `gorm:"index"` // Scope is what has been locked out, the password login of an email, a client IP or the second factor of a user
+	Subject     string `gorm:"index"` // Subject is the locked out email, IP or user id
+	ClientIP    string
+	LockedUntil time.Time
 }
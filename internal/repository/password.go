@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// CreatePasswordResetToken saves a new password reset token in the database
+func (r *repo) CreatePasswordResetToken(ctx context.Context, token *PasswordResetToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+// FindPasswordResetToken finds a password reset token by its hash, it returns nil when the token does not exist
+func (r *repo) FindPasswordResetToken(ctx context.Context, tokenHash string) (*PasswordResetToken, error) {
+	var token PasswordResetToken
+	if err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "finding password reset token")
+	}
+	return &token, nil
+}
+
+// MarkPasswordResetTokenUsed marks a password reset token as used, it reports false if the token had already been used
+func (r *repo) MarkPasswordResetTokenUsed(ctx context.Context, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "marking password reset token as used")
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// InvalidatePasswordResetTokens marks every unused password reset token of the user as used
+func (r *repo) InvalidatePasswordResetTokens(ctx context.Context, userID uint) error {
+	err := r.db.WithContext(ctx).Model(&PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+	return errors.Wrap(err, "invalidating password reset tokens")
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FindPreferences finds the discovery preferences of a user, it returns nil when the user has not saved any
+func (r *repo) FindPreferences(ctx context.Context, userID uint) (*Preferences, error) {
+	var preferences Preferences
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&preferences).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "finding preferences")
+	}
+	return &preferences, nil
+}
+
+// SavePreferences creates or replaces the discovery preferences of a user
+func (r *repo) SavePreferences(ctx context.Context, preferences *Preferences) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"genders", "min_age", "max_age", "max_distance", "show_me", "updated_at"}),
+	}).Create(preferences).Error
+	return errors.Wrap(err, "saving preferences")
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FindProfile finds the profile of a user, it returns nil when the user has not filled their profile yet
+func (r *repo) FindProfile(ctx context.Context, userID uint) (*Profile, error) {
+	var profile Profile
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&profile).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "finding profile")
+	}
+	return &profile, nil
+}
+
+// SaveProfile creates or replaces the profile of a user
+func (r *repo) SaveProfile(ctx context.Context, profile *Profile) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"bio", "job_title", "school", "height_cm", "interests", "prompts", "photos", "updated_at"}),
+	}).Create(profile).Error
+	return errors.Wrap(err, "saving profile")
+}
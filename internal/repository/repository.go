@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"github.com/a-berahman/dating-app/constant"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
 
 	"gorm.io/gorm"
 )
@@ -14,25 +16,123 @@ type UserRepository interface {
 	Create(ctx context.Context, email, password, name string, gender constant.UserGender, dateOfBirth time.Time, lat, lng float64) (uint, error)
 	Authenticate(ctx context.Context, email, password string) (*User, error)
 	FindByEmail(ctx context.Context, email string) (*User, error)
+	FindByID(ctx context.Context, id uint) (*User, error)
+	SetTokensValidAfter(ctx context.Context, userID uint, validAfter time.Time) error
+	UpdatePassword(ctx context.Context, userID uint, password string) error
+	MarkVerified(ctx context.Context, userID uint) error
+	UpdateLocation(ctx context.Context, userID uint, lat, lng float64) error
+	UpdateLastActive(ctx context.Context, userID uint, activeAt time.Time) error
 }
 
 // MatchRepository defines the interface for match data interaction.
 type MatchRepository interface {
-	CreateOrUpdateMatch(ctx context.Context, userID, targetUserID uint) (uint, error)
+	CreateOrUpdateMatch(ctx context.Context, userID, targetUserID uint) (uint, bool, error)
 	FindPotentialMatches(ctx context.Context, userID uint, filters *MatchFilters, lat, lng float64) ([]User, error)
+	FindMatch(ctx context.Context, matchID uint) (*Match, error)
+	ListMatches(ctx context.Context, userID uint, limit int, after *MatchListCursor) ([]Match, error)
+	Unmatch(ctx context.Context, matchID, userID uint, reason string) (bool, error)
+	IsUnmatched(ctx context.Context, userID, targetUserID uint) (bool, error)
+	MarkRead(ctx context.Context, matchID, userID, messageID uint) (*Match, error)
+	MarkDelivered(ctx context.Context, matchID, userID, messageID uint) (*Match, error)
+	UnmatchUser(ctx context.Context, userID, otherUserID uint, reason string) (bool, error)
+}
+
+// MessageRepository defines the interface for the messages of the matches
+type MessageRepository interface {
+	CreateMessage(ctx context.Context, message *Message) error
+	ListMessages(ctx context.Context, matchID uint, limit int, beforeID uint) ([]Message, error)
+}
+
+// BlockRepository defines the interface for the blocks between users
+type BlockRepository interface {
+	Block(ctx context.Context, userID, blockedUserID uint) (bool, error)
+	Unblock(ctx context.Context, userID, blockedUserID uint) (bool, error)
+	ListBlocks(ctx context.Context, userID uint) ([]Block, error)
+	IsBlocked(ctx context.Context, userID, otherUserID uint) (bool, error)
 }
 
 // SwipeRepository defines the interface for swipe data interaction.
 type SwipeRepository interface {
 	AddSwipe(ctx context.Context, swipe *Swipe) error
+	UpsertSwipe(ctx context.Context, swipe *Swipe) (bool, error)
+	LockUserPair(ctx context.Context, userID, targetUserID uint) error
 	CheckForMatch(ctx context.Context, userID, targetUserID uint) (bool, error)
 }
 
+// TokenRepository defines the interface for refresh and revoked token data interaction.
+type TokenRepository interface {
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	FindRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, id uint) (bool, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID uint) error
+	RevokeAccessToken(ctx context.Context, token *RevokedToken) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// PasswordResetRepository defines the interface for password reset token data interaction.
+type PasswordResetRepository interface {
+	CreatePasswordResetToken(ctx context.Context, token *PasswordResetToken) error
+	FindPasswordResetToken(ctx context.Context, tokenHash string) (*PasswordResetToken, error)
+	MarkPasswordResetTokenUsed(ctx context.Context, id uint) (bool, error)
+	InvalidatePasswordResetTokens(ctx context.Context, userID uint) error
+}
+
+// VerificationRepository defines the interface for email verification token data interaction.
+type VerificationRepository interface {
+	CreateVerificationToken(ctx context.Context, token *EmailVerificationToken) error
+	FindVerificationToken(ctx context.Context, tokenHash string) (*EmailVerificationToken, error)
+	MarkVerificationTokenUsed(ctx context.Context, id uint) (bool, error)
+}
+
+// MFARepository defines the interface for TOTP credential and recovery code data interaction.
+type MFARepository interface {
+	FindTOTPCredential(ctx context.Context, userID uint) (*TOTPCredential, error)
+	SaveTOTPCredential(ctx context.Context, credential *TOTPCredential) error
+	ConfirmTOTPCredential(ctx context.Context, userID uint, step int64) error
+	UseTOTPStep(ctx context.Context, userID uint, step int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID uint, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID uint, codeHash string) (bool, error)
+}
+
+// LockoutRepository defines the interface for the login lockout audit records.
+type LockoutRepository interface {
+	RecordLockout(ctx context.Context, event *LockoutEvent) error
+}
+
+// ProfileRepository defines the interface for user profile data interaction.
+type ProfileRepository interface {
+	FindProfile(ctx context.Context, userID uint) (*Profile, error)
+	SaveProfile(ctx context.Context, profile *Profile) error
+}
+
+// PreferencesRepository defines the interface for discovery preferences data interaction.
+type PreferencesRepository interface {
+	FindPreferences(ctx context.Context, userID uint) (*Preferences, error)
+	SavePreferences(ctx context.Context, preferences *Preferences) error
+}
+
+// UnitOfWork runs several repository operations in one database transaction, the repositories given to the function
+// are bound to the transaction which is committed when the function returns nil and rolled back otherwise
+type UnitOfWork interface {
+	WithinTransaction(ctx context.Context, fn func(repos *Repository) error) error
+}
+
 // Repository handles the operations with the database
 type Repository struct {
-	UserRepo  UserRepository
-	MatchRepo MatchRepository
-	SwipeRepo SwipeRepository
+	UserRepo    UserRepository
+	MatchRepo   MatchRepository
+	SwipeRepo   SwipeRepository
+	TokenRepo   TokenRepository
+	ResetRepo   PasswordResetRepository
+	VerifyRepo  VerificationRepository
+	MFARepo     MFARepository
+	LockoutRepo LockoutRepository
+	ProfileRepo ProfileRepository
+	PrefsRepo   PreferencesRepository
+	MessageRepo MessageRepository
+	BlockRepo   BlockRepository
+	UnitOfWork  UnitOfWork
 }
 type repo struct {
 	db *gorm.DB
@@ -41,8 +141,34 @@ type repo struct {
 // New creates a new instance of repository layer
 func New(db *gorm.DB) *Repository {
 	return &Repository{
-		UserRepo:  &repo{db: db},
-		MatchRepo: &repo{db: db},
-		SwipeRepo: &repo{db: db},
+		UserRepo:    &repo{db: db},
+		MatchRepo:   &repo{db: db},
+		SwipeRepo:   &repo{db: db},
+		TokenRepo:   &repo{db: db},
+		ResetRepo:   &repo{db: db},
+		VerifyRepo:  &repo{db: db},
+		MFARepo:     &repo{db: db},
+		LockoutRepo: &repo{db: db},
+		ProfileRepo: &repo{db: db},
+		PrefsRepo:   &repo{db: db},
+		MessageRepo: &repo{db: db},
+		BlockRepo:   &repo{db: db},
+		UnitOfWork:  &repo{db: db},
 	}
 }
+
+// WithinTransaction runs fn with repositories bound to a new transaction, or to a savepoint when it is already in one
+func (r *repo) WithinTransaction(ctx context.Context, fn func(repos *Repository) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(New(tx))
+	})
+}
+
+// uniqueViolation is the PostgreSQL error code of a duplicate key
+const uniqueViolation = "23505"
+
+// isUniqueViolation reports whether the error is a duplicate key of a unique index
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
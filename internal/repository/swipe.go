@@ -2,13 +2,46 @@ package repository
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/a-berahman/dating-app/constant"
 	"github.com/pkg/errors"
+	"gorm.io/gorm/clause"
 )
 
-// AddSwipe logs a swipe action in the database.
+// AddSwipe logs a swipe action in the database, it returns ErrSwipeConflict when the user already swiped on the target
 func (r *repo) AddSwipe(ctx context.Context, swipe *Swipe) error {
-	return r.db.WithContext(ctx).Create(swipe).Error
+	err := r.db.WithContext(ctx).Create(swipe).Error
+	if isUniqueViolation(err) {
+		return constant.ErrSwipeConflict
+	}
+	return err
+}
+
+// UpsertSwipe logs a swipe action or replaces the decision of the previous swipe of the user on the target,
+// it reports false when the previous swipe already had the same decision and is left as it is
+func (r *repo) UpsertSwipe(ctx context.Context, swipe *Swipe) (bool, error) {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "user_id"}, {Name: "target_user_id"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "deleted_at IS NULL"}}},
+		DoUpdates:   clause.AssignmentColumns([]string{"swiped_right", "updated_at"}),
+		Where:       clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: `"swipes"."swiped_right" <> "excluded"."swiped_right"`}}},
+	}).Create(swipe)
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "upserting swipe")
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// LockUserPair locks the pair of users until the end of the transaction so the swipes between them are processed one
+// after the other, either user may be given first. It has to run inside a transaction
+func (r *repo) LockUserPair(ctx context.Context, userID, targetUserID uint) error {
+	low, high := userID, targetUserID
+	if low > high {
+		low, high = high, low
+	}
+	err := r.db.WithContext(ctx).Exec("SELECT pg_advisory_xact_lock(hashtextextended(?, 0))", fmt.Sprintf("user_pair:%d:%d", low, high)).Error
+	return errors.Wrap(err, "locking user pair")
 }
 
 // CheckForMatch checks if two users have swiped right on each other
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddSwipe(t *testing.T) {
+	db, mock, err := NewMock()
+	assert.NoError(t, err)
+	repo := repo{db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "swipes" ("created_at","updated_at","deleted_at","user_id","target_user_id","swiped_right") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, 1, 2, true).
+		WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "idx_swipes_user_id_target_user_id"})
+	mock.ExpectRollback()
+
+	err = repo.AddSwipe(context.Background(), &Swipe{UserID: 1, TargetUserID: 2, SwipedRight: true})
+	assert.ErrorIs(t, err, constant.ErrSwipeConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpsertSwipe(t *testing.T) {
+	db, mock, err := NewMock()
+	assert.NoError(t, err)
+	repo := repo{db}
+
+	query := regexp.QuoteMeta(`INSERT INTO "swipes" ("created_at","updated_at","deleted_at","user_id","target_user_id","swiped_right") VALUES ($1,$2,$3,$4,$5,$6) ` +
+		`ON CONFLICT ("user_id","target_user_id") WHERE deleted_at IS NULL DO UPDATE SET "swiped_right"="excluded"."swiped_right","updated_at"="excluded"."updated_at" ` +
+		`WHERE "swipes"."swiped_right" <> "excluded"."swiped_right" RETURNING "id"`)
+	mock.ExpectBegin()
+	mock.ExpectQuery(query).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, 1, 2, false).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectCommit()
+
+	swipe := &Swipe{UserID: 1, TargetUserID: 2}
+	changed, err := repo.UpsertSwipe(context.Background(), swipe)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, uint(5), swipe.ID)
+
+	// the same decision again leaves the swipe as it is
+	mock.ExpectBegin()
+	mock.ExpectQuery(query).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, 1, 2, false).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+	changed, err = repo.UpsertSwipe(context.Background(), &Swipe{UserID: 1, TargetUserID: 2})
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithinTransaction(t *testing.T) {
+	db, mock, err := NewMock()
+	assert.NoError(t, err)
+	uow := &repo{db}
+
+	// the lock and the swipe share the transaction whichever user the pair is given with
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`)).
+		WithArgs("user_pair:2:7").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "swipes"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	err = uow.WithinTransaction(context.Background(), func(repos *Repository) error {
+		if err := repos.SwipeRepo.LockUserPair(context.Background(), 7, 2); err != nil {
+			return err
+		}
+		_, err := repos.SwipeRepo.UpsertSwipe(context.Background(), &Swipe{UserID: 7, TargetUserID: 2, SwipedRight: true})
+		return err
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// an error of the function rolls the transaction back
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	err = uow.WithinTransaction(context.Background(), func(repos *Repository) error {
+		return constant.ErrSwipeConflict
+	})
+	assert.ErrorIs(t, err, constant.ErrSwipeConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateRefreshToken saves a new refresh token in the database
+func (r *repo) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+// FindRefreshToken finds a refresh token by its hash, it returns nil when the token does not exist
+func (r *repo) FindRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	var token RefreshToken
+	if err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "finding refresh token")
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed marks a refresh token as used, it reports false if the token had already been used
+func (r *repo) MarkRefreshTokenUsed(ctx context.Context, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "marking refresh token as used")
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RevokeRefreshTokenFamily revokes every refresh token rotated from the same login
+func (r *repo) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	err := r.db.WithContext(ctx).Model(&RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+	return errors.Wrap(err, "revoking refresh token family")
+}
+
+// RevokeUserRefreshTokens revokes every refresh token of the user
+func (r *repo) RevokeUserRefreshTokens(ctx context.Context, userID uint) error {
+	err := r.db.WithContext(ctx).Model(&RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+	return errors.Wrap(err, "revoking user refresh tokens")
+}
+
+// RevokeAccessToken saves the id of a revoked access token, revoking the same token twice is not an error
+func (r *repo) RevokeAccessToken(ctx context.Context, token *RevokedToken) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(token).Error
+	return errors.Wrap(err, "revoking access token")
+}
+
+// IsAccessTokenRevoked checks if the access token with the given id has been revoked
+func (r *repo) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, errors.Wrap(err, "checking revoked access token")
+	}
+	return count > 0, nil
+}
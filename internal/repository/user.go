@@ -7,45 +7,58 @@ import (
 	"github.com/a-berahman/dating-app/constant"
 	"github.com/a-berahman/dating-app/pkg/geo"
 	hash "github.com/a-berahman/dating-app/pkg/hash"
+	"github.com/a-berahman/dating-app/pkg/utils"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
-// Create saves a new user in the database
+// Create saves a new user in the database, the email is stored lower-cased
 func (r *repo) Create(ctx context.Context, email, password, name string, gender constant.UserGender, dateOfBirth time.Time, lat, lng float64) (uint, error) {
 	hashedPassword, err := hash.Generate([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return 0, errors.Wrap(err, "hashing password")
 	}
 
-	location, err := geo.GeoEncode(lat, lng)
-	if err != nil {
-		return 0, errors.Wrap(err, "encoding location")
-	}
-
 	user := &User{
-		Email:       email,
+		Email:       utils.NormalizeEmail(email),
 		Password:    string(hashedPassword),
 		Name:        name,
-		Location:    location,
+		Location:    geo.Point{Lat: lat, Lng: lng},
 		Gender:      string(gender),
 		DateOfBirth: dateOfBirth,
 	}
 
 	result := r.db.WithContext(ctx).Create(user)
 	if result.Error != nil {
+		// a concurrent registration took the email after it was checked
+		if isUniqueViolation(result.Error) {
+			return 0, constant.ErrEmailInUse
+		}
 		return 0, result.Error
 	}
 
 	return user.ID, nil
 }
 
-// FindByEmail finds a user by email
+// FindByEmail finds a user by email regardless of its case
 func (r *repo) FindByEmail(ctx context.Context, email string) (*User, error) {
 
 	var user User
-	result := r.db.WithContext(ctx).Where("email = ?", email).First(&user)
+	result := r.db.WithContext(ctx).Where("lower(email) = ?", utils.NormalizeEmail(email)).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &user, nil
+}
+
+// FindByID finds a user by id, it returns nil when the user does not exist
+func (r *repo) FindByID(ctx context.Context, id uint) (*User, error) {
+	var user User
+	result := r.db.WithContext(ctx).First(&user, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -55,14 +68,53 @@ func (r *repo) FindByEmail(ctx context.Context, email string) (*User, error) {
 	return &user, nil
 }
 
-// Authenticate checks if credentials are correct
+// SetTokensValidAfter invalidates every access token of the user issued before the given time
+func (r *repo) SetTokensValidAfter(ctx context.Context, userID uint, validAfter time.Time) error {
+	err := r.db.WithContext(ctx).Model(&User{}).Where("id = ?", userID).Update("tokens_valid_after", validAfter).Error
+	return errors.Wrap(err, "updating tokens valid after")
+}
+
+// UpdateLocation saves the last known location of the user
+func (r *repo) UpdateLocation(ctx context.Context, userID uint, lat, lng float64) error {
+	err := r.db.WithContext(ctx).Model(&User{}).Where("id = ?", userID).Update("location", geo.Point{Lat: lat, Lng: lng}).Error
+	return errors.Wrap(err, "updating location")
+}
+
+// UpdateLastActive saves the last time the user was active
+func (r *repo) UpdateLastActive(ctx context.Context, userID uint, activeAt time.Time) error {
+	err := r.db.WithContext(ctx).Model(&User{}).Where("id = ?", userID).Update("last_active_at", activeAt).Error
+	return errors.Wrap(err, "updating last active")
+}
+
+// UpdatePassword hashes and saves a new password for the user
+func (r *repo) UpdatePassword(ctx context.Context, userID uint, password string) error {
+	hashedPassword, err := hash.Generate([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.Wrap(err, "hashing password")
+	}
+	err = r.db.WithContext(ctx).Model(&User{}).Where("id = ?", userID).Update("password", string(hashedPassword)).Error
+	return errors.Wrap(err, "updating password")
+}
+
+// MarkVerified marks the email of the user as verified, verifying an already verified user keeps the first verification time
+func (r *repo) MarkVerified(ctx context.Context, userID uint) error {
+	err := r.db.WithContext(ctx).Model(&User{}).
+		Where("id = ? AND verified_at IS NULL", userID).
+		Update("verified_at", time.Now()).Error
+	return errors.Wrap(err, "marking user as verified")
+}
+
+// Authenticate checks if credentials are correct, it returns ErrInvalidCredentials for an unknown email or a wrong password
 func (r *repo) Authenticate(ctx context.Context, email, password string) (*User, error) {
 	var user User
-	if err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
+	if err := r.db.WithContext(ctx).Where("lower(email) = ?", utils.NormalizeEmail(email)).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, constant.ErrInvalidCredentials
+		}
 		return nil, errors.Wrap(err, "finding user")
 	}
 	if !hash.CheckPasswordHash(password, user.Password) {
-		return nil, errors.New("invalid credentials")
+		return nil, constant.ErrInvalidCredentials
 	}
 	return &user, nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/a-berahman/dating-app/constant"
 	"github.com/a-berahman/dating-app/pkg/geo"
 	hash "github.com/a-berahman/dating-app/pkg/hash"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/postgres"
@@ -52,7 +54,7 @@ func TestCreateUser(t *testing.T) {
 	}{
 		{
 			name:        "Successful Creation",
-			email:       "test@example.com",
+			email:       " Test@Example.com",
 			password:    "123",
 			personName:  "test name",
 			gender:      constant.UserGenderMale,
@@ -80,8 +82,8 @@ func TestCreateUser(t *testing.T) {
 
 			mock.ExpectBegin()
 			if !tc.expectError {
-				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users" ("created_at","updated_at","deleted_at","email","password","name","gender","date_of_birth","location") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "id"`)).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), tc.email, sqlmock.AnyArg(), tc.personName, tc.gender, sqlmock.AnyArg(), location).
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users" ("created_at","updated_at","deleted_at","email","password","name","gender","date_of_birth","location","verified_at","tokens_valid_after","last_active_at") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12) RETURNING "id"`)).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), strings.ToLower(strings.TrimSpace(tc.email)), sqlmock.AnyArg(), tc.personName, tc.gender, sqlmock.AnyArg(), location, nil, nil, nil).
 					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 				mock.ExpectCommit()
 			} else {
@@ -101,6 +103,21 @@ func TestCreateUser(t *testing.T) {
 	}
 }
 
+func TestCreateDuplicateEmail(t *testing.T) {
+	db, mock, err := NewMock()
+	assert.NoError(t, err)
+	repo := repo{db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users"`)).
+		WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "idx_users_email_lower"})
+	mock.ExpectRollback()
+
+	_, err = repo.Create(context.Background(), "taken@example.com", "Passw0rd", "taken", constant.UserGenderFemale, time.Now(), 52.52, 13.405)
+	assert.ErrorIs(t, err, constant.ErrEmailInUse)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestAuthenticate(t *testing.T) {
 	db, mock, err := NewMock()
 	assert.NoError(t, err)
@@ -118,12 +135,12 @@ func TestAuthenticate(t *testing.T) {
 	}{
 		{
 			name:     "Successful Authentication",
-			email:    "testmail@example.com",
+			email:    "TestMail@Example.com ",
 			password: "passssssword",
 			setupMock: func() {
 				rows := sqlmock.NewRows([]string{"id", "email", "password"}).
 					AddRow(1, "testmail@example.com", string(hashedPassword))
-				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`)).
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE lower(email) = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`)).
 					WithArgs("testmail@example.com", 1). // Adding correct placeholder for LIMIT
 					WillReturnRows(rows)
 			},
@@ -135,7 +152,7 @@ func TestAuthenticate(t *testing.T) {
 			email:    "testmail@example.com",
 			password: "passssssword",
 			setupMock: func() {
-				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`)).
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE lower(email) = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`)).
 					WithArgs("testmail@example.com", 1).
 					WillReturnError(gorm.ErrRecordNotFound)
 			},
@@ -149,7 +166,7 @@ func TestAuthenticate(t *testing.T) {
 			setupMock: func() {
 				rows := sqlmock.NewRows([]string{"id", "email", "password"}).
 					AddRow(1, "testmail@example.com", string(hashedPassword))
-				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`)).
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE lower(email) = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`)).
 					WithArgs("testmail@example.com", 1).
 					WillReturnRows(rows)
 			},
@@ -189,11 +206,11 @@ func TestFindByEmail(t *testing.T) {
 	}{
 		{
 			name:  "Successful Find",
-			email: "ahmad@test.com",
+			email: "Ahmad@Test.com",
 			setupMock: func() {
 				rows := sqlmock.NewRows([]string{"id", "email", "password", "name", "gender", "date_of_birth", "location"}).
-					AddRow(1, "ahmad@test.com", "passsssssswwwooord", "ahmad", "MALE", time.Now(), "location")
-				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`)).
+					AddRow(1, "ahmad@test.com", "passsssssswwwooord", "ahmad", "MALE", time.Now(), "0101000020E610000072D68656DD5E40C08FC2F5285CD44740")
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE lower(email) = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`)).
 					WithArgs("ahmad@test.com", 1).
 					WillReturnRows(rows)
 			},
@@ -204,7 +221,7 @@ func TestFindByEmail(t *testing.T) {
 				Name:        "ahmad",
 				Gender:      "MALE",
 				DateOfBirth: time.Now(),
-				Location:    "location",
+				Location:    geo.Point{Lat: 47.6590625, Lng: -32.74112969955321},
 			},
 			expectError: false,
 		},
@@ -234,6 +251,7 @@ func TestFindByEmail(t *testing.T) {
 				assert.Equal(t, tc.expectUser.ID, user.ID)
 				assert.Equal(t, tc.expectUser.Email, user.Email)
 				assert.Equal(t, tc.expectUser.Name, user.Name)
+				assert.Equal(t, tc.expectUser.Location, user.Location)
 			}
 
 		})
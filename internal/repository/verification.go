@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// CreateVerificationToken saves a new email verification token in the database
+func (r *repo) CreateVerificationToken(ctx context.Context, token *EmailVerificationToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+// FindVerificationToken finds an email verification token by its hash, it returns nil when the token does not exist
+func (r *repo) FindVerificationToken(ctx context.Context, tokenHash string) (*EmailVerificationToken, error) {
+	var token EmailVerificationToken
+	if err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "finding email verification token")
+	}
+	return &token, nil
+}
+
+// MarkVerificationTokenUsed marks an email verification token as used, it reports false if the token had already been used
+func (r *repo) MarkVerificationTokenUsed(ctx context.Context, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&EmailVerificationToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "marking email verification token as used")
+	}
+	return result.RowsAffected == 1, nil
+}
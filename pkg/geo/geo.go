@@ -14,7 +14,7 @@ const (
 
 // GeoEncode encodes a latitude and longitude into a hex string
 func GeoEncode(lat, long float64) (string, error) {
-	g := geom.NewPoint(geom.XY).MustSetCoords([]float64{long, lat}).SetSRID(4326)
+	g := geom.NewPoint(geom.XY).MustSetCoords([]float64{long, lat}).SetSRID(SRID)
 	return ewkbhex.Encode(g, ewkbhex.NDR)
 
 }
@@ -0,0 +1,49 @@
+package geo
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// SRID is the spatial reference of the stored points, WGS 84 longitude and latitude
+const SRID = 4326
+
+// Point is a location stored in a PostGIS geography(Point,4326) column,
+// it is written and read as the EWKB hex that PostGIS uses for the text format of geographies
+type Point struct {
+	Lat float64
+	Lng float64
+}
+
+// GormDataType is the column type that GORM migrates the point to
+func (Point) GormDataType() string {
+	return fmt.Sprintf("geography(Point,%d)", SRID)
+}
+
+// Scan reads a point from the EWKB hex returned by the database
+func (p *Point) Scan(src interface{}) error {
+	var location string
+	switch v := src.(type) {
+	case nil:
+		*p = Point{}
+		return nil
+	case []byte:
+		location = string(v)
+	case string:
+		location = v
+	default:
+		return fmt.Errorf("cannot scan %T into a point", src)
+	}
+
+	point, err := GeoDecodeString(location)
+	if err != nil {
+		return err
+	}
+	*p = Point{Lat: point.Y(), Lng: point.X()}
+	return nil
+}
+
+// Value writes the point as EWKB hex that the database casts to a geography
+func (p Point) Value() (driver.Value, error) {
+	return GeoEncode(p.Lat, p.Lng)
+}
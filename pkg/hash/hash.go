@@ -1,6 +1,11 @@
 package hashedPassword
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"golang.org/x/crypto/bcrypt"
+)
 
 func CheckPasswordHash(password, hash string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
@@ -8,3 +13,9 @@ func CheckPasswordHash(password, hash string) bool {
 func Generate(password []byte, cost int) ([]byte, error) {
 	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 }
+
+// SHA256 returns the hex encoded SHA-256 digest of the value, it is used for high entropy tokens that must not be stored in plain text
+func SHA256(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
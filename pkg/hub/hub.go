@@ -0,0 +1,244 @@
+package hub
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidID is returned for an event id the hub could not have given
+var ErrInvalidID = errors.New("invalid event id")
+
+// Event is a notification delivered to the connected devices of a user, Data is encoded as JSON. The hub numbers
+// the events of every user so a device that reconnects can resume after the last event it received, the ids are
+// prefixed by the epoch of the hub so the ids given before a restart are never mistaken for new ones
+type Event struct {
+	ID   string             `json:"id,omitempty"`
+	Type constant.EventType `json:"type"`
+	Data interface{}        `json:"data,omitempty"`
+	// Ephemeral events only matter while they happen, they are delivered to the connected devices without an id and are not replayed
+	Ephemeral bool `json:"-"`
+}
+
+// Publisher delivers events to the connected devices of users
+type Publisher interface {
+	Publish(event Event, userIDs ...uint)
+}
+
+// Hub fans out the events of a user to every connected device of the user and keeps the latest events of every user
+// so the devices can resume. It only knows the devices connected to this process, several instances need a shared
+// broker in front of their hubs
+type Hub struct {
+	epoch      string
+	bufferSize int
+	logSize    int
+	retention  time.Duration
+
+	mu        sync.Mutex
+	clients   map[uint]map[*Client]struct{}
+	logs      map[uint]*eventLog
+	lastPurge time.Time
+}
+
+// eventLog is the latest events of a user, the oldest first. Their numbers follow each other up to lastID
+type eventLog struct {
+	lastID    uint64
+	events    []Event
+	updatedAt time.Time
+}
+
+// New creates a hub that buffers the given number of events for every device and keeps the given number of events
+// of every user, the events of a user are forgotten once the user has received none for the retention
+func New(bufferSize, logSize int, retention time.Duration) *Hub {
+	return &Hub{
+		epoch:      strconv.FormatInt(time.Now().UnixNano(), 36),
+		bufferSize: bufferSize,
+		logSize:    logSize,
+		retention:  retention,
+		clients:    make(map[uint]map[*Client]struct{}),
+		logs:       make(map[uint]*eventLog),
+	}
+}
+
+// Client is a connected device of a user, it receives the events of the user until it unsubscribes or is dropped
+type Client struct {
+	UserID uint
+
+	events    chan Event
+	dropped   chan struct{}
+	closeOnce sync.Once
+}
+
+// Events returns the events published to the user of the client
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+// Dropped is closed when the hub drops the client because it did not keep up with its events, the connection
+// should be closed so the device reconnects and catches up
+func (c *Client) Dropped() <-chan struct{} {
+	return c.dropped
+}
+
+func (c *Client) drop() {
+	c.closeOnce.Do(func() { close(c.dropped) })
+}
+
+// Subscribe connects a device of the user
+func (h *Hub) Subscribe(userID uint) *Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.subscribe(userID)
+}
+
+// SubscribeSince connects a device of the user that has received the events up to the given id and returns the
+// events it missed. It reports false when some of them are not kept anymore, the device then has to reload its state.
+// An empty id is a device that has received no event
+func (h *Hub) SubscribeSince(userID uint, lastID string) (*Client, []Event, bool, error) {
+	epoch, last := h.epoch, uint64(0)
+	if lastID != "" {
+		var err error
+		if epoch, last, err = parseID(lastID); err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	client := h.subscribe(userID)
+
+	log := h.logs[userID]
+	if log == nil {
+		return client, nil, epoch == h.epoch && last == 0, nil
+	}
+	if epoch != h.epoch || last > log.lastID {
+		// the id comes from before a restart, every kept event is new to the device
+		return client, append([]Event(nil), log.events...), false, nil
+	}
+	first := log.lastID - uint64(len(log.events)) + 1
+	var missed []Event
+	if last >= first {
+		missed = append(missed, log.events[last-first+1:]...)
+	} else {
+		missed = append(missed, log.events...)
+	}
+	return client, missed, first <= last+1, nil
+}
+
+// Epoch returns the prefix of the ids of the events, it changes every time the process starts
+func (h *Hub) Epoch() string {
+	return h.epoch
+}
+
+// subscribe connects a device of the user, the caller must hold the lock
+func (h *Hub) subscribe(userID uint) *Client {
+	client := &Client{UserID: userID, events: make(chan Event, h.bufferSize), dropped: make(chan struct{})}
+	if h.clients[userID] == nil {
+		h.clients[userID] = make(map[*Client]struct{})
+	}
+	h.clients[userID][client] = struct{}{}
+	return client
+}
+
+// Unsubscribe disconnects a device, it does not receive events anymore
+func (h *Hub) Unsubscribe(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients[client.UserID], client)
+	if len(h.clients[client.UserID]) == 0 {
+		delete(h.clients, client.UserID)
+	}
+	client.drop()
+}
+
+// Publish numbers the event for every user and delivers it to their connected devices without blocking, a device
+// whose buffer is full is dropped instead of slowing down the publisher and the other devices
+func (h *Hub) Publish(event Event, userIDs ...uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	h.purgeExpired(now)
+
+	for i, userID := range userIDs {
+		if containsBefore(userIDs, i) {
+			continue
+		}
+		delivered := event
+		if !event.Ephemeral {
+			delivered.ID = h.record(userID, event, now)
+		}
+		for client := range h.clients[userID] {
+			select {
+			case client.events <- delivered:
+			default:
+				client.drop()
+			}
+		}
+	}
+}
+
+// record appends the event to the log of the user and returns its id, the caller must hold the lock
+func (h *Hub) record(userID uint, event Event, now time.Time) string {
+	log := h.logs[userID]
+	if log == nil {
+		log = &eventLog{}
+		h.logs[userID] = log
+	}
+	log.lastID++
+	event.ID = fmt.Sprintf("%s-%d", h.epoch, log.lastID)
+	log.events = append(log.events, event)
+	if len(log.events) > h.logSize {
+		log.events = log.events[len(log.events)-h.logSize:]
+	}
+	log.updatedAt = now
+	return event.ID
+}
+
+// purgeExpired forgets the logs of the users without events for the retention at most once per retention,
+// the caller must hold the lock
+func (h *Hub) purgeExpired(now time.Time) {
+	if now.Sub(h.lastPurge) < h.retention {
+		return
+	}
+	h.lastPurge = now
+	for userID, log := range h.logs {
+		if now.Sub(log.updatedAt) > h.retention {
+			delete(h.logs, userID)
+		}
+	}
+}
+
+// Connections returns the number of connected devices of the user
+func (h *Hub) Connections(userID uint) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients[userID])
+}
+
+// parseID returns the epoch and the number of an event id
+func parseID(id string) (string, uint64, error) {
+	epoch, number, found := strings.Cut(id, "-")
+	if !found || epoch == "" {
+		return "", 0, ErrInvalidID
+	}
+	n, err := strconv.ParseUint(number, 10, 64)
+	if err != nil {
+		return "", 0, ErrInvalidID
+	}
+	return epoch, n, nil
+}
+
+// containsBefore reports whether the user at index i is also given earlier so the user only gets the event once
+func containsBefore(userIDs []uint, i int) bool {
+	for _, userID := range userIDs[:i] {
+		if userID == userIDs[i] {
+			return true
+		}
+	}
+	return false
+}
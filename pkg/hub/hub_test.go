@@ -0,0 +1,177 @@
+package hub
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/stretchr/testify/assert"
+)
+
+func receive(t *testing.T, client *Client) []Event {
+	t.Helper()
+	var events []Event
+	for {
+		select {
+		case event := <-client.Events():
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// id returns the id the hub gives to the event with the given number
+func id(h *Hub, n uint64) string {
+	return fmt.Sprintf("%s-%d", h.Epoch(), n)
+}
+
+func TestHubFanOut(t *testing.T) {
+	h := New(4, 10, time.Hour)
+	phone, laptop, other := h.Subscribe(1), h.Subscribe(1), h.Subscribe(2)
+	assert.Equal(t, 2, h.Connections(1))
+
+	match := Event{Type: constant.EventMatchCreated, Data: map[string]uint{"matchId": 7}}
+	h.Publish(match, 1, 1)
+	match.ID = id(h, 1)
+	assert.Equal(t, []Event{match}, receive(t, phone))
+	assert.Equal(t, []Event{match}, receive(t, laptop))
+	assert.Empty(t, receive(t, other))
+
+	// an unsubscribed device does not receive events anymore
+	h.Unsubscribe(laptop)
+	h.Publish(Event{Type: constant.EventMessageCreated}, 1, 2)
+	assert.Equal(t, []Event{{ID: id(h, 2), Type: constant.EventMessageCreated}}, receive(t, phone))
+	assert.Empty(t, receive(t, laptop))
+	// the events are numbered for every user
+	assert.Equal(t, []Event{{ID: id(h, 1), Type: constant.EventMessageCreated}}, receive(t, other))
+	assert.Equal(t, 1, h.Connections(1))
+
+	h.Unsubscribe(phone)
+	assert.Zero(t, h.Connections(1))
+}
+
+func TestHubSubscribeSince(t *testing.T) {
+	h := New(10, 3, time.Hour)
+	for i := 0; i < 5; i++ {
+		h.Publish(Event{Type: constant.EventMessageCreated}, 1)
+	}
+	// ephemeral events are delivered but not numbered nor kept
+	typist := h.Subscribe(1)
+	h.Publish(Event{Type: constant.EventTyping, Ephemeral: true}, 1)
+	assert.Equal(t, []Event{{Type: constant.EventTyping, Ephemeral: true}}, receive(t, typist))
+
+	ids := func(numbers ...uint64) []string {
+		var ids []string
+		for _, n := range numbers {
+			ids = append(ids, id(h, n))
+		}
+		return ids
+	}
+	missedIDs := func(events []Event) []string {
+		var ids []string
+		for _, event := range events {
+			ids = append(ids, event.ID)
+		}
+		return ids
+	}
+	tests := []struct {
+		name        string
+		userID      uint
+		lastID      string
+		expectedIDs []string
+		complete    bool
+		err         error
+	}{
+		{name: "up to date", userID: 1, lastID: id(h, 5), complete: true},
+		{name: "missed kept events", userID: 1, lastID: id(h, 3), expectedIDs: ids(4, 5), complete: true},
+		{name: "missed the oldest kept event", userID: 1, lastID: id(h, 2), expectedIDs: ids(3, 4, 5), complete: true},
+		{name: "missed forgotten events", userID: 1, lastID: id(h, 1), expectedIDs: ids(3, 4, 5), complete: false},
+		{name: "first connection", userID: 1, lastID: "", expectedIDs: ids(3, 4, 5), complete: false},
+		{name: "id ahead of the hub", userID: 1, lastID: id(h, 9), expectedIDs: ids(3, 4, 5), complete: false},
+		// the numbers start over after a restart, an id of the previous process is never taken for a recent one
+		{name: "id from before a restart", userID: 1, lastID: "previous-4", expectedIDs: ids(3, 4, 5), complete: false},
+		{name: "user without events", userID: 2, lastID: "", complete: true},
+		{name: "user without events anymore", userID: 2, lastID: id(h, 4), complete: false},
+		{name: "user without events since a restart", userID: 2, lastID: "previous-0", complete: false},
+		{name: "id without epoch", userID: 1, lastID: "4", err: ErrInvalidID},
+		{name: "id without number", userID: 1, lastID: h.Epoch() + "-", err: ErrInvalidID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, missed, complete, err := h.SubscribeSince(tt.userID, tt.lastID)
+			assert.Equal(t, tt.err, err)
+			if err != nil {
+				assert.Nil(t, client)
+				return
+			}
+			defer h.Unsubscribe(client)
+			assert.Equal(t, tt.expectedIDs, missedIDs(missed))
+			assert.Equal(t, tt.complete, complete)
+		})
+	}
+
+	// the events published after the subscription are delivered, not replayed
+	client, _, _, _ := h.SubscribeSince(1, id(h, 5))
+	h.Publish(Event{Type: constant.EventMatchCreated}, 1)
+	assert.Equal(t, []Event{{ID: id(h, 6), Type: constant.EventMatchCreated}}, receive(t, client))
+}
+
+func TestHubForgetsIdleLogs(t *testing.T) {
+	h := New(10, 10, time.Millisecond)
+	h.Publish(Event{Type: constant.EventMessageCreated}, 1)
+	time.Sleep(2 * time.Millisecond)
+	h.Publish(Event{Type: constant.EventMessageCreated}, 2)
+
+	// the numbering of a forgotten user starts over so a device that resumes reloads its state
+	client, missed, complete, _ := h.SubscribeSince(1, id(h, 1))
+	defer h.Unsubscribe(client)
+	assert.Empty(t, missed)
+	assert.False(t, complete)
+}
+
+func TestHubDropsSlowClients(t *testing.T) {
+	h := New(2, 10, time.Hour)
+	slow, fast := h.Subscribe(1), h.Subscribe(1)
+
+	for i := 0; i < 2; i++ {
+		h.Publish(Event{Type: constant.EventMessageCreated}, 1)
+	}
+	assert.Len(t, receive(t, fast), 2)
+
+	// the buffer of the slow device is full, the next event drops it without blocking the others
+	h.Publish(Event{Type: constant.EventMessageCreated}, 1)
+	select {
+	case <-slow.Dropped():
+	default:
+		t.Fatal("the slow client has not been dropped")
+	}
+	assert.Len(t, receive(t, fast), 1)
+	select {
+	case <-fast.Dropped():
+		t.Fatal("the fast client has been dropped")
+	default:
+	}
+}
+
+func TestHubConcurrentPublish(t *testing.T) {
+	h := New(constant.EventBufferSize, constant.EventLogSize, constant.EventLogRetention)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			client := h.Subscribe(1)
+			receive(t, client)
+			h.Unsubscribe(client)
+		}()
+		go func() {
+			defer wg.Done()
+			h.Publish(Event{Type: constant.EventTyping}, 1)
+		}()
+	}
+	wg.Wait()
+	assert.Zero(t, h.Connections(1))
+}
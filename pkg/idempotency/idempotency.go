@@ -0,0 +1,32 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Response is a stored response that is replayed to the retries of a request
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Entry is the state of an idempotency key, Response is nil while the first request is still in flight
+type Entry struct {
+	Fingerprint string    // Fingerprint identifies the request the key was first used with, a retry must send the same request
+	Response    *Response // Response is the response of the first request once it is completed
+	CreatedAt   time.Time
+}
+
+// Store keeps the responses of the idempotency keys, implementations must apply Reserve atomically
+// so only one of two concurrent requests with the same key is processed
+type Store interface {
+	// Reserve saves an in flight entry for the key and returns false, or returns the existing entry of the key and true
+	Reserve(ctx context.Context, key, fingerprint string) (Entry, bool, error)
+	// Complete saves the response of the request that reserved the key
+	Complete(ctx context.Context, key string, response Response) error
+	// Release removes the key so that the request can be retried, it is used when the request could not be completed
+	Release(ctx context.Context, key string) error
+}
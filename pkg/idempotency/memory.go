@@ -0,0 +1,69 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps the entries in the memory of the process,
+// it is enough for a single instance and for tests while several instances need a shared store
+type MemoryStore struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]Entry
+	lastPurge time.Time
+}
+
+// NewMemoryStore creates a store that forgets the keys after the given time
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{ttl: ttl, entries: make(map[string]Entry)}
+}
+
+// Reserve saves an in flight entry for the key unless the key already has an entry
+func (ms *MemoryStore) Reserve(ctx context.Context, key, fingerprint string) (Entry, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	now := time.Now()
+	ms.purgeExpired(now)
+
+	if entry, found := ms.entries[key]; found && now.Sub(entry.CreatedAt) <= ms.ttl {
+		return entry, true, nil
+	}
+	entry := Entry{Fingerprint: fingerprint, CreatedAt: now}
+	ms.entries[key] = entry
+	return entry, false, nil
+}
+
+// Complete saves the response of the key
+func (ms *MemoryStore) Complete(ctx context.Context, key string, response Response) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if entry, found := ms.entries[key]; found {
+		entry.Response = &response
+		ms.entries[key] = entry
+	}
+	return nil
+}
+
+// Release removes the entry of the key
+func (ms *MemoryStore) Release(ctx context.Context, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.entries, key)
+	return nil
+}
+
+// purgeExpired drops the expired entries at most once per TTL, the caller must hold the lock
+func (ms *MemoryStore) purgeExpired(now time.Time) {
+	if now.Sub(ms.lastPurge) < ms.ttl {
+		return
+	}
+	ms.lastPurge = now
+	for key, entry := range ms.entries {
+		if now.Sub(entry.CreatedAt) > ms.ttl {
+			delete(ms.entries, key)
+		}
+	}
+}
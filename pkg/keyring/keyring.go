@@ -0,0 +1,227 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+)
+
+// Key is a JWT key identified by its kid, verification only keys have no private key
+type Key struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+}
+
+// Keyring signs tokens with one active key and verifies tokens with any of its keys,
+// so a new signing key can be rolled out while tokens signed by the previous one are still accepted
+type Keyring struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// JWK is the public part of a key as defined by RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served by the JWKS endpoint
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// New creates a keyring that signs with the key of the given kid
+func New(signingKID string, keys ...*Key) (*Keyring, error) {
+	kr := &Keyring{keys: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		if _, ok := kr.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		kr.keys[key.ID] = key
+	}
+
+	signing, ok := kr.keys[signingKID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q not found", signingKID)
+	}
+	if signing.PrivateKey == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", signingKID)
+	}
+	kr.signing = signing
+	return kr, nil
+}
+
+// LoadDir loads every PEM file of the directory as a key named after the file without its extension,
+// the signing kid can be empty when the directory holds a single private key
+func LoadDir(dir, signingKID string) (*Keyring, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, errors.Wrap(err, "listing key files")
+	}
+	sort.Strings(paths)
+
+	keys := make([]*Key, 0, len(paths))
+	var privateKIDs []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading key file %s", path)
+		}
+		key, err := ParsePEM(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing key file %s", path)
+		}
+		if key.PrivateKey != nil {
+			privateKIDs = append(privateKIDs, key.ID)
+		}
+		keys = append(keys, key)
+	}
+
+	if signingKID == "" {
+		if len(privateKIDs) != 1 {
+			return nil, fmt.Errorf("expected exactly one private key in %s when no signing key id is set, found %d", dir, len(privateKIDs))
+		}
+		signingKID = privateKIDs[0]
+	}
+	return New(signingKID, keys...)
+}
+
+// NewEphemeral creates a keyring with a random Ed25519 key that only lives as long as the process,
+// it is meant for local runs and tests where tokens do not have to survive a restart
+func NewEphemeral() (*Keyring, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "generating ephemeral key")
+	}
+	return New("ephemeral", &Key{
+		ID:         "ephemeral",
+		Method:     jwt.SigningMethodEdDSA,
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+	})
+}
+
+// ParsePEM parses an RSA or Ed25519 private or public key, RSA keys sign with RS256 and Ed25519 keys with EdDSA
+func ParsePEM(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	// the keys are read without a passphrase, an encrypted block would only fail later with a misleading parse error
+	if _, ok := block.Headers["DEK-Info"]; ok || block.Type == "ENCRYPTED PRIVATE KEY" {
+		return nil, errors.New("encrypted PEM keys are not supported")
+	}
+
+	key := &Key{ID: kid}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.PrivateKey = privateKey
+	case "PRIVATE KEY":
+		privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.PrivateKey = privateKey
+	case "PUBLIC KEY":
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.PublicKey = publicKey
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+
+	switch k := key.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+		key.PublicKey = &k.PublicKey
+	case ed25519.PrivateKey:
+		key.PublicKey = k.Public()
+	case nil:
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", k)
+	}
+
+	switch key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", key.PublicKey)
+	}
+	return key, nil
+}
+
+// Sign signs the claims with the active key and sets its kid in the header
+func (kr *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(kr.signing.Method, claims)
+	token.Header["kid"] = kr.signing.ID
+	return token.SignedString(kr.signing.PrivateKey)
+}
+
+// Keyfunc resolves the verification key of a token from its kid, it is meant to be passed to the jwt parser
+func (kr *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := kr.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	// the algorithm of the header must match the key, otherwise a token could pick a weaker verification
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q for key %q", token.Method.Alg(), kid)
+	}
+	return key.PublicKey, nil
+}
+
+// JWKS returns the public part of every key of the keyring
+func (kr *Keyring) JWKS() JWKSet {
+	ids := make([]string, 0, len(kr.keys))
+	for id := range kr.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := JWKSet{Keys: make([]JWK, 0, len(ids))}
+	for _, id := range ids {
+		key := kr.keys[id]
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch k := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(k)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
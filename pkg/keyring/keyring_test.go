@@ -0,0 +1,317 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+func generateRSA(t *testing.T) *rsa.PrivateKey {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey
+}
+
+func generateEd25519(t *testing.T) ed25519.PrivateKey {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey
+}
+
+func privatePEM(t *testing.T, privateKey interface{}) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func publicPEM(t *testing.T, publicKey interface{}) []byte {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestParsePEM(t *testing.T) {
+	rsaKey := generateRSA(t)
+	edKey := generateEd25519(t)
+
+	testCases := []struct {
+		name          string
+		data          []byte
+		expectMethod  jwt.SigningMethod
+		expectPrivate bool
+		expectError   bool
+	}{
+		{
+			name:          "RSA PKCS1 Private Key",
+			data:          pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+			expectMethod:  jwt.SigningMethodRS256,
+			expectPrivate: true,
+		},
+		{
+			name:          "RSA PKCS8 Private Key",
+			data:          privatePEM(t, rsaKey),
+			expectMethod:  jwt.SigningMethodRS256,
+			expectPrivate: true,
+		},
+		{
+			name:         "RSA Public Key",
+			data:         publicPEM(t, &rsaKey.PublicKey),
+			expectMethod: jwt.SigningMethodRS256,
+		},
+		{
+			name:          "Ed25519 Private Key",
+			data:          privatePEM(t, edKey),
+			expectMethod:  jwt.SigningMethodEdDSA,
+			expectPrivate: true,
+		},
+		{
+			name:         "Ed25519 Public Key",
+			data:         publicPEM(t, edKey.Public()),
+			expectMethod: jwt.SigningMethodEdDSA,
+		},
+		{
+			name:        "No PEM Block",
+			data:        []byte("not a key"),
+			expectError: true,
+		},
+		{
+			name:        "Unsupported Block Type",
+			data:        pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: []byte{1, 2, 3}}),
+			expectError: true,
+		},
+		{
+			name:        "Encrypted PKCS8 Private Key",
+			data:        pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte{1, 2, 3}}),
+			expectError: true,
+		},
+		{
+			name: "Encrypted PKCS1 Private Key",
+			data: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Headers: map[string]string{
+				"Proc-Type": "4,ENCRYPTED",
+				"DEK-Info":  "AES-256-CBC,00000000000000000000000000000000",
+			}, Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := ParsePEM("kid", tc.data)
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Nil(t, key)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, "kid", key.ID)
+			assert.Equal(t, tc.expectMethod, key.Method)
+			assert.NotNil(t, key.PublicKey)
+			assert.Equal(t, tc.expectPrivate, key.PrivateKey != nil)
+		})
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	writeKeys := func(t *testing.T, files map[string][]byte) string {
+		dir := t.TempDir()
+		for name, data := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return dir
+	}
+	current := generateEd25519(t)
+	previous := generateEd25519(t)
+
+	t.Run("Single Private Key", func(t *testing.T) {
+		dir := writeKeys(t, map[string][]byte{
+			"2024-02.pem": privatePEM(t, current),
+			"2024-01.pem": publicPEM(t, previous.Public()),
+			"notes.txt":   []byte("ignored"),
+		})
+
+		kr, err := LoadDir(dir, "")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "2024-02", kr.signing.ID)
+			assert.Len(t, kr.keys, 2)
+		}
+	})
+
+	t.Run("Signing Key Id", func(t *testing.T) {
+		dir := writeKeys(t, map[string][]byte{
+			"2024-02.pem": privatePEM(t, current),
+			"2024-01.pem": privatePEM(t, previous),
+		})
+
+		kr, err := LoadDir(dir, "2024-01")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "2024-01", kr.signing.ID)
+		}
+	})
+
+	t.Run("Several Private Keys Without Signing Key Id", func(t *testing.T) {
+		dir := writeKeys(t, map[string][]byte{
+			"2024-02.pem": privatePEM(t, current),
+			"2024-01.pem": privatePEM(t, previous),
+		})
+
+		_, err := LoadDir(dir, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("Signing Key Without Private Key", func(t *testing.T) {
+		dir := writeKeys(t, map[string][]byte{
+			"2024-02.pem": privatePEM(t, current),
+			"2024-01.pem": publicPEM(t, previous.Public()),
+		})
+
+		_, err := LoadDir(dir, "2024-01")
+		assert.Error(t, err)
+	})
+}
+
+func TestSignAndKeyfunc(t *testing.T) {
+	rsaKey := generateRSA(t)
+	edKey := generateEd25519(t)
+	rsaParsed, err := ParsePEM("rsa", privatePEM(t, rsaKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	edParsed, err := ParsePEM("ed", privatePEM(t, edKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.StandardClaims{Subject: "1", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+
+	for _, signingKID := range []string{"rsa", "ed"} {
+		t.Run("Signed With "+signingKID, func(t *testing.T) {
+			kr, err := New(signingKID, rsaParsed, edParsed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signed, err := kr.Sign(claims)
+			if !assert.NoError(t, err) {
+				return
+			}
+			token, err := jwt.Parse(signed, kr.Keyfunc)
+			if assert.NoError(t, err) {
+				assert.True(t, token.Valid)
+				assert.Equal(t, signingKID, token.Header["kid"])
+			}
+		})
+	}
+
+	kr, err := New("rsa", rsaParsed, edParsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(method jwt.SigningMethod, kid interface{}, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != nil {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	testCases := []struct {
+		name  string
+		token string
+	}{
+		{
+			name:  "Unknown Kid",
+			token: sign(jwt.SigningMethodRS256, "other", rsaKey),
+		},
+		{
+			name:  "Missing Kid",
+			token: sign(jwt.SigningMethodRS256, nil, rsaKey),
+		},
+		{
+			// the public key is no secret, it must not be accepted as the HMAC key
+			name:  "HS256 Against An RSA Key",
+			token: sign(jwt.SigningMethodHS256, "rsa", publicPEM(t, &rsaKey.PublicKey)),
+		},
+		{
+			name:  "EdDSA Against An RSA Key",
+			token: sign(jwt.SigningMethodEdDSA, "rsa", edKey),
+		},
+		{
+			name:  "RS256 Against An Ed25519 Key",
+			token: sign(jwt.SigningMethodRS256, "ed", rsaKey),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := jwt.Parse(tc.token, kr.Keyfunc)
+			assert.Error(t, err)
+			if token != nil {
+				assert.False(t, token.Valid)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey := generateRSA(t)
+	edKey := generateEd25519(t)
+	rsaParsed, err := ParsePEM("rsa", privatePEM(t, rsaKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	edParsed, err := ParsePEM("ed", publicPEM(t, edKey.Public()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kr, err := New("rsa", rsaParsed, edParsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := kr.JWKS()
+	if !assert.Len(t, set.Keys, 2) {
+		return
+	}
+
+	okp := set.Keys[0]
+	assert.Equal(t, JWK{Kty: "OKP", Kid: "ed", Use: "sig", Alg: "EdDSA", Crv: "Ed25519", X: okp.X}, okp)
+	x, err := base64.RawURLEncoding.DecodeString(okp.X)
+	if assert.NoError(t, err) {
+		assert.Equal(t, edKey.Public(), ed25519.PublicKey(x))
+	}
+
+	jwk := set.Keys[1]
+	assert.Equal(t, JWK{Kty: "RSA", Kid: "rsa", Use: "sig", Alg: "RS256", N: jwk.N, E: "AQAB"}, jwk)
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	assert.NoError(t, err)
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	assert.NoError(t, err)
+	publicKey := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	assert.True(t, rsaKey.PublicKey.Equal(publicKey))
+}
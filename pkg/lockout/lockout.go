@@ -0,0 +1,137 @@
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Entry is the attempt history of a key
+type Entry struct {
+	Attempts    int       // Attempts is the number of attempts since the last reset that did not succeed
+	LastAttempt time.Time // LastAttempt is the time of the last counted attempt
+	LockedUntil time.Time // LockedUntil is the end of the lockout of the key, it is zero when the key is not locked
+}
+
+// Store keeps the attempt history of the keys, implementations must apply Update atomically
+// so concurrent attempts of the same key are all counted
+type Store interface {
+	Update(ctx context.Context, key string, fn func(entry Entry, found bool) (Entry, bool)) (Entry, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Policy defines how many attempts are allowed before the backoff and the lockout start
+type Policy struct {
+	FreeAttempts    int           // FreeAttempts is the number of attempts allowed without any delay
+	BaseDelay       time.Duration // BaseDelay is the delay after the first attempt beyond the free ones, it doubles on every attempt
+	MaxDelay        time.Duration // MaxDelay caps the backoff delay
+	MaxAttempts     int           // MaxAttempts is the number of attempts that locks the key out
+	LockoutDuration time.Duration // LockoutDuration is how long a key stays locked out
+	ResetAfter      time.Duration // ResetAfter forgets the attempts of a key that has not been tried for this long
+}
+
+// LockedError is returned when a key has to wait before its next attempt
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many attempts, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+// Limiter counts the attempts of keys, like an email or a client IP, and delays them with an exponential backoff
+// until they are locked out. Attempts are counted before their outcome is known so parallel attempts cannot
+// slip through the backoff, successful attempts are then reset or forgiven by the caller
+type Limiter struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+// NewLimiter creates a new instance of Limiter
+func NewLimiter(store Store, policy Policy) *Limiter {
+	return &Limiter{store: store, policy: policy, now: time.Now}
+}
+
+// Attempt counts an attempt of the key, it returns a LockedError without counting it when the key has to wait.
+// The returned time is the end of the lockout when this attempt locked the key out and zero otherwise
+func (l *Limiter) Attempt(ctx context.Context, key string) (time.Time, error) {
+	now := l.now()
+	var retryAfter time.Duration
+	var locked bool
+	entry, err := l.store.Update(ctx, key, func(entry Entry, found bool) (Entry, bool) {
+		retryAfter, locked = 0, false
+		if !found || l.expired(entry, now) {
+			entry = Entry{}
+		}
+		if now.Before(entry.LockedUntil) {
+			retryAfter = entry.LockedUntil.Sub(now)
+			return entry, false
+		}
+		if !entry.LockedUntil.IsZero() {
+			// the lockout is over, the key starts again without any attempt
+			entry = Entry{}
+		}
+		if next := entry.LastAttempt.Add(l.delay(entry.Attempts)); entry.Attempts > 0 && now.Before(next) {
+			retryAfter = next.Sub(now)
+			return entry, false
+		}
+
+		entry.Attempts++
+		entry.LastAttempt = now
+		if entry.Attempts >= l.policy.MaxAttempts {
+			entry.LockedUntil = now.Add(l.policy.LockoutDuration)
+			locked = true
+		}
+		return entry, true
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if retryAfter > 0 {
+		return time.Time{}, &LockedError{RetryAfter: retryAfter}
+	}
+	if locked {
+		return entry.LockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+// Forgive takes back one attempt of the key, it lets a successful attempt not count against a shared key like a client IP
+func (l *Limiter) Forgive(ctx context.Context, key string) error {
+	_, err := l.store.Update(ctx, key, func(entry Entry, found bool) (Entry, bool) {
+		if !found || entry.Attempts == 0 {
+			return entry, false
+		}
+		entry.Attempts--
+		if entry.Attempts < l.policy.MaxAttempts {
+			// the attempt that locked the key out succeeded
+			entry.LockedUntil = time.Time{}
+		}
+		return entry, true
+	})
+	return err
+}
+
+// Reset forgets every attempt of the key
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.store.Delete(ctx, key)
+}
+
+// delay returns how long to wait after the given number of attempts
+func (l *Limiter) delay(attempts int) time.Duration {
+	if attempts < l.policy.FreeAttempts {
+		return 0
+	}
+	delay := float64(l.policy.BaseDelay) * math.Pow(2, float64(attempts-l.policy.FreeAttempts))
+	if delay > float64(l.policy.MaxDelay) {
+		return l.policy.MaxDelay
+	}
+	return time.Duration(delay)
+}
+
+// expired reports whether the key has not been tried for long enough to forget its attempts
+func (l *Limiter) expired(entry Entry, now time.Time) bool {
+	return now.After(entry.LockedUntil) && now.Sub(entry.LastAttempt) > l.policy.ResetAfter
+}
@@ -0,0 +1,144 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (fc *fakeClock) Now() time.Time {
+	return fc.now
+}
+
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.now = fc.now.Add(d)
+}
+
+func newTestLimiter(clock *fakeClock) *Limiter {
+	limiter := NewLimiter(NewMemoryStore(time.Hour), Policy{
+		FreeAttempts:    2,
+		BaseDelay:       time.Second,
+		MaxDelay:        4 * time.Second,
+		MaxAttempts:     6,
+		LockoutDuration: time.Minute,
+		ResetAfter:      time.Hour,
+	})
+	limiter.now = clock.Now
+	return limiter
+}
+
+func retryAfter(err error) time.Duration {
+	var locked *LockedError
+	if errors.As(err, &locked) {
+		return locked.RetryAfter
+	}
+	return 0
+}
+
+func TestLimiter_Backoff(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Now()}
+	limiter := newTestLimiter(clock)
+
+	for i := 0; i < 2; i++ {
+		_, err := limiter.Attempt(ctx, "key")
+		assert.NoError(t, err, "Free attempts should not be delayed")
+	}
+
+	// the delay doubles after every attempt beyond the free ones and is capped
+	for _, delay := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		_, err := limiter.Attempt(ctx, "key")
+		assert.Equal(t, delay, retryAfter(err))
+		clock.Advance(delay)
+		lockedUntil, err := limiter.Attempt(ctx, "key")
+		assert.NoError(t, err)
+		assert.True(t, lockedUntil.IsZero())
+	}
+
+	_, err := limiter.Attempt(ctx, "other")
+	assert.NoError(t, err, "Keys should be counted separately")
+}
+
+func TestLimiter_Lockout(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Now()}
+	limiter := newTestLimiter(clock)
+
+	var lockedUntil time.Time
+	for i := 0; i < 6; i++ {
+		clock.Advance(4 * time.Second)
+		var err error
+		lockedUntil, err = limiter.Attempt(ctx, "key")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, clock.now.Add(time.Minute), lockedUntil, "The last allowed attempt should start the lockout")
+
+	clock.Advance(30 * time.Second)
+	_, err := limiter.Attempt(ctx, "key")
+	assert.Equal(t, 30*time.Second, retryAfter(err))
+
+	clock.Advance(30 * time.Second)
+	for i := 0; i < 2; i++ {
+		_, err = limiter.Attempt(ctx, "key")
+		assert.NoError(t, err, "The attempts should start again after the lockout")
+	}
+}
+
+func TestLimiter_ResetAndForgive(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Now()}
+	limiter := newTestLimiter(clock)
+
+	for i := 0; i < 2; i++ {
+		_, err := limiter.Attempt(ctx, "key")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, limiter.Forgive(ctx, "key"))
+	_, err := limiter.Attempt(ctx, "key")
+	assert.NoError(t, err, "A forgiven attempt should not count")
+	_, err = limiter.Attempt(ctx, "key")
+	assert.Error(t, err)
+
+	assert.NoError(t, limiter.Reset(ctx, "key"))
+	for i := 0; i < 2; i++ {
+		_, err = limiter.Attempt(ctx, "key")
+		assert.NoError(t, err, "The attempts should start again after a reset")
+	}
+
+	clock.Advance(2 * time.Hour)
+	_, err = limiter.Attempt(ctx, "key")
+	assert.NoError(t, err)
+	_, err = limiter.Attempt(ctx, "key")
+	assert.NoError(t, err, "Attempts should be forgotten after the reset period")
+}
+
+func TestLimiter_ConcurrentAttempts(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Now()}
+	limiter := newTestLimiter(clock)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := limiter.Attempt(ctx, "key"); err == nil {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 2, allowed, "Parallel attempts should not slip through the backoff")
+}
@@ -0,0 +1,57 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps the entries in the memory of the process,
+// it is enough for a single instance and for tests while several instances need a shared store
+type MemoryStore struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]Entry
+	lastPurge time.Time
+}
+
+// NewMemoryStore creates a store that drops the entries not updated for the given time once they are not locked anymore
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{ttl: ttl, entries: make(map[string]Entry)}
+}
+
+// Update applies fn to the entry of the key and saves the result when fn reports a change
+func (ms *MemoryStore) Update(ctx context.Context, key string, fn func(entry Entry, found bool) (Entry, bool)) (Entry, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.purgeExpired(time.Now())
+
+	entry, found := ms.entries[key]
+	updated, changed := fn(entry, found)
+	if changed {
+		ms.entries[key] = updated
+	}
+	return updated, nil
+}
+
+// Delete removes the entry of the key
+func (ms *MemoryStore) Delete(ctx context.Context, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.entries, key)
+	return nil
+}
+
+// purgeExpired drops the stale entries at most once per TTL, the caller must hold the lock
+func (ms *MemoryStore) purgeExpired(now time.Time) {
+	if now.Sub(ms.lastPurge) < ms.ttl {
+		return
+	}
+	ms.lastPurge = now
+	for key, entry := range ms.entries {
+		if now.After(entry.LockedUntil) && now.Sub(entry.LastAttempt) > ms.ttl {
+			delete(ms.entries, key)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Message is an email sent to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails, implementations can be swapped without touching the logic that sends them
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer writes the emails to the log instead of delivering them, it is meant for local runs.
+// Only the recipient and the subject are logged since the body holds the links with the tokens of the account
+type LogMailer struct {
+	logger *zap.Logger
+}
+
+// NewLogMailer creates a new instance of LogMailer
+func NewLogMailer(logger *zap.Logger) *LogMailer {
+	return &LogMailer{logger: logger}
+}
+
+// Send logs the recipient and the subject of the message
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.logger.Info("Email sent", zap.String("to", msg.To), zap.String("subject", msg.Subject))
+	return nil
+}
+
+// SMTPMailer delivers the emails through an SMTP server, the connection is upgraded with STARTTLS when the server supports it
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer creates a new instance of SMTPMailer for the server at addr (host:port),
+// the server is only authenticated against when a username is given
+func NewSMTPMailer(addr, from, username, password string) (*SMTPMailer, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing smtp address")
+	}
+	if from == "" {
+		return nil, errors.New("missing sender address")
+	}
+	m := &SMTPMailer{addr: addr, from: from}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m, nil
+}
+
+// Send delivers the message as a plain text email
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	// a line break in a header would let the caller add headers or recipients of its own
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return errors.New("line break in the email headers")
+	}
+	content := strings.Join([]string{
+		"From: " + m.from,
+		"To: " + msg.To,
+		"Subject: " + msg.Subject,
+		"Date: " + time.Now().UTC().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		strings.ReplaceAll(msg.Body, "\n", "\r\n"),
+	}, "\r\n")
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, []byte(content)); err != nil {
+		return errors.Wrap(err, "sending mail")
+	}
+	return nil
+}
+
+// FileMailer writes every email to its own file in a directory so it can be inspected
+type FileMailer struct {
+	dir string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]`)
+
+// NewFileMailer creates a new instance of FileMailer and the directory if it does not exist
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "creating mail directory")
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+// Send writes the message to a .eml file named after the time and the recipient
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	content := strings.Join([]string{
+		"To: " + msg.To,
+		"Subject: " + msg.Subject,
+		"Date: " + time.Now().UTC().Format(time.RFC1123Z),
+		"",
+		msg.Body,
+	}, "\r\n")
+	if err := os.WriteFile(filepath.Join(m.dir, name), []byte(content), 0o644); err != nil {
+		return errors.Wrap(err, "writing mail file")
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogMailer(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	m := NewLogMailer(zap.New(core))
+
+	err := m.Send(context.Background(), Message{To: "jane@example.com", Subject: "Reset your password", Body: "http://localhost:8080/reset-password?token=secret"})
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, logs.Len()) {
+		fields := logs.All()[0].ContextMap()
+		assert.Equal(t, map[string]interface{}{"to": "jane@example.com", "subject": "Reset your password"}, fields)
+	}
+}
+
+func TestNewSMTPMailer(t *testing.T) {
+	_, err := NewSMTPMailer("localhost", "app@example.com", "", "")
+	assert.Error(t, err, "the address needs a port")
+
+	_, err = NewSMTPMailer("localhost:25", "", "", "")
+	assert.Error(t, err, "the sender is required")
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	t.Run("Delivered", func(t *testing.T) {
+		addr, received := fakeSMTPServer(t)
+		m, err := NewSMTPMailer(addr, "app@example.com", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = m.Send(context.Background(), Message{To: "jane@example.com", Subject: "Verify your email", Body: "Hi Jane,\n\nhello"})
+		assert.NoError(t, err)
+		data := <-received
+		assert.Contains(t, data, "To: jane@example.com\r\n")
+		assert.Contains(t, data, "Subject: Verify your email\r\n")
+		assert.Contains(t, data, "\r\n\r\nHi Jane,\r\n\r\nhello")
+	})
+
+	t.Run("Line Break In The Headers", func(t *testing.T) {
+		m, err := NewSMTPMailer("localhost:25", "app@example.com", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = m.Send(context.Background(), Message{To: "jane@example.com\r\nBcc: eve@example.com", Subject: "Verify your email"})
+		assert.Error(t, err)
+	})
+}
+
+// fakeSMTPServer accepts a single SMTP session and sends the data of the message it received
+func fakeSMTPServer(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 localhost ready")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			switch command := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); command {
+			case "EHLO", "HELO", "MAIL", "RCPT":
+				tp.PrintfLine("250 OK")
+			case "DATA":
+				tp.PrintfLine("354 Go ahead")
+				data, err := readData(tp.R)
+				if err != nil {
+					return
+				}
+				received <- data
+				tp.PrintfLine("250 OK")
+			case "QUIT":
+				tp.PrintfLine("221 Bye")
+				return
+			default:
+				tp.PrintfLine("502 Not implemented")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+// readData reads the message up to the line with a single dot and keeps its line endings
+func readData(r *bufio.Reader) (string, error) {
+	var sb strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if line == ".\r\n" {
+			return sb.String(), nil
+		}
+		sb.WriteString(line)
+	}
+}
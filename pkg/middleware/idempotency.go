@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/a-berahman/dating-app/constant"
+	hash "github.com/a-berahman/dating-app/pkg/hash"
+	"github.com/a-berahman/dating-app/pkg/idempotency"
+	"github.com/a-berahman/dating-app/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// IdempotencyMiddleware replays the response of the first request to the retries that send the same Idempotency-Key header,
+// requests without the header are processed as usual. The keys are scoped to the authenticated user and the route so it must
+// run after the authentication middleware. Server errors are not stored so the request can be retried
+func IdempotencyMiddleware(store idempotency.Store, logger *zap.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			idempotencyKey := c.Request().Header.Get(constant.IdempotencyKeyHeader)
+			if idempotencyKey == "" {
+				return next(c)
+			}
+			if len(idempotencyKey) > constant.MaxIdempotencyKeyLength {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("%s must be at most %d characters", constant.IdempotencyKeyHeader, constant.MaxIdempotencyKeyLength)})
+			}
+
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": "failed to read the request body"})
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			ctx := c.Request().Context()
+			key := fmt.Sprintf("%d:%s:%s:%s", utils.GetUserIDFromContext(c), c.Request().Method, c.Path(), idempotencyKey)
+			fingerprint := hash.SHA256(string(body))
+			entry, found, err := store.Reserve(ctx, key, fingerprint)
+			if err != nil {
+				logger.Error("Failed to reserve idempotency key", zap.Error(err))
+				return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to process the idempotency key"})
+			}
+			if found {
+				switch {
+				case entry.Fingerprint != fingerprint:
+					return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": fmt.Sprintf("%s was already used with a different request", constant.IdempotencyKeyHeader)})
+				case entry.Response == nil:
+					return c.JSON(http.StatusConflict, echo.Map{"error": fmt.Sprintf("a request with this %s is still in progress", constant.IdempotencyKeyHeader)})
+				}
+				for name, values := range entry.Response.Header {
+					c.Response().Header()[name] = values
+				}
+				c.Response().Header().Set(constant.IdempotentReplayedHeader, "true")
+				return c.Blob(entry.Response.Status, entry.Response.Header.Get(echo.HeaderContentType), entry.Response.Body)
+			}
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+			err = next(c)
+			if err != nil {
+				// the error handler writes the response after the middleware returns so it cannot be stored
+				c.Error(err)
+			}
+
+			if c.Response().Status >= http.StatusInternalServerError {
+				if err := store.Release(ctx, key); err != nil {
+					logger.Error("Failed to release idempotency key", zap.Error(err))
+				}
+				return nil
+			}
+			response := idempotency.Response{
+				Status: c.Response().Status,
+				Header: http.Header{echo.HeaderContentType: c.Response().Header().Values(echo.HeaderContentType)},
+				Body:   recorder.body.Bytes(),
+			}
+			if err := store.Complete(ctx, key, response); err != nil {
+				logger.Error("Failed to store idempotent response", zap.Error(err))
+			}
+			return nil
+		}
+	}
+}
+
+// responseRecorder copies the body written to the response so it can be replayed
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
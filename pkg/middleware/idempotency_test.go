@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-berahman/dating-app/constant"
+	hash "github.com/a-berahman/dating-app/pkg/hash"
+	"github.com/a-berahman/dating-app/pkg/idempotency"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	e := echo.New()
+	calls := 0
+	status := http.StatusOK
+	handler := IdempotencyMiddleware(idempotency.NewMemoryStore(time.Hour), logger)(func(c echo.Context) error {
+		calls++
+		return c.JSON(status, echo.Map{"call": calls})
+	})
+
+	send := func(userID uint, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/swipe", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if key != "" {
+			req.Header.Set(constant.IdempotencyKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/swipe")
+		c.Set("userID", userID)
+		assert.NoError(t, handler(c))
+		return rec
+	}
+
+	// a retry with the same key and body gets the first response without calling the handler again
+	first := send(1, "key-1", `{"targetUserId":2}`)
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.JSONEq(t, `{"call":1}`, first.Body.String())
+	retry := send(1, "key-1", `{"targetUserId":2}`)
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.JSONEq(t, `{"call":1}`, retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get(constant.IdempotentReplayedHeader))
+	assert.Equal(t, 1, calls)
+
+	// the same key with another body is refused
+	assert.Equal(t, http.StatusUnprocessableEntity, send(1, "key-1", `{"targetUserId":3}`).Code)
+
+	// keys are scoped to the user and requests without a key are not deduplicated
+	assert.JSONEq(t, `{"call":2}`, send(2, "key-1", `{"targetUserId":2}`).Body.String())
+	assert.JSONEq(t, `{"call":3}`, send(1, "", `{"targetUserId":2}`).Body.String())
+	assert.JSONEq(t, `{"call":4}`, send(1, "", `{"targetUserId":2}`).Body.String())
+
+	// server errors are not stored so the request can be retried
+	status = http.StatusInternalServerError
+	assert.Equal(t, http.StatusInternalServerError, send(1, "key-2", `{}`).Code)
+	status = http.StatusOK
+	assert.JSONEq(t, `{"call":6}`, send(1, "key-2", `{}`).Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, send(1, strings.Repeat("k", constant.MaxIdempotencyKeyLength+1), `{}`).Code)
+}
+
+func TestIdempotencyMiddlewareInFlight(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	store := idempotency.NewMemoryStore(time.Hour)
+	e := echo.New()
+
+	// a key reserved by a request with the same body that is still in flight
+	_, _, err := store.Reserve(context.Background(), "1:POST:/swipe:key", hash.SHA256(`{"targetUserId":2}`))
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/swipe", strings.NewReader(`{"targetUserId":2}`))
+	req.Header.Set(constant.IdempotencyKeyHeader, "key")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/swipe")
+	c.Set("userID", uint(1))
+	handler := IdempotencyMiddleware(store, logger)(func(c echo.Context) error {
+		t.Fatal("the handler must not be called while the key is in flight")
+		return nil
+	})
+	assert.NoError(t, handler(c))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
@@ -1,12 +1,10 @@
 package middleware
 
 import (
-	"cmp"
+	"context"
 	"net/http"
-	"os"
 	"strings"
 
-	"github.com/a-berahman/dating-app/constant"
 	"github.com/a-berahman/dating-app/internal/model"
 	"github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
@@ -14,8 +12,18 @@ import (
 	"go.uber.org/zap"
 )
 
-// UserAuthMiddleware authenticates users and sets their ID in the context
-func UserAuthMiddleware(logger *zap.Logger) echo.MiddlewareFunc {
+// RevocationChecker reports whether the token of the claims has been revoked
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, claims *model.Claims) (bool, error)
+}
+
+// KeyResolver resolves the key that verifies the signature of a token
+type KeyResolver interface {
+	Keyfunc(token *jwt.Token) (interface{}, error)
+}
+
+// UserAuthMiddleware authenticates users, rejects revoked tokens and sets the user ID and the claims in the context
+func UserAuthMiddleware(keys KeyResolver, revocations RevocationChecker, logger *zap.Logger) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			authHeader := c.Request().Header.Get("Authorization")
@@ -31,22 +39,57 @@ func UserAuthMiddleware(logger *zap.Logger) echo.MiddlewareFunc {
 			}
 
 			tokenStr := authHeader[len(bearerPrefix):]
-			claims, err := parseToken(tokenStr)
+			claims, err := parseToken(tokenStr, keys)
 			if err != nil {
 				logger.Error("Token parsing failed", zap.Error(err))
 				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid or expired token"})
 			}
 
+			if claims.MFAPending {
+				logger.Debug("MFA pending token used as access token", zap.Uint("userID", claims.UserID))
+				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid or expired token"})
+			}
+
+			revoked, err := revocations.IsRevoked(c.Request().Context(), claims)
+			if err != nil {
+				logger.Error("Token revocation check failed", zap.Error(err))
+				return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to validate token"})
+			}
+			if revoked {
+				logger.Debug("Revoked token used", zap.Uint("userID", claims.UserID))
+				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid or expired token"})
+			}
+
 			c.Set("userID", claims.UserID)
+			c.Set("claims", claims)
+			return next(c)
+		}
+	}
+}
+
+// QueryTokenMiddleware moves the access token of the query to the Authorization header for the clients that cannot set
+// headers, like the WebSocket of the browsers. It must run before UserAuthMiddleware, a request with the header keeps it.
+// The token is removed from the URL so the request log does not record it
+func QueryTokenMiddleware(param string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			query := req.URL.Query()
+			if token := query.Get(param); token != "" {
+				if req.Header.Get("Authorization") == "" {
+					req.Header.Set("Authorization", "Bearer "+token)
+				}
+				query.Del(param)
+				req.URL.RawQuery = query.Encode()
+				req.RequestURI = req.URL.RequestURI()
+			}
 			return next(c)
 		}
 	}
 }
 
-func parseToken(tokenStr string) (*model.Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &model.Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(cmp.Or(os.Getenv(constant.JWT_CONFIG_SECRET_KEY), constant.JWT_DEFAULT_SECRET_VALUE)), nil
-	})
+func parseToken(tokenStr string, keys KeyResolver) (*model.Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &model.Claims{}, keys.Keyfunc)
 
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to parse token")
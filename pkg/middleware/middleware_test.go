@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/a-berahman/dating-app/constant"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryTokenMiddleware(t *testing.T) {
+	e := echo.New()
+	handler := QueryTokenMiddleware(constant.AccessTokenQueryParam)(func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Request().Header.Get("Authorization")+" "+c.Request().RequestURI)
+	})
+	send := func(target, authorization string) string {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler(e.NewContext(req, rec)))
+		return rec.Body.String()
+	}
+
+	// the token moves to the header and out of the logged URL
+	assert.Equal(t, "Bearer abc /ws?since=1", send("/ws?access_token=abc&since=1", ""))
+	// the header wins over the query
+	assert.Equal(t, "Bearer header /ws", send("/ws?access_token=abc", "Bearer header"))
+	assert.Equal(t, " /ws", send("/ws", ""))
+}
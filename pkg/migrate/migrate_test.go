@@ -0,0 +1,134 @@
+package migrate
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var testMigrations = fstest.MapFS{
+	"0002_add_index.up.sql":      {Data: []byte("CREATE INDEX idx_users_name ON users (name);")},
+	"0002_add_index.down.sql":    {Data: []byte("DROP INDEX idx_users_name;")},
+	"0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id bigserial PRIMARY KEY, name text);")},
+	"0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	"README.md":                  {Data: []byte("not a migration")},
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(testMigrations)
+	assert.NoError(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "create_users", Up: "CREATE TABLE users (id bigserial PRIMARY KEY, name text);", Down: "DROP TABLE users;"},
+		{Version: 2, Name: "add_index", Up: "CREATE INDEX idx_users_name ON users (name);", Down: "DROP INDEX idx_users_name;"},
+	}, migrations)
+
+	_, err = Load(fstest.MapFS{"0001_create_users.up.sql": {Data: []byte("CREATE TABLE users ();")}})
+	assert.EqualError(t, err, "migration 1_create_users needs an up and a down file")
+
+	_, err = Load(fstest.MapFS{
+		"0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users ();")},
+		"0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"0001_create_swipes.up.sql":  {Data: []byte("CREATE TABLE swipes ();")},
+	})
+	assert.Error(t, err)
+}
+
+// expectLock expects the lock of the migrator and the read of the applied versions
+func expectLock(mock sqlmock.Sqlmock, applied ...int64) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock($1)")).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_migrations")).WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "applied_at"})
+	for _, version := range applied {
+		rows.AddRow(version, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, applied_at FROM schema_migrations")).WillReturnRows(rows)
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestMigrator_Up(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	m, err := New(db, testMigrations)
+	assert.NoError(t, err)
+
+	// the first version is applied already
+	expectLock(mock, 1)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("CREATE INDEX idx_users_name ON users (name);")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)")).
+		WithArgs(int64(2), "add_index").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectUnlock(mock)
+
+	applied, err := m.Up(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, applied, 1)
+	assert.Equal(t, int64(2), applied[0].Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_UpFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	m, err := New(db, testMigrations)
+	assert.NoError(t, err)
+
+	// a failing migration is rolled back with its version and the following ones are not applied
+	expectLock(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE users")).WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+	expectUnlock(mock)
+
+	applied, err := m.Up(context.Background())
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Empty(t, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_Down(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	m, err := New(db, testMigrations)
+	assert.NoError(t, err)
+
+	// only the latest version is reverted by one step
+	expectLock(mock, 1, 2)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DROP INDEX idx_users_name;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM schema_migrations WHERE version = $1")).
+		WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectUnlock(mock)
+
+	reverted, err := m.Down(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.Equal(t, "add_index", reverted[0].Name)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_Status(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	m, err := New(db, testMigrations)
+	assert.NoError(t, err)
+
+	expectLock(mock, 1)
+	expectUnlock(mock)
+
+	statuses, err := m.Status(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), *statuses[0].AppliedAt)
+	assert.Nil(t, statuses[1].AppliedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,74 @@
+package totp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfcSecret is the ASCII secret "12345678901234567890" of the test vectors of RFC 4226 and the SHA1 test vectors of RFC 6238
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTP(t *testing.T) {
+	key, err := decodeSecret(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// RFC 4226 Appendix D
+	expected := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, want := range expected {
+		assert.Equal(t, want, code(key, int64(counter), 6), "counter %d", counter)
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	key, err := decodeSecret(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// RFC 6238 Appendix B, the codes of the SHA1 mode have 8 digits and the 6 digit codes are their last digits
+	tests := []struct {
+		unix     int64
+		expected string
+	}{
+		{unix: 59, expected: "94287082"},
+		{unix: 1111111109, expected: "07081804"},
+		{unix: 1111111111, expected: "14050471"},
+		{unix: 1234567890, expected: "89005924"},
+		{unix: 2000000000, expected: "69279037"},
+		{unix: 20000000000, expected: "65353130"},
+	}
+	for _, tt := range tests {
+		at := time.Unix(tt.unix, 0)
+		assert.Equal(t, tt.expected, code(key, Counter(at), 8), "time %d", tt.unix)
+
+		passcode, err := Code(rfcSecret, at)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected[2:], passcode, "time %d", tt.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+
+	// the code of the previous time step, 1111111109, is accepted within the skew and its time step is returned
+	counter, ok := Validate(rfcSecret, "050471", at, 1)
+	assert.True(t, ok)
+	assert.Equal(t, Counter(at), counter)
+	counter, ok = Validate(rfcSecret, "081804", at, 1)
+	assert.True(t, ok)
+	assert.Equal(t, Counter(at)-1, counter)
+	_, ok = Validate(rfcSecret, "081804", at, 0)
+	assert.False(t, ok)
+
+	// the secrets may be padded or lower case, malformed codes and secrets are rejected
+	_, ok = Validate("gezdgnbvgy3tqojqgezdgnbvgy3tqojq====", "050471", at, 0)
+	assert.True(t, ok)
+	_, ok = Validate(rfcSecret, "50471", at, 1)
+	assert.False(t, ok)
+	_, ok = Validate("not base32!", "050471", at, 1)
+	assert.False(t, ok)
+}
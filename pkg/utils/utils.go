@@ -1,9 +1,13 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
 	"time"
 
 	"github.com/a-berahman/dating-app/constant"
+	"github.com/a-berahman/dating-app/internal/model"
 	"github.com/brianvoe/gofakeit/v6"
 	"github.com/labstack/echo/v4"
 )
@@ -47,6 +51,11 @@ func CalculateAge(dob time.Time) int {
 	return age
 }
 
+// NormalizeEmail returns the email the way it is stored, the case and the surrounding spaces of an email do not matter
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
 // ErrorResponse is a helper to send uniform error responses
 func ErrorResponse(c echo.Context, statusCode int, message string) error {
 	return c.JSON(statusCode, echo.Map{"error": message})
@@ -59,3 +68,21 @@ func GetUserIDFromContext(c echo.Context) uint {
 	}
 	return userID
 }
+
+// GetClaimsFromContext returns the claims of the authenticated token, it returns nil when the request is not authenticated
+func GetClaimsFromContext(c echo.Context) *model.Claims {
+	claims, ok := c.Get("claims").(*model.Claims)
+	if !ok {
+		return nil
+	}
+	return claims
+}
+
+// GenerateRandomToken returns a URL safe random token built from the given number of bytes
+func GenerateRandomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}